@@ -0,0 +1,144 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/sso"
+)
+
+const (
+	accessTokenCookie  = "access_token"
+	refreshTokenCookie = "refresh_token"
+	csrfTokenCookie    = "csrf_token"
+	// oidcStateCookie ties a login with an identity provider to the browser it was started in
+	oidcStateCookie = "oidc_state"
+	oidcStatePath   = "/auth/oidc"
+	// csrfTokenHeader is the header in which browser clients are to send back the value of the
+	// CSRF cookie
+	csrfTokenHeader = "X-CSRF-Token"
+)
+
+// CookieConfig is the configuration of the cookies set in the cookie session mode
+type CookieConfig struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// setCookie sets a cookie, or removes it if maxAge is negative
+func (h *Handlers) setCookie(c *gin.Context, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   h.cfg.Cookies.Domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   h.cfg.Cookies.Secure,
+		HttpOnly: httpOnly,
+		SameSite: h.cfg.Cookies.SameSite,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+
+	http.SetCookie(c.Writer, cookie)
+}
+
+// setSessionCookies sets the tokens as HttpOnly cookies, along with a new CSRF token which is
+// readable by the client. It returns the CSRF token.
+func (h *Handlers) setSessionCookies(c *gin.Context, accessToken, refreshToken string) (string, error) {
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	h.setCookie(c, accessTokenCookie, accessToken, "/", h.tm.GetAccessExpiry(), true)
+	// the refresh token is only required for the auth APIs, e.g. /auth/refresh
+	h.setCookie(c, refreshTokenCookie, refreshToken, "/auth", h.tm.GetRefreshExpiry(), true)
+	h.setCookie(c, csrfTokenCookie, csrfToken, "/", h.tm.GetRefreshExpiry(), false)
+
+	return csrfToken, nil
+}
+
+// clearSessionCookies removes all the cookies set by setSessionCookies
+func (h *Handlers) clearSessionCookies(c *gin.Context) {
+	h.setCookie(c, accessTokenCookie, "", "/", -1, true)
+	h.setCookie(c, refreshTokenCookie, "", "/auth", -1, true)
+	h.setCookie(c, csrfTokenCookie, "", "/", -1, false)
+}
+
+// setOIDCStateCookie sets the state of a login with an identity provider, or removes it if maxAge
+// is negative. It is always SameSite=Lax, since the provider redirecting back is a cross-site
+// (top level) navigation, and it's never readable by the client.
+func (h *Handlers) setOIDCStateCookie(c *gin.Context, state string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcStatePath,
+		Domain:   h.cfg.Cookies.Domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   h.cfg.Cookies.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+
+	http.SetCookie(c.Writer, cookie)
+}
+
+// checkOIDCState checks the state the identity provider redirected back with is of the login
+// started in the same browser
+func checkOIDCState(c *gin.Context, state string) error {
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		return errors.ValidationErr(sso.ErrInvalidState, "login was not started in this browser")
+	}
+
+	return nil
+}
+
+func newCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", errors.InternalErr(err, "failed generating CSRF token")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// checkCSRF enforces the double-submit CSRF token on state-changing requests, i.e. the value
+// of the CSRF cookie must be sent back in the CSRF header. A cross-site request carries the
+// cookie, but cannot read it to set the header.
+func checkCSRF(c *gin.Context) error {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	cookie, err := c.Cookie(csrfTokenCookie)
+	if err != nil || cookie == "" {
+		return errors.Unauthorized("missing CSRF token")
+	}
+
+	header := c.GetHeader(csrfTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		return errors.Unauthorized("invalid CSRF token")
+	}
+
+	return nil
+}
+
+// usesCookieSession reports whether the request was authenticated using the session cookies
+func usesCookieSession(c *gin.Context) bool {
+	return c.GetBool("cookieSession")
+}
@@ -12,15 +12,19 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 
 	"github.com/baobei23/goapp/internal/api"
+	"github.com/baobei23/goapp/internal/apikeys"
 	"github.com/baobei23/goapp/internal/pkg/jwt"
 	"github.com/baobei23/goapp/internal/pkg/logger"
+	"github.com/baobei23/goapp/internal/users"
 )
 
 // Handlers struct has all the dependencies required for HTTP handlers
 type Handlers struct {
-	apis api.Server
-	home *template.Template
-	tm   *jwt.TokenManager
+	cfg        *Config
+	apis       api.Server
+	home       *template.Template
+	sharedNote *template.Template
+	tm         *jwt.TokenManager
 }
 
 func (h *Handlers) registerRoutes(r *gin.Engine) {
@@ -35,16 +39,96 @@ func (h *Handlers) registerRoutes(r *gin.Engine) {
 	r.POST("/register", errWrapper(h.Register))
 	r.POST("/login", errWrapper(h.Login))
 	r.POST("/auth/refresh", errWrapper(h.RefreshToken))
+	r.POST("/auth/mfa/verify", errWrapper(h.VerifyMFA))
+	r.POST("/auth/password/forgot", errWrapper(h.ForgotPassword))
+	r.POST("/auth/password/reset", errWrapper(h.ResetPassword))
+	r.POST("/auth/email/verify", errWrapper(h.VerifyEmail))
+	r.POST("/auth/email/resend", errWrapper(h.ResendEmailVerification))
+	r.GET("/.well-known/jwks.json", errWrapper(h.JWKS))
+	r.GET("/auth/oidc/:provider/login", errWrapper(h.OIDCLogin))
+	r.GET("/auth/oidc/:provider/callback", errWrapper(h.OIDCCallback))
+
+	// public links to notes, the password of a link is posted by the HTML form asking for it
+	r.GET("/s/:token", errWrapper(h.ViewSharedNote))
+	r.POST("/s/:token", errWrapper(h.ViewSharedNote))
+
+	// authenticated routes are accessible even if the user's email is not verified yet. Logging out
+	// is not allowed while impersonating, it would end the sessions of the user
+	authenticated := r.Group("/")
+	authenticated.Use(h.AuthMiddleware())
+	authenticated.POST("/auth/email/verification", errWrapper(h.IssueEmailVerification))
+	authenticated.POST("/auth/logout", h.RejectAPIKeys(), h.RejectImpersonation(), errWrapper(h.Logout))
+	authenticated.POST("/auth/logout-all", h.RejectAPIKeys(), h.RejectImpersonation(), errWrapper(h.LogoutAll))
 
 	protected := r.Group("/")
-	protected.Use(h.AuthMiddleware())
+	protected.Use(h.AuthMiddleware(), h.VerifiedEmailMiddleware())
 
 	//users
-	protected.GET("/users", errWrapper(h.ReadUserByEmail))
+	protected.GET("/users", h.RequirePermission(users.PermissionUsersRead), errWrapper(h.ReadUserByEmail))
+	protected.GET("/users/me", h.RequireScope(apikeys.ScopeProfileRead), errWrapper(h.ReadMe))
+	protected.PATCH("/users/me", h.RequireScope(apikeys.ScopeProfileWrite), errWrapper(h.UpdateMe))
+	protected.GET("/users/me/export", h.RequireScope(apikeys.ScopeProfileRead), errWrapper(h.ExportMe))
+
+	// account security can only be managed by the user, not by their API keys or an admin
+	// impersonating them
+	account := protected.Group("/users/me")
+	account.Use(h.RejectAPIKeys(), h.RejectImpersonation())
+	account.DELETE("", errWrapper(h.DeleteMe))
+	account.POST("/password", errWrapper(h.ChangePassword))
+	account.POST("/mfa", errWrapper(h.EnrollMFA))
+	account.POST("/mfa/confirm", errWrapper(h.ConfirmMFA))
+	account.DELETE("/mfa", errWrapper(h.DisableMFA))
+	account.GET("/api-keys", errWrapper(h.ListAPIKeys))
+	account.POST("/api-keys", errWrapper(h.CreateAPIKey))
+	account.DELETE("/api-keys/:keyID", errWrapper(h.RevokeAPIKey))
+	account.GET("/sessions", errWrapper(h.ListSessions))
+	account.DELETE("/sessions/:sessionID", errWrapper(h.EndSession))
+
+	//admin
+	admin := protected.Group("/admin")
+	admin.Use(h.RequirePermission(users.PermissionUsersManage))
+	admin.PUT("/users/:userID/roles/:role", errWrapper(h.AssignUserRole))
+	admin.DELETE("/users/:userID/roles/:role", errWrapper(h.RevokeUserRole))
+	admin.POST("/users/:userID/unlock", errWrapper(h.UnlockUser))
+	admin.GET("/audit-log", errWrapper(h.ListAuditLog))
+	// impersonation tokens cannot be used to impersonate someone else in turn
+	admin.POST(
+		"/users/:userID/impersonate",
+		h.RequirePermission(users.PermissionUsersImpersonate),
+		h.RejectAPIKeys(),
+		h.RejectImpersonation(),
+		errWrapper(h.ImpersonateUser),
+	)
 
 	//usernotes
-	protected.POST("/usernotes", errWrapper(h.RegisterNote))
-	protected.GET("/usernotes/:noteID", errWrapper(h.ReadUserNote))
+	protected.POST("/usernotes", h.RequireScope(apikeys.ScopeNotesWrite), errWrapper(h.RegisterNote))
+	protected.GET("/usernotes", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.ListUserNotes))
+	protected.GET("/usernotes/trash", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.ListTrashedNotes))
+	protected.GET("/usernotes/shared", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.ListSharedNotes))
+	protected.GET("/usernotes/links", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.ListUserNoteLinks))
+	protected.DELETE("/usernotes/links/:linkID", h.RequireScope(apikeys.ScopeNotesWrite), errWrapper(h.RevokeUserNoteLink))
+	protected.GET("/usernotes/search", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.SearchUserNotes))
+	protected.GET("/usernotes/tags", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.ListUserNoteTags))
+	protected.GET("/usernotes/:noteID", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.ReadUserNote))
+	protected.PUT("/usernotes/:noteID", h.RequireScope(apikeys.ScopeNotesWrite), errWrapper(h.ReplaceUserNote))
+	protected.PATCH("/usernotes/:noteID", h.RequireScope(apikeys.ScopeNotesWrite), errWrapper(h.PatchUserNote))
+	protected.DELETE("/usernotes/:noteID", h.RequireScope(apikeys.ScopeNotesWrite), errWrapper(h.TrashUserNote))
+	protected.POST("/usernotes/:noteID/restore", h.RequireScope(apikeys.ScopeNotesWrite), errWrapper(h.RestoreUserNote))
+	protected.GET("/usernotes/:noteID/revisions", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.ListUserNoteRevisions))
+	protected.GET("/usernotes/:noteID/revisions/diff", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.DiffUserNoteRevisions))
+	protected.POST(
+		"/usernotes/:noteID/revisions/:revision/restore",
+		h.RequireScope(apikeys.ScopeNotesWrite),
+		errWrapper(h.RestoreUserNoteRevision),
+	)
+	protected.GET("/usernotes/:noteID/shares", h.RequireScope(apikeys.ScopeNotesRead), errWrapper(h.ListUserNoteShares))
+	protected.POST("/usernotes/:noteID/shares", h.RequireScope(apikeys.ScopeNotesWrite), errWrapper(h.ShareUserNote))
+	protected.DELETE(
+		"/usernotes/:noteID/shares/:userID",
+		h.RequireScope(apikeys.ScopeNotesWrite),
+		errWrapper(h.RevokeUserNoteShare),
+	)
+	protected.POST("/usernotes/:noteID/links", h.RequireScope(apikeys.ScopeNotesWrite), errWrapper(h.CreateUserNoteLink))
 }
 
 func (h *Handlers) HelloWorld(c *gin.Context) error {
@@ -87,14 +171,14 @@ func errWrapper(h func(c *gin.Context) error) gin.HandlerFunc {
 	}
 }
 
-func loadHomeTemplate(basePath string) (*template.Template, error) {
-	t := template.New("index.html")
-	home, err := t.ParseFiles(
-		fmt.Sprintf("%s/index.html", basePath),
+func loadTemplate(basePath, name string) (*template.Template, error) {
+	t := template.New(name)
+	parsed, err := t.ParseFiles(
+		fmt.Sprintf("%s/%s", basePath, name),
 	)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed parsing templates")
 	}
 
-	return home, nil
+	return parsed, nil
 }
@@ -0,0 +1,209 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/audit"
+	"github.com/baobei23/goapp/internal/users"
+)
+
+// assignUserRole godoc
+//
+//	@Summary		Assign User Role
+//	@Description	Grant a role to a user. Requires the users:manage permission
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			userID	path	string	true	"User ID"
+//	@Param			role	path	string	true	"Role"
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/admin/users/{userID}/roles/{role} [put]
+//	@Security		ApiKeyAuth
+func (h *Handlers) AssignUserRole(c *gin.Context) error {
+	userID := c.Param("userID")
+	role := c.Param("role")
+	if userID == "" || role == "" {
+		return errors.InputBody("userID and role are required")
+	}
+
+	err := h.apis.AssignUserRole(c.Request.Context(), userID, role)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// revokeUserRole godoc
+//
+//	@Summary		Revoke User Role
+//	@Description	Take away a role from a user. Requires the users:manage permission
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			userID	path	string	true	"User ID"
+//	@Param			role	path	string	true	"Role"
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/admin/users/{userID}/roles/{role} [delete]
+//	@Security		ApiKeyAuth
+func (h *Handlers) RevokeUserRole(c *gin.Context) error {
+	userID := c.Param("userID")
+	role := c.Param("role")
+	if userID == "" || role == "" {
+		return errors.InputBody("userID and role are required")
+	}
+
+	err := h.apis.RevokeUserRole(c.Request.Context(), userID, role)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// unlockUser godoc
+//
+//	@Summary		Unlock User
+//	@Description	Lift the lock placed on a user's account after too many failed login attempts. Requires the users:manage permission
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			userID	path	string	true	"User ID"
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/admin/users/{userID}/unlock [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) UnlockUser(c *gin.Context) error {
+	userID := c.Param("userID")
+	if userID == "" {
+		return errors.InputBody("userID is required")
+	}
+
+	err := h.apis.UnlockUser(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+type ImpersonateRequest struct {
+	// Reason is recorded in the audit trail, e.g. the support ticket being worked on
+	Reason string `json:"reason" binding:"required,max=500"`
+	// Audience is the client the token is to be issued for, the default audience is used if empty
+	Audience string `json:"audience"`
+}
+
+// ImpersonationResponse has the access token to act as the user with. No refresh token is issued
+type ImpersonationResponse struct {
+	AccessToken string      `json:"accessToken"`
+	ExpiresIn   int64       `json:"expiresIn"`
+	User        *users.User `json:"user"`
+}
+
+// impersonateUser godoc
+//
+//	@Summary		Impersonate User
+//	@Description	Issue a short-lived access token to act as a user, e.g. to reproduce their issues. Requires the
+//	@Description	users:impersonate permission. The token carries the admin in the `act` claim, and every write request
+//	@Description	made with it is recorded in the audit trail (or rejected, if impersonation is configured to be read-only).
+//	@Description	Other admins, or users with any permission the admin does not have, cannot be impersonated
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		string				true	"User ID"
+//	@Param			payload	body		ImpersonateRequest	true	"Impersonate Payload"
+//	@Success		200		{object}	BaseResponse{data=ImpersonationResponse}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		422		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/admin/users/{userID}/impersonate [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ImpersonateUser(c *gin.Context) error {
+	actorID := GetUserID(c)
+	if actorID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	req := &ImpersonateRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	audience, err := h.tm.ResolveAudience(req.Audience)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.apis.Impersonate(c.Request.Context(), actorID, c.Param("userID"), req.Reason)
+	if err != nil {
+		return err
+	}
+
+	sub := tokenSubject(user, "", audience)
+	sub.ActorID = actorID
+	token, _, err := h.tm.GenerateImpersonation(sub)
+	if err != nil {
+		return errors.InternalErr(err, "failed to generate access token")
+	}
+
+	JSON(c, http.StatusOK, &ImpersonationResponse{
+		AccessToken: token,
+		ExpiresIn:   int64(h.tm.GetImpersonationExpiry().Seconds()),
+		User:        user,
+	}, nil)
+
+	return nil
+}
+
+// listAuditLog godoc
+//
+//	@Summary		List Audit Log
+//	@Description	List the audit trail of sensitive actions, latest first. Requires the users:manage permission
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			actorID	query		string	false	"User who performed the actions"
+//	@Param			userID	query		string	false	"User the actions were performed on"
+//	@Param			limit	query		int		false	"Maximum number of entries (50 by default, at most 200)"
+//	@Success		200		{object}	BaseResponse{data=[]audit.Entry}
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		422		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/admin/audit-log [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListAuditLog(c *gin.Context) error {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	entries, err := h.apis.ListAuditLog(c.Request.Context(), &audit.Filter{
+		ActorID: c.Query("actorID"),
+		UserID:  c.Query("userID"),
+		Limit:   limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, entries, nil)
+
+	return nil
+}
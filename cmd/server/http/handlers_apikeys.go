@@ -0,0 +1,127 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/apikeys"
+)
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+	// Scopes limit what the key can be used for, e.g. notes:read. At least one is required, *
+	// grants all the access of the user
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreateAPIKeyResponse has the key, which is shown only once
+type CreateAPIKeyResponse struct {
+	*apikeys.APIKey
+	Key string `json:"key"`
+}
+
+// createAPIKey godoc
+//
+//	@Summary		Create API Key
+//	@Description	Create a personal API key, to be used as `Authorization: ApiKey <key>`. The key is shown only once.
+//	@Description	Scopes can be any of profile:read, profile:write, notes:read, notes:write and the permissions of the user.
+//	@Description	At least one scope is required, * grants all the access of the user
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateAPIKeyRequest	true	"Create API Key Payload"
+//	@Success		201		{object}	BaseResponse{data=CreateAPIKeyResponse}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		422		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/users/me/api-keys [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) CreateAPIKey(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	req := &CreateAPIKeyRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	key, secret, err := h.apis.CreateAPIKey(c.Request.Context(), &apikeys.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusCreated, &CreateAPIKeyResponse{APIKey: key, Key: secret}, nil)
+
+	return nil
+}
+
+// listAPIKeys godoc
+//
+//	@Summary		List API Keys
+//	@Description	List the active personal API keys of the authenticated user
+//	@Tags			Users
+//	@Produce		json
+//	@Success		200	{object}	BaseResponse{data=[]apikeys.APIKey}
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/users/me/api-keys [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListAPIKeys(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	keys, err := h.apis.ListAPIKeys(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, keys, nil)
+
+	return nil
+}
+
+// revokeAPIKey godoc
+//
+//	@Summary		Revoke API Key
+//	@Description	Revoke a personal API key of the authenticated user, it cannot be used anymore
+//	@Tags			Users
+//	@Produce		json
+//	@Param			keyID	path	string	true	"API Key ID"
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/users/me/api-keys/{keyID} [delete]
+//	@Security		ApiKeyAuth
+func (h *Handlers) RevokeAPIKey(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	err := h.apis.RevokeAPIKey(c.Request.Context(), userID, c.Param("keyID"))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
@@ -1,18 +1,27 @@
 package http
 
 import (
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/baobei23/goapp/internal/pkg/jwt"
+	"github.com/baobei23/goapp/internal/tokens"
 	"github.com/baobei23/goapp/internal/users"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/naughtygopher/errors"
 )
 
+// RegisterRequest has the profile of the user being registered. The phone is optional, as it is
+// for profile updates and users registered by SSO
 type RegisterRequest struct {
 	FullName       string `json:"fullName" binding:"required,max=255"`
 	Email          string `json:"email" binding:"required,email,max=255"`
 	Password       string `json:"password" binding:"required,min=8"`
-	Phone          string `json:"phone" binding:"required"`
+	Phone          string `json:"phone" binding:"max=255"`
 	ContactAddress string `json:"contactAddress" binding:"max=255"`
 }
 
@@ -52,27 +61,81 @@ func (h *Handlers) Register(c *gin.Context) error {
 	return nil
 }
 
+// tokenSubject returns the identity of the user to be embedded in the tokens
+func tokenSubject(user *users.User, familyID, audience string) *jwt.Subject {
+	return &jwt.Subject{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.IsVerified(),
+		Roles:         user.Roles,
+		Permissions:   user.Permissions,
+		FamilyID:      familyID,
+		Audience:      audience,
+	}
+}
+
+// refreshTokenRecord returns the refresh token of the pair, to be tracked by the tokens service
+func refreshTokenRecord(pair *jwt.Pair) *tokens.RefreshToken {
+	return &tokens.RefreshToken{
+		ID:        pair.Refresh.ID,
+		FamilyID:  pair.Refresh.FamilyID,
+		UserID:    pair.Refresh.UserID,
+		ExpiresAt: pair.Refresh.ExpiresAt.Time,
+	}
+}
+
+// clientDevice returns the device the request was made from, to be recorded with the session
+func clientDevice(c *gin.Context) *tokens.Device {
+	return &tokens.Device{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// Audience is the client the tokens are to be issued for, the tokens are not accepted by
+	// other clients. The default audience is used if empty
+	Audience string `json:"audience"`
+	// UseCookies sets the tokens as HttpOnly cookies instead of returning them, for browser clients
+	UseCookies bool `json:"useCookies"`
 }
+
+// LoginResponse has the token pair, or only the CSRF token if the tokens are set as cookies
 type LoginResponse struct {
-	AccessToken  string      `json:"accessToken"`
-	RefreshToken string      `json:"refreshToken"`
+	AccessToken  string      `json:"accessToken,omitempty"`
+	RefreshToken string      `json:"refreshToken,omitempty"`
+	CSRFToken    string      `json:"csrfToken,omitempty"`
 	ExpiresIn    int64       `json:"expiresIn"`
 	User         *users.User `json:"user"`
 }
 
+// MFARequiredResponse is the login response for users with two-factor authentication enabled.
+// The MFA token is to be exchanged for a token pair using /auth/mfa/verify
+type MFARequiredResponse struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+	ExpiresIn   int64  `json:"expiresIn"`
+}
+
 // login godoc
 //
 //	@Summary		Login
-//	@Description	Login
+//	@Description	Login. If the user has two-factor authentication enabled, an MFA token is returned instead of the token pair.
+//	@Description	With useCookies, the tokens are set as HttpOnly cookies, and the CSRF token (also set as the csrf_token cookie)
+//	@Description	is to be sent in the X-CSRF-Token header of every state-changing request
 //	@Tags			Auth
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		LoginRequest	true	"Login Payload"
 //	@Success		200		{object}	BaseResponse{data=LoginResponse}
+//	@Success		200		{object}	BaseResponse{data=MFARequiredResponse}
 //	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		422		{object}	ErrorResponse
+//	@Failure		423		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
 //	@Failure		500		{object}	ErrorResponse
 //	@Router			/login [post]
 func (h *Handlers) Login(c *gin.Context) error {
@@ -81,53 +144,141 @@ func (h *Handlers) Login(c *gin.Context) error {
 		return errors.InputBodyErr(err, "invalid JSON provided")
 	}
 
-	user, err := h.apis.Login(c.Request.Context(), req.Email, req.Password)
+	audience, err := h.tm.ResolveAudience(req.Audience)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.apis.Login(c.Request.Context(), req.Email, req.Password, c.ClientIP())
 	if err != nil {
+		throttled := &users.LoginThrottledError{}
+		if errors.As(err, &throttled) {
+			respondLoginThrottled(c, throttled)
+			return nil
+		}
 		return err
 	}
 
-	accessToken, refreshToken, err := h.tm.GeneratePair(user.ID, user.Email)
+	return h.respondAuthenticated(c, user, audience, req.UseCookies)
+}
+
+// respondAuthenticated responds to a user who has proven their identity, with an MFA token if
+// the user has two-factor authentication enabled, or else with a new token pair
+func (h *Handlers) respondAuthenticated(c *gin.Context, user *users.User, audience string, useCookies bool) error {
+	if user.MFAEnabled {
+		mfaToken, err := h.tm.GenerateMFAPending(user.ID, audience)
+		if err != nil {
+			return errors.InternalErr(err, "failed to generate MFA token")
+		}
+
+		JSON(c, http.StatusOK, &MFARequiredResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			ExpiresIn:   int64(h.tm.GetMFAPendingExpiry().Seconds()),
+		}, nil)
+
+		return nil
+	}
+
+	return h.respondLogin(c, user, audience, useCookies)
+}
+
+// respondLogin responds with a new token pair for the user, issued for the audience. Every
+// login starts a new refresh token family
+func (h *Handlers) respondLogin(c *gin.Context, user *users.User, audience string, useCookies bool) error {
+	sub := tokenSubject(user, uuid.NewString(), audience)
+	sub.AuthTime = time.Now()
+	pair, err := h.tm.GeneratePair(sub)
 	if err != nil {
 		return errors.InternalErr(err, "failed to generate access token")
 	}
 
-	JSON(c, http.StatusOK, &LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+	err = h.apis.IssueRefreshToken(c.Request.Context(), refreshTokenRecord(pair), clientDevice(c))
+	if err != nil {
+		return err
+	}
+
+	resp := &LoginResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
 		ExpiresIn:    int64(h.tm.GetAccessExpiry().Seconds()),
 		User:         user,
-	}, nil)
+	}
+
+	if useCookies {
+		resp.CSRFToken, err = h.setSessionCookies(c, pair.AccessToken, pair.RefreshToken)
+		if err != nil {
+			return err
+		}
+		resp.AccessToken, resp.RefreshToken = "", ""
+	}
+
+	JSON(c, http.StatusOK, resp, nil)
 
 	return nil
 }
 
+// respondLoginThrottled responds with 423 if the account/IP is locked, or 429 if the client
+// should only back off, along with the Retry-After header
+func respondLoginThrottled(c *gin.Context, throttled *users.LoginThrottledError) {
+	status := http.StatusTooManyRequests
+	if throttled.Locked {
+		status = http.StatusLocked
+	}
+
+	retryAfter := int64(math.Ceil(throttled.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	Error(c, status, throttled)
+}
+
+// RefreshTokenRequest has the refresh token, which is read from the cookie instead if empty
 type RefreshTokenRequest struct {
-	RefreshToken string `json:"refreshToken" binding:"required"`
+	RefreshToken string `json:"refreshToken"`
 }
+
+// RefreshTokenResponse has the token pair, or only the CSRF token if the tokens are set as cookies
 type RefreshTokenResponse struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
+	AccessToken  string `json:"accessToken,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	CSRFToken    string `json:"csrfToken,omitempty"`
 	ExpiresIn    int64  `json:"expiresIn"`
 }
 
 // refreshToken godoc
 //
 //	@Summary		Refresh Access Token
-//	@Description	Use valid refresh token to get new access token pair
+//	@Description	Use valid refresh token to get new access token pair. The refresh token is rotated and cannot be used again,
+//	@Description	reusing it revokes every refresh token issued since the login. If no refresh token is provided, it is read
+//	@Description	from the cookie (along with the CSRF token) and the new pair is set as cookies as well
 //	@Tags			Auth
 //	@Accept			json
 //	@Produce		json
-//	@Param			payload	body		RefreshTokenRequest	true	"Refresh Token Payload"
+//	@Param			payload	body		RefreshTokenRequest	false	"Refresh Token Payload"
 //	@Success		200		{object}	BaseResponse{data=RefreshTokenResponse}
 //	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
 //	@Failure		500		{object}	ErrorResponse
 //	@Router			/auth/refresh [post]
 func (h *Handlers) RefreshToken(c *gin.Context) error {
 	req := &RefreshTokenRequest{}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
 		return errors.InputBodyErr(err, "invalid JSON provided")
 	}
 
+	useCookies := req.RefreshToken == ""
+	if useCookies {
+		req.RefreshToken, _ = c.Cookie(refreshTokenCookie)
+		if req.RefreshToken == "" {
+			return errors.InputBody("no refresh token provided")
+		}
+
+		err := checkCSRF(c)
+		if err != nil {
+			return err
+		}
+	}
+
 	claims, err := h.tm.Validate(req.RefreshToken)
 	if err != nil {
 		return err
@@ -137,17 +288,360 @@ func (h *Handlers) RefreshToken(c *gin.Context) error {
 		return errors.Unauthorized("invalid token type")
 	}
 
-	accessToken, refreshToken, err := h.tm.GeneratePair(claims.UserID, claims.Email)
+	// tokens issued before rotation was introduced are not tracked, and cannot be rotated
+	if claims.ID == "" || claims.FamilyID == "" {
+		return errors.Unauthenticated("refresh token is not supported anymore, please login again")
+	}
+
+	user, err := h.apis.ReadUserByID(c.Request.Context(), claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	if claims.IssuedAt == nil || user.IssuedBeforePasswordChange(claims.IssuedAt.Time) {
+		return errors.Unauthorized("refresh token has been revoked")
+	}
+
+	// the new pair is issued for the same audience, so a token cannot be swapped for another client's
+	sub := tokenSubject(user, claims.FamilyID, claims.IssuedFor())
+	if claims.AuthTime != nil {
+		sub.AuthTime = claims.AuthTime.Time
+	}
+	pair, err := h.tm.GeneratePair(sub)
 	if err != nil {
 		return errors.InternalErr(err, "failed to generate access token")
 	}
 
-	JSON(c, http.StatusOK, &RefreshTokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+	err = h.apis.RotateRefreshToken(c.Request.Context(), claims.ID, refreshTokenRecord(pair), clientDevice(c))
+	if err != nil {
+		return err
+	}
+
+	resp := &RefreshTokenResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
 		ExpiresIn:    int64(h.tm.GetAccessExpiry().Seconds()),
-	}, nil)
+	}
+
+	if useCookies {
+		resp.CSRFToken, err = h.setSessionCookies(c, pair.AccessToken, pair.RefreshToken)
+		if err != nil {
+			return err
+		}
+		resp.AccessToken, resp.RefreshToken = "", ""
+	}
+
+	JSON(c, http.StatusOK, resp, nil)
+
+	return nil
+}
+
+// logout godoc
+//
+//	@Summary		Logout
+//	@Description	Revoke the access token used for the request, along with the refresh tokens issued since the same login
+//	@Tags			Auth
+//	@Produce		json
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/auth/logout [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) Logout(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	err := h.apis.RevokeSession(
+		c.Request.Context(),
+		userID,
+		GetTokenID(c),
+		c.GetString("tokenFamilyID"),
+		c.GetTime("tokenExpiresAt"),
+	)
+	if err != nil {
+		return err
+	}
+
+	if usesCookieSession(c) {
+		h.clearSessionCookies(c)
+	}
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// logoutAll godoc
+//
+//	@Summary		Logout Everywhere
+//	@Description	Revoke every access and refresh token issued to the authenticated user so far
+//	@Tags			Auth
+//	@Produce		json
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/auth/logout-all [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) LogoutAll(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	// refresh tokens are revoked in the store itself, so only access tokens are to be revoked
+	// until they expire
+	err := h.apis.RevokeAllTokens(c.Request.Context(), userID, time.Now().Add(h.tm.GetAccessExpiry()))
+	if err != nil {
+		return err
+	}
+
+	if usesCookieSession(c) {
+		h.clearSessionCookies(c)
+	}
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// forgotPassword godoc
+//
+//	@Summary		Forgot Password
+//	@Description	Send a password reset token to the email, if it belongs to a registered user. Only one token is sent
+//	@Description	every couple of minutes, the response is the same either way
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ForgotPasswordRequest	true	"Forgot Password Payload"
+//	@Success		202		{object}	BaseResponse{data=string}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/auth/password/forgot [post]
+func (h *Handlers) ForgotPassword(c *gin.Context) error {
+	req := &ForgotPasswordRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	err := h.apis.ForgotPassword(c.Request.Context(), req.Email)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusAccepted, "if the email is registered, a password reset token has been sent", nil)
+
+	return nil
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// resetPassword godoc
+//
+//	@Summary		Reset Password
+//	@Description	Set a new password using a password reset token. All existing sessions are invalidated
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	ResetPasswordRequest	true	"Reset Password Payload"
+//	@Success		204
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		422	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/auth/password/reset [post]
+func (h *Handlers) ResetPassword(c *gin.Context) error {
+	req := &ResetPasswordRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	// refresh tokens are revoked in the store itself, so only access tokens are to be revoked
+	// until they expire
+	err := h.apis.ResetPassword(c.Request.Context(), req.Token, req.Password, time.Now().Add(h.tm.GetAccessExpiry()))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// issueEmailVerification godoc
+//
+//	@Summary		Issue Email Verification
+//	@Description	Send a new email verification token to the authenticated user. Only one token is sent every couple of
+//	@Description	minutes, 429 is returned along with the Retry-After header otherwise
+//	@Tags			Auth
+//	@Produce		json
+//	@Success		202	{object}	BaseResponse{data=string}
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		409	{object}	ErrorResponse
+//	@Failure		429	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/auth/email/verification [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) IssueEmailVerification(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	err := h.apis.IssueEmailVerification(c.Request.Context(), userID)
+	if err != nil {
+		throttled := &users.VerificationThrottledError{}
+		if errors.As(err, &throttled) {
+			retryAfter := int64(math.Ceil(throttled.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+			Error(c, http.StatusTooManyRequests, throttled)
+			return nil
+		}
+		return err
+	}
+
+	JSON(c, http.StatusAccepted, "email verification token has been sent", nil)
+
+	return nil
+}
+
+type ResendEmailVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// resendEmailVerification godoc
+//
+//	@Summary		Resend Email Verification
+//	@Description	Send a new email verification token to the email, if it belongs to an unverified user
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResendEmailVerificationRequest	true	"Resend Email Verification Payload"
+//	@Success		202		{object}	BaseResponse{data=string}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/auth/email/resend [post]
+func (h *Handlers) ResendEmailVerification(c *gin.Context) error {
+	req := &ResendEmailVerificationRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	err := h.apis.ResendEmailVerification(c.Request.Context(), req.Email)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusAccepted, "if the email is registered and not verified, a verification token has been sent", nil)
+
+	return nil
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// verifyEmail godoc
+//
+//	@Summary		Verify Email
+//	@Description	Verify the email address of a user using the verification token
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	VerifyEmailRequest	true	"Verify Email Payload"
+//	@Success		204
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		422	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/auth/email/verify [post]
+func (h *Handlers) VerifyEmail(c *gin.Context) error {
+	req := &VerifyEmailRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	err := h.apis.VerifyEmail(c.Request.Context(), req.Token)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
 
 	return nil
+}
+
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	// Code is either a TOTP code or one of the recovery codes
+	Code string `json:"code" binding:"required"`
+	// UseCookies sets the tokens as HttpOnly cookies instead of returning them, for browser clients
+	UseCookies bool `json:"useCookies"`
+}
 
+// verifyMFA godoc
+//
+//	@Summary		Verify Second Factor
+//	@Description	Complete login by exchanging the MFA token and a TOTP or recovery code for a token pair
+//	@Tags			Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		VerifyMFARequest	true	"Verify MFA Payload"
+//	@Success		200		{object}	BaseResponse{data=LoginResponse}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		423		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/auth/mfa/verify [post]
+func (h *Handlers) VerifyMFA(c *gin.Context) error {
+	req := &VerifyMFARequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	claims, err := h.tm.Validate(req.MFAToken)
+	if err != nil {
+		return err
+	}
+
+	if claims.TokenType != "mfa_pending" {
+		return errors.Unauthorized("invalid token type")
+	}
+
+	user, err := h.apis.VerifyMFA(c.Request.Context(), claims.UserID, req.Code)
+	if err != nil {
+		throttled := &users.LoginThrottledError{}
+		if errors.As(err, &throttled) {
+			respondLoginThrottled(c, throttled)
+			return nil
+		}
+		return err
+	}
+
+	return h.respondLogin(c, user, claims.IssuedFor(), req.UseCookies)
+}
+
+// jwks godoc
+//
+//	@Summary		JSON Web Key Set
+//	@Description	Public keys to verify the tokens issued by the app with, identified by the `kid` header of the tokens.
+//	@Description	The response is a plain JWK Set (RFC 7517), not wrapped in the usual response body
+//	@Tags			Auth
+//	@Produce		json
+//	@Success		200	{object}	jwt.JWKS
+//	@Router			/.well-known/jwks.json [get]
+func (h *Handlers) JWKS(c *gin.Context) error {
+	// downstream services are expected to refetch the keys when they see an unknown kid
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.tm.JWKS())
+
+	return nil
 }
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/naughtygopher/errors"
+)
+
+// oidcLogin godoc
+//
+//	@Summary		Login with an Identity Provider
+//	@Description	Start a login with an external OpenID Connect provider, by redirecting to the provider. The provider
+//	@Description	redirects back to the callback once the user has logged in there. The login can only be completed in
+//	@Description	the same browser, the state of the login is set in an HttpOnly cookie
+//	@Tags			Auth
+//	@Param			provider	path	string	true	"Provider name"
+//	@Param			audience	query	string	false	"Audience of the tokens issued once logged in"
+//	@Param			useCookies	query	bool	false	"Set the tokens as HttpOnly cookies once logged in"
+//	@Success		302
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		422	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/auth/oidc/{provider}/login [get]
+func (h *Handlers) OIDCLogin(c *gin.Context) error {
+	audience, err := h.tm.ResolveAudience(c.Query("audience"))
+	if err != nil {
+		return err
+	}
+
+	useCookies, _ := strconv.ParseBool(c.Query("useCookies"))
+
+	redirect, err := h.apis.BeginSSOLogin(c.Request.Context(), c.Param("provider"), audience, useCookies)
+	if err != nil {
+		return err
+	}
+
+	h.setOIDCStateCookie(c, redirect.State, time.Until(redirect.ExpiresAt))
+	c.Redirect(http.StatusFound, redirect.URL)
+
+	return nil
+}
+
+// oidcCallback godoc
+//
+//	@Summary		Identity Provider Callback
+//	@Description	Complete a login with an external OpenID Connect provider. The external identity is linked to the user
+//	@Description	with the same (verified) email address, or to a new user. The response is the same as of the login
+//	@Description	The state must be of the login started in the same browser, i.e. match the state cookie
+//	@Tags			Auth
+//	@Produce		json
+//	@Param			provider	path		string	true	"Provider name"
+//	@Param			code		query		string	true	"Authorization code"
+//	@Param			state		query		string	true	"State"
+//	@Success		200			{object}	BaseResponse{data=LoginResponse}
+//	@Success		200			{object}	BaseResponse{data=MFARequiredResponse}
+//	@Failure		401			{object}	ErrorResponse
+//	@Failure		403			{object}	ErrorResponse
+//	@Failure		404			{object}	ErrorResponse
+//	@Failure		422			{object}	ErrorResponse
+//	@Failure		500			{object}	ErrorResponse
+//	@Router			/auth/oidc/{provider}/callback [get]
+func (h *Handlers) OIDCCallback(c *gin.Context) error {
+	// the state can be used only once, whether or not the login succeeds
+	err := checkOIDCState(c, c.Query("state"))
+	h.setOIDCStateCookie(c, "", -1)
+	if err != nil {
+		return err
+	}
+
+	if idpErr := c.Query("error"); idpErr != "" {
+		return errors.Unauthenticatedf("login at the identity provider failed: %s", idpErr)
+	}
+
+	user, login, err := h.apis.CompleteSSOLogin(
+		c.Request.Context(),
+		c.Param("provider"),
+		c.Query("state"),
+		c.Query("code"),
+	)
+	if err != nil {
+		return err
+	}
+
+	return h.respondAuthenticated(c, user, login.Audience, login.UseCookies)
+}
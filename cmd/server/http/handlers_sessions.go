@@ -0,0 +1,88 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/tokens"
+)
+
+// SessionResponse is a session, marked as current if it's the one the request is made from
+type SessionResponse struct {
+	tokens.Session
+	Current bool `json:"current"`
+}
+
+// listSessions godoc
+//
+//	@Summary		List Sessions
+//	@Description	List the devices the authenticated user is logged in on, most recently seen first. A session is seen
+//	@Description	whenever its tokens are refreshed
+//	@Tags			Users
+//	@Produce		json
+//	@Success		200	{object}	BaseResponse{data=[]SessionResponse}
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/users/me/sessions [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListSessions(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	sessions, err := h.apis.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	current := c.GetString("tokenFamilyID")
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, SessionResponse{
+			Session: session,
+			Current: session.ID == current,
+		})
+	}
+
+	JSON(c, http.StatusOK, resp, nil)
+
+	return nil
+}
+
+// endSession godoc
+//
+//	@Summary		Sign Out Session
+//	@Description	Sign out a device of the authenticated user, revoking the access and refresh tokens of the session
+//	@Tags			Users
+//	@Produce		json
+//	@Param			sessionID	path	string	true	"Session ID"
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/users/me/sessions/{sessionID} [delete]
+//	@Security		ApiKeyAuth
+func (h *Handlers) EndSession(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	sessionID := c.Param("sessionID")
+	err := h.apis.EndSession(c.Request.Context(), userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if sessionID == c.GetString("tokenFamilyID") && usesCookieSession(c) {
+		h.clearSessionCookies(c)
+	}
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
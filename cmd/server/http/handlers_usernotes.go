@@ -1,17 +1,24 @@
 package http
 
 import (
+	"bytes"
+	"context"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/baobei23/goapp/internal/usernotes"
+	"github.com/baobei23/goapp/internal/users"
 	"github.com/naughtygopher/errors"
 )
 
 type RegisterNoteRequest struct {
-	Title   string `json:"title" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	Title   string   `json:"title" binding:"required"`
+	Content string   `json:"content" binding:"required"`
+	Tags    []string `json:"tags"`
 }
 
 // createNote godoc
@@ -42,6 +49,7 @@ func (h *Handlers) RegisterNote(c *gin.Context) error {
 	unote := &usernotes.Note{
 		Title:   req.Title,
 		Content: req.Content,
+		Tags:    req.Tags,
 		UserID:  userID,
 	}
 
@@ -50,6 +58,7 @@ func (h *Handlers) RegisterNote(c *gin.Context) error {
 		return err
 	}
 
+	c.Header("ETag", noteETag(un.Version))
 	JSON(c, http.StatusCreated, un, nil)
 
 	return nil
@@ -58,14 +67,17 @@ func (h *Handlers) RegisterNote(c *gin.Context) error {
 // readUserNote godoc
 //
 //	@Summary		Read User Note
-//	@Description	Read a user note
+//	@Description	Read a user note, owned by or shared with the user. The role of the user on the note is either owner,
+//	@Description	editor or viewer
 //	@Tags			Notes
 //	@Accept			json
 //	@Produce		json
 //	@Param			noteID	path		string	true	"Note ID"
 //	@Success		200		{object}	BaseResponse{data=usernotes.Note}
+//	@Header			200		{string}	ETag	"Version of the note"
 //	@Failure		400		{object}	ErrorResponse
 //	@Failure		401		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
 //	@Failure		500		{object}	ErrorResponse
 //	@Router			/usernotes/{noteID} [get]
 //	@Security		ApiKeyAuth
@@ -85,7 +97,872 @@ func (h *Handlers) ReadUserNote(c *gin.Context) error {
 		return err
 	}
 
+	c.Header("ETag", noteETag(un.Version))
 	JSON(c, http.StatusOK, un, nil)
 
 	return nil
 }
+
+// ReplaceNoteRequest has the whole note, replacing the current one. Omitting the tags removes them
+type ReplaceNoteRequest struct {
+	Title   string   `json:"title" binding:"required"`
+	Content string   `json:"content" binding:"required"`
+	Tags    []string `json:"tags"`
+}
+
+// PatchNoteRequest has the fields of the note to be updated, omitted fields are left as they are
+type PatchNoteRequest struct {
+	Title   *string  `json:"title"`
+	Content *string  `json:"content"`
+	Tags    []string `json:"tags"`
+}
+
+// replaceUserNote godoc
+//
+//	@Summary		Replace User Note
+//	@Description	Update the title and content of a user note, owned by or shared with the user as an editor. The note
+//	@Description	is only updated if its ETag still matches the If-Match header, otherwise 412 is returned along with the
+//	@Description	current ETag. Without the If-Match header 428 is returned, `*` updates the note whatever its version
+//	@Tags			Notes
+//	@Accept			json
+//	@Produce		json
+//	@Param			noteID		path		string				true	"Note ID"
+//	@Param			If-Match	header		string				true	"ETag of the note being updated"
+//	@Param			payload		body		ReplaceNoteRequest	true	"Note Payload"
+//	@Success		200			{object}	BaseResponse{data=usernotes.Note}
+//	@Header			200			{string}	ETag	"Version of the updated note"
+//	@Failure		400			{object}	ErrorResponse
+//	@Failure		401			{object}	ErrorResponse
+//	@Failure		403			{object}	ErrorResponse
+//	@Failure		404			{object}	ErrorResponse
+//	@Failure		412			{object}	ErrorResponse
+//	@Failure		422			{object}	ErrorResponse
+//	@Failure		428			{object}	ErrorResponse
+//	@Failure		500			{object}	ErrorResponse
+//	@Router			/usernotes/{noteID} [put]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ReplaceUserNote(c *gin.Context) error {
+	req := &ReplaceNoteRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	tags := req.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	update := &usernotes.NoteUpdate{
+		Title:   &req.Title,
+		Content: &req.Content,
+		Tags:    tags,
+	}
+
+	return h.updateUserNote(c, func(ctx context.Context, userID, noteID string, version int) (*usernotes.Note, error) {
+		return h.apis.UpdateUserNote(ctx, userID, noteID, update, version)
+	})
+}
+
+// patchUserNote godoc
+//
+//	@Summary		Patch User Note
+//	@Description	Update some of the fields of a user note, owned by or shared with the user as an editor. The note is
+//	@Description	only updated if its ETag still matches the If-Match header, otherwise 412 is returned along with the
+//	@Description	current ETag. Without the If-Match header 428 is returned, `*` updates the note whatever its version
+//	@Tags			Notes
+//	@Accept			json
+//	@Produce		json
+//	@Param			noteID		path		string				true	"Note ID"
+//	@Param			If-Match	header		string				true	"ETag of the note being updated"
+//	@Param			payload		body		PatchNoteRequest	true	"Note Payload"
+//	@Success		200			{object}	BaseResponse{data=usernotes.Note}
+//	@Header			200			{string}	ETag	"Version of the updated note"
+//	@Failure		400			{object}	ErrorResponse
+//	@Failure		401			{object}	ErrorResponse
+//	@Failure		403			{object}	ErrorResponse
+//	@Failure		404			{object}	ErrorResponse
+//	@Failure		412			{object}	ErrorResponse
+//	@Failure		422			{object}	ErrorResponse
+//	@Failure		428			{object}	ErrorResponse
+//	@Failure		500			{object}	ErrorResponse
+//	@Router			/usernotes/{noteID} [patch]
+//	@Security		ApiKeyAuth
+func (h *Handlers) PatchUserNote(c *gin.Context) error {
+	req := &PatchNoteRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	update := &usernotes.NoteUpdate{
+		Title:   req.Title,
+		Content: req.Content,
+		Tags:    req.Tags,
+	}
+
+	return h.updateUserNote(c, func(ctx context.Context, userID, noteID string, version int) (*usernotes.Note, error) {
+		return h.apis.UpdateUserNote(ctx, userID, noteID, update, version)
+	})
+}
+
+// noteUpdater updates the note, provided it's still at the version (unless it's 0)
+type noteUpdater func(ctx context.Context, userID, noteID string, version int) (*usernotes.Note, error)
+
+// updateUserNote updates the note of the request with the If-Match header as its version, and
+// responds with the updated note or 412 if the header doesn't match. The client has to be aware
+// of the version it's overwriting, hence 428 is returned without the header.
+func (h *Handlers) updateUserNote(c *gin.Context, update noteUpdater) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		Error(c, http.StatusPreconditionRequired, errors.New("If-Match is required, with the ETag of the note being updated"))
+		return nil
+	}
+
+	version := 0
+	if ifMatch != "*" {
+		var ok bool
+		version, ok = parseNoteETag(ifMatch)
+		if !ok {
+			Error(c, http.StatusPreconditionFailed, errors.New("If-Match does not match the note"))
+			return nil
+		}
+	}
+
+	un, err := update(c.Request.Context(), userID, c.Param("noteID"), version)
+	if err != nil {
+		mismatch := &usernotes.VersionMismatchError{}
+		if errors.As(err, &mismatch) {
+			if mismatch.Current != 0 {
+				c.Header("ETag", noteETag(mismatch.Current))
+			}
+			Error(c, http.StatusPreconditionFailed, mismatch)
+			return nil
+		}
+		return err
+	}
+
+	c.Header("ETag", noteETag(un.Version))
+	JSON(c, http.StatusOK, un, nil)
+
+	return nil
+}
+
+// noteETag returns the (strong) entity tag of the version of a note
+func noteETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// parseNoteETag returns the version of a note from its entity tag. Weak tags are not accepted,
+// since If-Match uses the strong comparison
+func parseNoteETag(etag string) (int, bool) {
+	etag = strings.TrimSpace(etag)
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(etag[1 : len(etag)-1])
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// trashUserNote godoc
+//
+//	@Summary		Delete User Note
+//	@Description	Move a user note to the trash. It can be restored until it's deleted permanently, once it's been in the
+//	@Description	trash for the retention period. Only the owner of the note can delete it
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			noteID	path	string	true	"Note ID"
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/usernotes/{noteID} [delete]
+//	@Security		ApiKeyAuth
+func (h *Handlers) TrashUserNote(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	err := h.apis.TrashUserNote(c.Request.Context(), userID, c.Param("noteID"))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// restoreUserNote godoc
+//
+//	@Summary		Restore User Note
+//	@Description	Move a user note out of the trash
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			noteID	path		string	true	"Note ID"
+//	@Success		200		{object}	BaseResponse{data=usernotes.Note}
+//	@Header			200		{string}	ETag	"Version of the note"
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/usernotes/{noteID}/restore [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) RestoreUserNote(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	un, err := h.apis.RestoreUserNote(c.Request.Context(), userID, c.Param("noteID"))
+	if err != nil {
+		return err
+	}
+
+	c.Header("ETag", noteETag(un.Version))
+	JSON(c, http.StatusOK, un, nil)
+
+	return nil
+}
+
+// listUserNoteRevisions godoc
+//
+//	@Summary		List User Note Revisions
+//	@Description	List the revisions of a user note, newest first. A revision is saved on every change of the note, and
+//	@Description	its version is that of the note after the change
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			noteID	path		string	true	"Note ID"
+//	@Success		200		{object}	BaseResponse{data=[]usernotes.Revision}
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/usernotes/{noteID}/revisions [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListUserNoteRevisions(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	revisions, err := h.apis.ListUserNoteRevisions(c.Request.Context(), userID, c.Param("noteID"))
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, revisions, nil)
+
+	return nil
+}
+
+// diffUserNoteRevisions godoc
+//
+//	@Summary		Diff User Note Revisions
+//	@Description	Line diff of the title and content of a user note, from one revision to another
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			noteID	path		string	true	"Note ID"
+//	@Param			from	query		int		true	"Version of the revision to diff from"
+//	@Param			to		query		int		false	"Version of the revision to diff to, the current version by default"
+//	@Success		200		{object}	BaseResponse{data=usernotes.RevisionDiff}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/usernotes/{noteID}/revisions/diff [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) DiffUserNoteRevisions(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		return errors.InputBodyErr(err, "from must be the version of a revision")
+	}
+
+	to := 0
+	if value := c.Query("to"); value != "" {
+		to, err = strconv.Atoi(value)
+		if err != nil {
+			return errors.InputBodyErr(err, "to must be the version of a revision")
+		}
+	}
+
+	diff, err := h.apis.DiffUserNoteRevisions(c.Request.Context(), userID, c.Param("noteID"), from, to)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, diff, nil)
+
+	return nil
+}
+
+// restoreUserNoteRevision godoc
+//
+//	@Summary		Restore User Note Revision
+//	@Description	Update a user note back to how it was at one of its revisions, which saves a new revision. The note is
+//	@Description	only updated if its ETag still matches the If-Match header, otherwise 412 is returned along with the
+//	@Description	current ETag. Without the If-Match header 428 is returned, `*` updates the note whatever its version
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			noteID		path		string	true	"Note ID"
+//	@Param			revision	path		int		true	"Version of the revision"
+//	@Param			If-Match	header		string	true	"ETag of the note being updated"
+//	@Success		200			{object}	BaseResponse{data=usernotes.Note}
+//	@Header			200			{string}	ETag	"Version of the updated note"
+//	@Failure		400			{object}	ErrorResponse
+//	@Failure		401			{object}	ErrorResponse
+//	@Failure		403			{object}	ErrorResponse
+//	@Failure		404			{object}	ErrorResponse
+//	@Failure		412			{object}	ErrorResponse
+//	@Failure		428			{object}	ErrorResponse
+//	@Failure		500			{object}	ErrorResponse
+//	@Router			/usernotes/{noteID}/revisions/{revision}/restore [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) RestoreUserNoteRevision(c *gin.Context) error {
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		return errors.InputBodyErr(err, "revision must be the version of a revision")
+	}
+
+	return h.updateUserNote(c, func(ctx context.Context, userID, noteID string, version int) (*usernotes.Note, error) {
+		return h.apis.RestoreUserNoteRevision(ctx, userID, noteID, revision, version)
+	})
+}
+
+// listUserNotes godoc
+//
+//	@Summary		List User Notes
+//	@Description	List the notes of the authenticated user page by page. The cursors to the next and previous pages are
+//	@Description	returned in the meta, and are passed as is (along with the same filters) to list those pages
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			limit		query		int		false	"Page size"
+//	@Param			sort		query		string	false	"Sort by"	Enums(created, updated, title)
+//	@Param			order		query		string	false	"Order"		Enums(asc, desc)
+//	@Param			from		query		string	false	"Created at or after, RFC 3339 time or date"
+//	@Param			to			query		string	false	"Created before, RFC 3339 time or date (inclusive)"
+//	@Param			cursor		query		string	false	"Cursor of the page"
+//	@Param			tags		query		string	false	"Comma separated tags the notes have"
+//	@Param			tagMatch	query		string	false	"Whether the notes have all or any of the tags"	Enums(all, any)
+//	@Success		200			{object}	BaseResponse{data=[]usernotes.Note,meta=PageMeta}
+//	@Failure		400			{object}	ErrorResponse
+//	@Failure		401			{object}	ErrorResponse
+//	@Failure		422			{object}	ErrorResponse
+//	@Failure		500			{object}	ErrorResponse
+//	@Router			/usernotes [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListUserNotes(c *gin.Context) error {
+	return h.listUserNotes(c, &usernotes.ListFilter{})
+}
+
+// listTrashedNotes godoc
+//
+//	@Summary		List Trashed User Notes
+//	@Description	List the notes of the authenticated user which are in the trash, page by page like the other notes.
+//	@Description	Trashed notes are deleted permanently once they've been in the trash for the retention period
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			limit		query		int		false	"Page size"
+//	@Param			sort		query		string	false	"Sort by"	Enums(created, updated, title)
+//	@Param			order		query		string	false	"Order"		Enums(asc, desc)
+//	@Param			from		query		string	false	"Created at or after, RFC 3339 time or date"
+//	@Param			to			query		string	false	"Created before, RFC 3339 time or date (inclusive)"
+//	@Param			cursor		query		string	false	"Cursor of the page"
+//	@Param			tags		query		string	false	"Comma separated tags the notes have"
+//	@Param			tagMatch	query		string	false	"Whether the notes have all or any of the tags"	Enums(all, any)
+//	@Success		200			{object}	BaseResponse{data=[]usernotes.Note,meta=PageMeta}
+//	@Failure		400			{object}	ErrorResponse
+//	@Failure		401			{object}	ErrorResponse
+//	@Failure		422			{object}	ErrorResponse
+//	@Failure		500			{object}	ErrorResponse
+//	@Router			/usernotes/trash [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListTrashedNotes(c *gin.Context) error {
+	return h.listUserNotes(c, &usernotes.ListFilter{Trashed: true})
+}
+
+// listSharedNotes godoc
+//
+//	@Summary		List Shared User Notes
+//	@Description	List the notes other users have shared with the authenticated user, page by page like their own notes. The
+//	@Description	role of the user on each note is either editor or viewer
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			limit		query		int		false	"Page size"
+//	@Param			sort		query		string	false	"Sort by"	Enums(created, updated, title)
+//	@Param			order		query		string	false	"Order"		Enums(asc, desc)
+//	@Param			from		query		string	false	"Created at or after, RFC 3339 time or date"
+//	@Param			to			query		string	false	"Created before, RFC 3339 time or date (inclusive)"
+//	@Param			cursor		query		string	false	"Cursor of the page"
+//	@Param			tags		query		string	false	"Comma separated tags the notes have"
+//	@Param			tagMatch	query		string	false	"Whether the notes have all or any of the tags"	Enums(all, any)
+//	@Success		200			{object}	BaseResponse{data=[]usernotes.Note,meta=PageMeta}
+//	@Failure		400			{object}	ErrorResponse
+//	@Failure		401			{object}	ErrorResponse
+//	@Failure		422			{object}	ErrorResponse
+//	@Failure		500			{object}	ErrorResponse
+//	@Router			/usernotes/shared [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListSharedNotes(c *gin.Context) error {
+	return h.listUserNotes(c, &usernotes.ListFilter{Shared: true})
+}
+
+// listUserNotes lists a page of notes with the filter, along with the ones of the request query
+func (h *Handlers) listUserNotes(c *gin.Context, filter *usernotes.ListFilter) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	filter.UserID = userID
+	filter.Sort = c.Query("sort")
+	filter.Order = c.Query("order")
+	filter.Cursor = c.Query("cursor")
+	filter.Tags = strings.Split(c.Query("tags"), ",")
+	filter.TagMatch = c.Query("tagMatch")
+
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return errors.InputBodyErr(err, "limit must be a number")
+		}
+	}
+
+	var err error
+	filter.From, err = parseTimeQuery(c, "from", false)
+	if err != nil {
+		return err
+	}
+
+	filter.To, err = parseTimeQuery(c, "to", true)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.apis.ListUserNotes(c.Request.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, page.Notes, PageMeta{Next: page.Next, Prev: page.Prev})
+
+	return nil
+}
+
+// listUserNoteTags godoc
+//
+//	@Summary		List User Note Tags
+//	@Description	List the tags of the authenticated user's notes along with the number of notes having each of them, most
+//	@Description	used first. Notes in the trash are not counted
+//	@Tags			Notes
+//	@Produce		json
+//	@Success		200	{object}	BaseResponse{data=[]usernotes.TagCount}
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/usernotes/tags [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListUserNoteTags(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	tags, err := h.apis.ListUserNoteTags(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, tags, nil)
+
+	return nil
+}
+
+// searchUserNotes godoc
+//
+//	@Summary		Search User Notes
+//	@Description	Search the notes of the authenticated user by their title and content, most relevant first. All the
+//	@Description	words of the query have to match, words in double quotes have to match as a phrase and a word ending
+//	@Description	with * matches as a prefix. The highlighted title and snippet are HTML escaped, with the matching words
+//	@Description	wrapped in <mark>
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			q		query		string	true	"Search query"
+//	@Param			limit	query		int		false	"Maximum number of results"
+//	@Success		200		{object}	BaseResponse{data=[]usernotes.SearchResult}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		422		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/usernotes/search [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) SearchUserNotes(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			return errors.InputBodyErr(err, "limit must be a number")
+		}
+	}
+
+	results, err := h.apis.SearchUserNotes(c.Request.Context(), userID, c.Query("q"), limit)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, results, nil)
+
+	return nil
+}
+
+// parseTimeQuery parses the query param as an RFC 3339 time or a date. If endOfDay is true, a date
+// is taken as the start of the next day, i.e. it's included in a range ending at the time returned
+func parseTimeQuery(c *gin.Context, name string, endOfDay bool) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.InputBodyErrf(err, "%s must be an RFC 3339 time or a date", name)
+	}
+
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+// ShareNoteRequest has the user to share a note with, and their role
+type ShareNoteRequest struct {
+	Email string `json:"email" binding:"required"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// shareUserNote godoc
+//
+//	@Summary		Share User Note
+//	@Description	Share a note of the authenticated user with another user, as an editor or a viewer. Editors can read and
+//	@Description	update the note, viewers can only read it. Sharing the note again with the same user changes their role.
+//	@Description	The response is the same whether or not there is a user with the email, nothing is shared if there is none
+//	@Tags			Notes
+//	@Accept			json
+//	@Produce		json
+//	@Param			noteID	path	string				true	"Note ID"
+//	@Param			payload	body	ShareNoteRequest	true	"Share Payload"
+//	@Success		204
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		422	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/usernotes/{noteID}/shares [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ShareUserNote(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	req := &ShareNoteRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	err := h.apis.ShareUserNote(c.Request.Context(), userID, c.Param("noteID"), req.Email, req.Role)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// listUserNoteShares godoc
+//
+//	@Summary		List User Note Shares
+//	@Description	List the users a note of the authenticated user is shared with, in the order it was shared
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			noteID	path		string	true	"Note ID"
+//	@Success		200		{object}	BaseResponse{data=[]usernotes.Share}
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/usernotes/{noteID}/shares [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListUserNoteShares(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	shares, err := h.apis.ListUserNoteShares(c.Request.Context(), userID, c.Param("noteID"))
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, shares, nil)
+
+	return nil
+}
+
+// revokeUserNoteShare godoc
+//
+//	@Summary		Revoke User Note Share
+//	@Description	Stop sharing a note with a user. The owner of the note can revoke any of its shares, the users it's
+//	@Description	shared with can only revoke their own
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			noteID	path	string	true	"Note ID"
+//	@Param			userID	path	string	true	"ID of the user the note is shared with"
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/usernotes/{noteID}/shares/{userID} [delete]
+//	@Security		ApiKeyAuth
+func (h *Handlers) RevokeUserNoteShare(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	err := h.apis.RevokeUserNoteShare(c.Request.Context(), userID, c.Param("noteID"), c.Param("userID"))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// CreateLinkRequest has the options of a public link to a note
+type CreateLinkRequest struct {
+	// ExpiresAt is when the link expires, it never does if omitted
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// Password is required to view the note with the link, unless it's empty
+	Password string `json:"password"`
+}
+
+// createUserNoteLink godoc
+//
+//	@Summary		Create User Note Link
+//	@Description	Create a public link to a note of the authenticated user, which anyone can view the note with at
+//	@Description	/s/{token}. The link can expire and be protected by a password. The token is only returned once,
+//	@Description	and cannot be retrieved afterwards
+//	@Tags			Notes
+//	@Accept			json
+//	@Produce		json
+//	@Param			noteID	path		string				true	"Note ID"
+//	@Param			payload	body		CreateLinkRequest	true	"Link Payload"
+//	@Success		201		{object}	BaseResponse{data=usernotes.Link}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		422		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/usernotes/{noteID}/links [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) CreateUserNoteLink(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	req := &CreateLinkRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	link, err := h.apis.CreateUserNoteLink(c.Request.Context(), userID, c.Param("noteID"), req.ExpiresAt, req.Password)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusCreated, link, nil)
+
+	return nil
+}
+
+// listUserNoteLinks godoc
+//
+//	@Summary		List User Note Links
+//	@Description	List the public links the authenticated user has created to their notes which are not revoked, newest
+//	@Description	first. Expired links are listed until they're revoked
+//	@Tags			Notes
+//	@Produce		json
+//	@Success		200	{object}	BaseResponse{data=[]usernotes.Link}
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/usernotes/links [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ListUserNoteLinks(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	links, err := h.apis.ListUserNoteLinks(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, links, nil)
+
+	return nil
+}
+
+// revokeUserNoteLink godoc
+//
+//	@Summary		Revoke User Note Link
+//	@Description	Revoke a public link to a note of the authenticated user, the note cannot be viewed with it anymore
+//	@Tags			Notes
+//	@Produce		json
+//	@Param			linkID	path	string	true	"Link ID"
+//	@Success		204
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/usernotes/links/{linkID} [delete]
+//	@Security		ApiKeyAuth
+func (h *Handlers) RevokeUserNoteLink(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	err := h.apis.RevokeUserNoteLink(c.Request.Context(), userID, c.Param("linkID"))
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// SharedNoteResponse is a note viewed with a public link to it
+type SharedNoteResponse struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Views is the number of times the note has been viewed with the link, including this one
+	Views int64 `json:"views"`
+}
+
+// viewSharedNote godoc
+//
+//	@Summary		View Shared Note
+//	@Description	View a note with a public link to it, as HTML or as JSON depending on the Accept header. The password of a
+//	@Description	protected link is sent in the X-Share-Password header, or posted by the HTML form asking for it.
+//	@Description	Every view is counted. Failed password attempts are throttled per link and per client IP, like logins
+//	@Tags			Notes
+//	@Produce		json,html
+//	@Param			token				path		string	true	"Link token"
+//	@Param			X-Share-Password	header		string	false	"Password of the link"
+//	@Success		200					{object}	BaseResponse{data=SharedNoteResponse}
+//	@Failure		401					{object}	ErrorResponse
+//	@Failure		404					{object}	ErrorResponse
+//	@Failure		423					{object}	ErrorResponse
+//	@Failure		429					{object}	ErrorResponse
+//	@Failure		500					{object}	ErrorResponse
+//	@Router			/s/{token} [get]
+func (h *Handlers) ViewSharedNote(c *gin.Context) error {
+	password := c.GetHeader("X-Share-Password")
+	if password == "" {
+		password = c.PostForm("password")
+	}
+
+	// the token is in the URL, hence must not leak to the links of the note
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Cache-Control", "no-store")
+
+	asHTML := c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEHTML
+	note, link, err := h.apis.ViewSharedNote(c.Request.Context(), c.Param("token"), password, c.ClientIP())
+	if err != nil {
+		throttled := &users.LoginThrottledError{}
+		if errors.As(err, &throttled) {
+			respondLoginThrottled(c, throttled)
+			return nil
+		}
+
+		invalidPassword := errors.Is(err, usernotes.ErrInvalidLinkPassword)
+		if asHTML && (invalidPassword || errors.Is(err, usernotes.ErrLinkPasswordRequired)) {
+			return h.renderSharedNote(c, http.StatusUnauthorized, nil, invalidPassword)
+		}
+		return err
+	}
+
+	resp := &SharedNoteResponse{
+		Title:     note.Title,
+		Content:   note.Content,
+		Tags:      note.Tags,
+		UpdatedAt: note.UpdatedAt,
+		Views:     link.Views,
+	}
+
+	if asHTML {
+		return h.renderSharedNote(c, http.StatusOK, resp, false)
+	}
+
+	JSON(c, http.StatusOK, resp, nil)
+
+	return nil
+}
+
+// renderSharedNote renders the note as HTML, or the form asking for the password if the note is nil
+func (h *Handlers) renderSharedNote(c *gin.Context, status int, note *SharedNoteResponse, invalidPassword bool) error {
+	buff := bytes.NewBufferString("")
+	err := h.sharedNote.Execute(
+		buff,
+		struct {
+			Note            *SharedNoteResponse
+			InvalidPassword bool
+		}{
+			Note:            note,
+			InvalidPassword: invalidPassword,
+		},
+	)
+	if err != nil {
+		return errors.InternalErr(err, "failed rendering shared note")
+	}
+
+	c.Header("Content-Type", "text/html; charset=UTF-8")
+	c.String(status, buff.String())
+
+	return nil
+}
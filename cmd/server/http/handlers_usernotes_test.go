@@ -0,0 +1,76 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/baobei23/goapp/internal/usernotes"
+)
+
+func TestHandlers_updateUserNote(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		ifMatch    string
+		wantStatus int
+		// wantVersion is the version the note is updated at, -1 if it's not to be updated
+		wantVersion int
+	}{
+		{
+			name:        "matching version",
+			ifMatch:     `"3"`,
+			wantStatus:  http.StatusOK,
+			wantVersion: 3,
+		},
+		{
+			name:        "any version",
+			ifMatch:     "*",
+			wantStatus:  http.StatusOK,
+			wantVersion: 0,
+		},
+		{
+			name:        "missing If-Match",
+			wantStatus:  http.StatusPreconditionRequired,
+			wantVersion: -1,
+		},
+		{
+			name:        "weak ETag",
+			ifMatch:     `W/"3"`,
+			wantStatus:  http.StatusPreconditionFailed,
+			wantVersion: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodPut, "/usernotes/note", nil)
+			if tt.ifMatch != "" {
+				c.Request.Header.Set("If-Match", tt.ifMatch)
+			}
+			c.Set("userID", "user")
+
+			gotVersion := -1
+			h := &Handlers{}
+			err := h.updateUserNote(c, func(ctx context.Context, userID, noteID string, version int) (*usernotes.Note, error) {
+				gotVersion = version
+				return &usernotes.Note{Version: 4}, nil
+			})
+			if err != nil {
+				t.Fatalf("updateUserNote() error = %v", err)
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("updateUserNote() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if gotVersion != tt.wantVersion {
+				t.Errorf("updateUserNote() updated at version %d, want %d", gotVersion, tt.wantVersion)
+			}
+		})
+	}
+}
@@ -1,30 +1,41 @@
 package http
 
 import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/api"
+	"github.com/baobei23/goapp/internal/pkg/logger"
+	"github.com/baobei23/goapp/internal/users"
 )
 
 // readUserByEmail godoc
 //
 //	@Summary		Read User By Email
-//	@Description	Read User By Email
+//	@Description	Read User By Email. Requires the users:read permission
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	BaseResponse{data=users.User}
-//	@Failure		400	{object}	ErrorResponse
-//	@Failure		401	{object}	ErrorResponse
-//	@Failure		500	{object}	ErrorResponse
+//	@Param			email	query		string	true	"Email"
+//	@Success		200		{object}	BaseResponse{data=users.User}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
 //	@Router			/users [get]
 //
 //	@security		ApiKeyAuth
 func (h *Handlers) ReadUserByEmail(c *gin.Context) error {
-	email := GetUserEmail(c)
+	email := c.Query("email")
 	if email == "" {
-		return errors.Unauthorized("unauthorized")
+		return errors.InputBody("email is required")
 	}
 
 	out, err := h.apis.ReadUserByEmail(c.Request.Context(), email)
@@ -36,3 +47,379 @@ func (h *Handlers) ReadUserByEmail(c *gin.Context) error {
 
 	return nil
 }
+
+// readMe godoc
+//
+//	@Summary		Read Own Profile
+//	@Description	Read the profile of the authenticated user
+//	@Tags			Users
+//	@Produce		json
+//	@Success		200	{object}	BaseResponse{data=users.User}
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/users/me [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ReadMe(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	out, err := h.apis.ReadUserByID(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, out, nil)
+
+	return nil
+}
+
+type UpdateProfileRequest struct {
+	FullName       *string `json:"fullName" binding:"omitempty,min=1,max=255"`
+	Phone          *string `json:"phone" binding:"omitempty,max=255"`
+	ContactAddress *string `json:"contactAddress" binding:"omitempty,max=255"`
+}
+
+// updateMe godoc
+//
+//	@Summary		Update Own Profile
+//	@Description	Update the profile of the authenticated user. Only the fields provided are updated
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateProfileRequest	true	"Update Profile Payload"
+//	@Success		200		{object}	BaseResponse{data=users.User}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		422		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/users/me [patch]
+//	@Security		ApiKeyAuth
+func (h *Handlers) UpdateMe(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	req := &UpdateProfileRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	out, err := h.apis.UpdateUserProfile(c.Request.Context(), userID, &users.ProfileUpdate{
+		FullName:       req.FullName,
+		Phone:          req.Phone,
+		ContactAddress: req.ContactAddress,
+	})
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusOK, out, nil)
+
+	return nil
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=8"`
+}
+
+// changePassword godoc
+//
+//	@Summary		Change Password
+//	@Description	Change the password of the authenticated user. All existing sessions are invalidated and a new token pair is returned
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangePasswordRequest	true	"Change Password Payload"
+//	@Success		200		{object}	BaseResponse{data=LoginResponse}
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		422		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/users/me/password [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ChangePassword(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	req := &ChangePasswordRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	user, err := h.apis.ChangePassword(c.Request.Context(), userID, req.CurrentPassword, req.NewPassword, time.Now().Add(h.tm.GetAccessExpiry()))
+	if err != nil {
+		return err
+	}
+
+	err = waitNextSecond(c.Request.Context())
+	if err != nil {
+		return err
+	}
+
+	return h.respondLogin(c, user, c.GetString("tokenAudience"), usesCookieSession(c))
+}
+
+// waitNextSecond waits for the next second to begin. Token timestamps have a precision of
+// seconds, so tokens issued within the same second as revoking all tokens are revoked as well
+func waitNextSecond(ctx context.Context) error {
+	timer := time.NewTimer(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "cancelled waiting to issue new tokens")
+	case <-timer.C:
+		return nil
+	}
+}
+
+// DeleteAccountRequest confirms it's the user. Passwordless users (provisioned by an identity
+// provider) must have logged in with the provider in the last few minutes instead.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// deleteMe godoc
+//
+//	@Summary		Delete Own Account
+//	@Description	Permanently delete the authenticated user along with all their notes. Passwordless users must
+//	@Description	have logged in with their identity provider in the last few minutes, instead of confirming the password
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	DeleteAccountRequest	true	"Delete Account Payload"
+//	@Success		204
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		422	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/users/me [delete]
+//	@Security		ApiKeyAuth
+func (h *Handlers) DeleteMe(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	req := &DeleteAccountRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	err := h.apis.DeleteUser(c.Request.Context(), userID, &users.Reauthentication{
+		Password: req.Password,
+		AuthTime: GetAuthTime(c),
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// exportMe godoc
+//
+//	@Summary		Export Own Data
+//	@Description	Download all the personal data stored for the authenticated user, as a JSON document or a ZIP archive
+//	@Tags			Users
+//	@Produce		json
+//	@Produce		application/zip
+//	@Param			format	query		string	false	"Export format"	Enums(json, zip)
+//	@Success		200		{object}	api.UserDataExport
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/users/me/export [get]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ExportMe(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		return errors.InputBody("format should be either json or zip")
+	}
+
+	export, err := h.apis.ExportUserData(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("export-%s-%s", userID, export.ExportedAt.Format("20060102150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+format))
+
+	c.Status(http.StatusOK)
+	if format == "json" {
+		c.Header("Content-Type", "application/json")
+		err = json.NewEncoder(c.Writer).Encode(export)
+	} else {
+		c.Header("Content-Type", "application/zip")
+		err = writeExportArchive(c.Writer, export)
+	}
+
+	// the response is already (partially) written, so the error can only be logged
+	if err != nil {
+		logger.Error(c.Request.Context(), errors.Wrap(err, "failed writing export"))
+		c.Abort()
+	}
+
+	return nil
+}
+
+// writeExportArchive streams the export as a ZIP archive, with the profile and notes as separate files
+func writeExportArchive(w http.ResponseWriter, export *api.UserDataExport) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content any
+	}{
+		{name: "profile.json", content: export.User},
+		{name: "notes.json", content: export.Notes},
+	}
+
+	for _, file := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(file.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// enrollMFA godoc
+//
+//	@Summary		Enroll Two-Factor Authentication
+//	@Description	Generate a TOTP secret and recovery codes. Two-factor authentication is enabled only once confirmed with a valid code
+//	@Tags			Users
+//	@Produce		json
+//	@Success		201	{object}	BaseResponse{data=users.MFAEnrollment}
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		409	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/users/me/mfa [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) EnrollMFA(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	out, err := h.apis.EnrollMFA(c.Request.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	JSON(c, http.StatusCreated, out, nil)
+
+	return nil
+}
+
+type ConfirmMFARequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// confirmMFA godoc
+//
+//	@Summary		Confirm Two-Factor Authentication
+//	@Description	Enable two-factor authentication using a code from the authenticator app
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	ConfirmMFARequest	true	"Confirm MFA Payload"
+//	@Success		204
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		409	{object}	ErrorResponse
+//	@Failure		422	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/users/me/mfa/confirm [post]
+//	@Security		ApiKeyAuth
+func (h *Handlers) ConfirmMFA(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	req := &ConfirmMFARequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	err := h.apis.ConfirmMFA(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
+
+// DisableMFARequest confirms it's the user, the same way as DeleteAccountRequest
+type DisableMFARequest struct {
+	Password string `json:"password"`
+}
+
+// disableMFA godoc
+//
+//	@Summary		Disable Two-Factor Authentication
+//	@Description	Turn off two-factor authentication for the authenticated user. Passwordless users must have logged
+//	@Description	in with their identity provider in the last few minutes, instead of confirming the password
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	DisableMFARequest	true	"Disable MFA Payload"
+//	@Success		204
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		422	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Router			/users/me/mfa [delete]
+//	@Security		ApiKeyAuth
+func (h *Handlers) DisableMFA(c *gin.Context) error {
+	userID := GetUserID(c)
+	if userID == "" {
+		return errors.Unauthorized("unauthorized")
+	}
+
+	req := &DisableMFARequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return errors.InputBodyErr(err, "invalid JSON provided")
+	}
+
+	err := h.apis.DisableMFA(c.Request.Context(), userID, &users.Reauthentication{
+		Password: req.Password,
+		AuthTime: GetAuthTime(c),
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Status(http.StatusNoContent)
+
+	return nil
+}
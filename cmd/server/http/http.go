@@ -25,6 +25,13 @@ type Config struct {
 	TemplatesBasePath string
 	EnableAccessLog   bool
 	EnableTracing     bool
+
+	// RequireVerifiedEmail if true, does not let users with an unverified email access protected APIs
+	RequireVerifiedEmail bool
+	// Cookies is the configuration of the cookies set for browser clients using the cookie session mode
+	Cookies CookieConfig
+	// BlockImpersonatedWrites if true, makes impersonation read-only by rejecting all write requests
+	BlockImpersonatedWrites bool
 }
 
 type HTTP struct {
@@ -43,15 +50,22 @@ func (h *HTTP) Shutdown(ctx context.Context) error {
 
 // NewService returns an instance of HTTP with all its dependencies set
 func NewService(cfg *Config, apis api.Server, tm *jwt.TokenManager) (*HTTP, error) {
-	home, err := loadHomeTemplate(cfg.TemplatesBasePath)
+	home, err := loadTemplate(cfg.TemplatesBasePath, "index.html")
+	if err != nil {
+		return nil, err
+	}
+
+	sharedNote, err := loadTemplate(cfg.TemplatesBasePath, "shared_note.html")
 	if err != nil {
 		return nil, err
 	}
 
 	handlers := &Handlers{
-		apis: apis,
-		home: home,
-		tm:   tm,
+		cfg:        cfg,
+		apis:       apis,
+		home:       home,
+		sharedNote: sharedNote,
+		tm:         tm,
 	}
 
 	if !cfg.EnableAccessLog {
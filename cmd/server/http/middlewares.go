@@ -2,29 +2,60 @@ package http
 
 import (
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/apikeys"
+	"github.com/baobei23/goapp/internal/audit"
+	"github.com/baobei23/goapp/internal/pkg/logger"
 )
 
-// AuthMiddleware validates the JWT token in Authorization header
+// AuthMiddleware validates the JWT token in Authorization header, or in the access token cookie
+// for browser clients using the cookie session mode. Personal API keys are accepted in the
+// Authorization header as well (`ApiKey <key>`)
 func (h *Handlers) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		tokenStr, fromCookie := "", false
+
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
+		if authHeader != "" {
+			parts := strings.Split(authHeader, " ")
+			if len(parts) == 2 && parts[0] == "ApiKey" {
+				h.authenticateAPIKey(c, parts[1])
+				return
+			}
+
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
+				c.Abort()
+				return
+			}
+			tokenStr = parts[1]
+		} else {
+			tokenStr, _ = c.Cookie(accessTokenCookie)
+			fromCookie = true
+		}
+
+		if tokenStr == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header is missing"})
 			c.Abort()
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
-			c.Abort()
-			return
+		// cookies are sent along with cross-site requests as well, unlike the Authorization header
+		if fromCookie {
+			err := checkCSRF(c)
+			if err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
 		}
 
-		tokenStr := parts[1]
 		claims, err := h.tm.Validate(tokenStr)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
@@ -38,9 +69,200 @@ func (h *Handlers) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			c.Abort()
+			return
+		}
+
+		revoked, err := h.apis.IsTokenRevoked(
+			c.Request.Context(),
+			claims.ID,
+			claims.UserID,
+			claims.FamilyID,
+			claims.IssuedAt.Time,
+			claims.ExpiresAt.Time,
+		)
+		if err != nil {
+			logger.Error(c.Request.Context(), errors.Stacktrace(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify token"})
+			c.Abort()
+			return
+		}
+
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		// Set userID in context for subsequent handlers
 		c.Set("userID", claims.UserID)
 		c.Set("userEmail", claims.Email)
+		c.Set("emailVerified", claims.EmailVerified)
+		c.Set("roles", claims.Roles)
+		c.Set("permissions", claims.Permissions)
+		c.Set("tokenID", claims.ID)
+		c.Set("tokenFamilyID", claims.FamilyID)
+		c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+		c.Set("tokenAudience", claims.IssuedFor())
+		c.Set("cookieSession", fromCookie)
+		if claims.AuthTime != nil {
+			c.Set("authTime", claims.AuthTime.Time)
+		}
+
+		if actorID := claims.ActorID(); actorID != "" {
+			c.Set("actorID", actorID)
+			h.auditImpersonation(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// auditImpersonation records every write request made while impersonating a user in the audit
+// trail, or rejects it if impersonation is configured to be read-only
+func (h *Handlers) auditImpersonation(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+
+	entry := &audit.Entry{
+		ActorID: GetActorID(c),
+		UserID:  GetUserID(c),
+		Action:  audit.ActionImpersonatedWrite,
+		Method:  c.Request.Method,
+		Path:    c.Request.URL.Path,
+	}
+
+	if h.cfg.BlockImpersonatedWrites {
+		entry.Action = audit.ActionImpersonatedWriteBlocked
+		entry.Status = http.StatusForbidden
+		h.recordAudit(c, entry)
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "not allowed while impersonating a user"})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+
+	entry.Status = c.Writer.Status()
+	h.recordAudit(c, entry)
+}
+
+// recordAudit records the entry, the request is not failed if it cannot be recorded
+func (h *Handlers) recordAudit(c *gin.Context, entry *audit.Entry) {
+	err := h.apis.RecordAudit(c.Request.Context(), entry)
+	if err != nil {
+		logger.Error(c.Request.Context(), errors.Stacktrace(err), entry)
+	}
+}
+
+// authenticateAPIKey sets the same context values as a token would, for the user the key belongs
+// to. Only the permissions granted as scopes are set, all of them if the key has the * scope
+func (h *Handlers) authenticateAPIKey(c *gin.Context, secret string) {
+	key, user, err := h.apis.AuthenticateAPIKey(c.Request.Context(), secret)
+	if err != nil {
+		status, msg, _ := errors.HTTPStatusCodeMessage(err)
+		if status > 499 {
+			logger.Error(c.Request.Context(), errors.Stacktrace(err))
+		}
+		c.JSON(status, gin.H{"error": msg})
+		c.Abort()
+		return
+	}
+
+	permissions := make([]string, 0, len(user.Permissions))
+	for _, permission := range user.Permissions {
+		if key.HasScope(permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	c.Set("userID", user.ID)
+	c.Set("userEmail", user.Email)
+	c.Set("emailVerified", user.IsVerified())
+	c.Set("roles", user.Roles)
+	c.Set("permissions", permissions)
+	c.Set("apiKeyID", key.ID)
+	c.Set("apiKeyScopes", key.Scopes)
+	c.Next()
+}
+
+// RequireScope rejects requests authenticated with an API key which is not granted the scope.
+// Requests authenticated with a token are not restricted. It should be used after AuthMiddleware
+func (h *Handlers) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes := c.GetStringSlice("apiKeyScopes")
+		if c.GetString("apiKeyID") == "" || apikeys.HasScope(scopes, scope) {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key is not granted the scope " + scope})
+		c.Abort()
+	}
+}
+
+// RejectAPIKeys rejects requests authenticated with an API key, e.g. for managing the account
+// or the keys themselves. It should be used after AuthMiddleware
+func (h *Handlers) RejectAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("apiKeyID") == "" {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "not allowed using an API key"})
+		c.Abort()
+	}
+}
+
+// RejectImpersonation rejects requests made while impersonating a user, e.g. for managing the
+// account security. It should be used after AuthMiddleware
+func (h *Handlers) RejectImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetActorID(c) == "" {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "not allowed while impersonating a user"})
+		c.Abort()
+	}
+}
+
+// VerifiedEmailMiddleware rejects users whose email is not verified, if so configured.
+// It should be used after AuthMiddleware
+func (h *Handlers) VerifiedEmailMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.cfg.RequireVerifiedEmail || c.GetBool("emailVerified") {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "email address is not verified"})
+		c.Abort()
+	}
+}
+
+// RequirePermission rejects users who do not have all of the given permissions.
+// It should be used after AuthMiddleware
+func (h *Handlers) RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("permissions")
+		for _, permission := range permissions {
+			if !slices.Contains(granted, permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Next()
 	}
 }
@@ -50,6 +272,22 @@ func GetUserID(c *gin.Context) string {
 	return c.GetString("userID")
 }
 
+// GetTokenID retrieves the jti of the access token from the context
+func GetTokenID(c *gin.Context) string {
+	return c.GetString("tokenID")
+}
+
+// GetActorID retrieves the ID of the admin impersonating the user from the context, it's empty
+// unless the request is made while impersonating
+func GetActorID(c *gin.Context) string {
+	return c.GetString("actorID")
+}
+
+// GetAuthTime retrieves when the user logged in, in the session of the access token, from the context
+func GetAuthTime(c *gin.Context) time.Time {
+	return c.GetTime("authTime")
+}
+
 // GetUserEmail retrieves the userEmail from the context
 func GetUserEmail(c *gin.Context) string {
 	return c.GetString("userEmail")
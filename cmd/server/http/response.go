@@ -9,6 +9,13 @@ type BaseResponse struct {
 	Meta any `json:"meta,omitempty"`
 }
 
+// PageMeta is the meta of a page of a list, with the cursors to the pages around it. A cursor is
+// omitted if there's no page in that direction
+type PageMeta struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
 type ErrorResponse struct {
 	Error string `json:"error" example:"Something went wrong"`
 }
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name TEXT PRIMARY KEY,
+    description TEXT,
+    created_at timestamptz DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role TEXT NOT NULL references roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL references users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL references roles(name) ON DELETE CASCADE,
+    created_at timestamptz DEFAULT now(),
+    PRIMARY KEY (user_id, role)
+);
+
+-- regular users do not need any role, only elevated access is granted through roles
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Administrators with access to all the users')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:manage')
+ON CONFLICT (role, permission) DO NOTHING;
@@ -0,0 +1,7 @@
+-- key is either "account:<email>" or "ip:<client IP>"
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at timestamptz,
+    locked_until timestamptz
+);
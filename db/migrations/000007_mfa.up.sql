@@ -0,0 +1,15 @@
+-- mfa_secret is encrypted by the application, it is set but not enabled until enrollment is confirmed
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_secret BYTEA;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled_at timestamptz;
+-- mfa_last_step is the last TOTP time step used, codes of the same or older steps cannot be reused
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL references users(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
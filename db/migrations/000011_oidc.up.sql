@@ -0,0 +1,25 @@
+-- identities of users at external OpenID Connect providers
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL references users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    created_at timestamptz DEFAULT now(),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- logins started with an external provider, awaiting the callback. Only the hash of the state is stored
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash BYTEA PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    audience TEXT NOT NULL DEFAULT '',
+    use_cookies BOOLEAN NOT NULL DEFAULT false,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expires_at ON oidc_login_states(expires_at);
@@ -0,0 +1,15 @@
+-- a session is a login on a device, i.e. a refresh token family. The ID is that of the family
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL references users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    -- expires_at is the expiry of the latest refresh token of the session
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz,
+    last_seen_at timestamptz DEFAULT now(),
+    created_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
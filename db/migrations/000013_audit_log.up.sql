@@ -0,0 +1,19 @@
+-- append-only trail of sensitive actions. Users are set to null once deleted, to keep the trail
+CREATE TABLE IF NOT EXISTS audit_log (
+    id UUID PRIMARY KEY,
+    actor_id UUID references users(id) ON DELETE SET NULL,
+    user_id UUID references users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    method TEXT NOT NULL DEFAULT '',
+    path TEXT NOT NULL DEFAULT '',
+    status INT NOT NULL DEFAULT 0,
+    details TEXT NOT NULL DEFAULT '',
+    created_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id, created_at);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:impersonate')
+ON CONFLICT (role, permission) DO NOTHING;
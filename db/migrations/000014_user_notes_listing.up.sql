@@ -0,0 +1,4 @@
+-- supports listing the notes of a user page by page, in each of the sort orders
+CREATE INDEX IF NOT EXISTS idx_user_notes_user_created ON user_notes(user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_user_notes_user_updated ON user_notes(user_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_user_notes_user_title ON user_notes(user_id, title, id);
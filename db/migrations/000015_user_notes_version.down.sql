@@ -0,0 +1 @@
+ALTER TABLE user_notes DROP COLUMN IF EXISTS version;
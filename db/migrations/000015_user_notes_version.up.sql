@@ -0,0 +1,2 @@
+-- the version is incremented on every update, and is used to detect conflicting updates
+ALTER TABLE user_notes ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
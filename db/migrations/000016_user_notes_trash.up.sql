@@ -0,0 +1,4 @@
+-- trashed notes are kept until purged, and can be restored until then
+ALTER TABLE user_notes ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS idx_user_notes_deleted_at ON user_notes(deleted_at) WHERE deleted_at IS NOT NULL;
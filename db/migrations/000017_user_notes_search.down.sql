@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_user_notes_search;
+
+ALTER TABLE user_notes DROP COLUMN IF EXISTS search;
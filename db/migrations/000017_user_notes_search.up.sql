@@ -0,0 +1,8 @@
+-- full-text search over notes, with matches in the title ranked above those in the content
+ALTER TABLE user_notes ADD COLUMN IF NOT EXISTS search tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(content, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_user_notes_search ON user_notes USING GIN (search);
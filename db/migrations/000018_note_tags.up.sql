@@ -0,0 +1,16 @@
+-- tags are per user, and are linked to any number of the user's notes
+CREATE TABLE IF NOT EXISTS note_tags (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL references users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at timestamptz DEFAULT now(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS user_note_tags (
+    note_id UUID NOT NULL references user_notes(id) ON DELETE CASCADE,
+    tag_id UUID NOT NULL references note_tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (note_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_note_tags_tag_id ON user_note_tags(tag_id);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS tr_user_note_revisions_bd ON user_note_revisions;
+DROP FUNCTION IF EXISTS reject_note_revision_delete();
+DROP TRIGGER IF EXISTS tr_user_note_revisions_bu ON user_note_revisions;
+DROP FUNCTION IF EXISTS reject_note_revision_update();
+DROP TABLE IF EXISTS user_note_revisions;
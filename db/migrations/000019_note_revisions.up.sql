@@ -0,0 +1,52 @@
+-- every version of a note is kept as a revision, along with the user who made the change
+CREATE TABLE IF NOT EXISTS user_note_revisions (
+    note_id UUID NOT NULL references user_notes(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    author_id UUID references users(id) ON DELETE SET NULL,
+    created_at timestamptz DEFAULT now(),
+    PRIMARY KEY (note_id, version)
+);
+
+-- revisions are immutable, other than their author being removed along with the user
+CREATE OR REPLACE FUNCTION reject_note_revision_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF row(NEW.note_id, NEW.version, NEW.title, NEW.content, NEW.tags, NEW.created_at)
+        IS DISTINCT FROM row(OLD.note_id, OLD.version, OLD.title, OLD.content, OLD.tags, OLD.created_at) THEN
+      RAISE EXCEPTION 'note revisions cannot be changed';
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER tr_user_note_revisions_bu BEFORE UPDATE on user_note_revisions
+  FOR EACH ROW EXECUTE FUNCTION reject_note_revision_update();
+
+-- nor can they be deleted, other than along with their note (i.e. once it's purged from the trash)
+CREATE OR REPLACE FUNCTION reject_note_revision_delete()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM user_notes WHERE id = OLD.note_id) THEN
+      RAISE EXCEPTION 'note revisions cannot be deleted';
+    END IF;
+    RETURN OLD;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER tr_user_note_revisions_bd BEFORE DELETE on user_note_revisions
+  FOR EACH ROW EXECUTE FUNCTION reject_note_revision_delete();
+
+-- the current version of existing notes is their first revision
+INSERT INTO user_note_revisions (note_id, version, title, content, tags, author_id, created_at)
+SELECT n.id, n.version, coalesce(n.title, ''), coalesce(n.content, ''),
+    array(
+        SELECT t.name FROM user_note_tags nt JOIN note_tags t ON t.id = nt.tag_id
+        WHERE nt.note_id = n.id
+        ORDER BY t.name
+    ),
+    n.user_id, n.updated_at
+FROM user_notes n
+ON CONFLICT DO NOTHING;
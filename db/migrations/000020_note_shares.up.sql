@@ -0,0 +1,11 @@
+-- notes are shared with other users, who can either view or edit them
+CREATE TABLE IF NOT EXISTS user_note_shares (
+    note_id UUID NOT NULL references user_notes(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL references users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('viewer', 'editor')),
+    shared_by UUID references users(id) ON DELETE SET NULL,
+    created_at timestamptz DEFAULT now(),
+    PRIMARY KEY (note_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_note_shares_user_id ON user_note_shares(user_id);
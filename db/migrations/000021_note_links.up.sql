@@ -0,0 +1,15 @@
+-- public links to notes, the token and the optional password of a link are only stored hashed
+CREATE TABLE IF NOT EXISTS user_note_links (
+    id UUID PRIMARY KEY,
+    note_id UUID NOT NULL references user_notes(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL references users(id) ON DELETE CASCADE,
+    token_hash BYTEA NOT NULL UNIQUE,
+    password_hash BYTEA,
+    expires_at timestamptz,
+    views BIGINT NOT NULL DEFAULT 0,
+    last_viewed_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_note_links_user_id ON user_note_links(user_id);
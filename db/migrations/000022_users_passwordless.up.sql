@@ -0,0 +1,4 @@
+-- passwordless users are provisioned by an identity provider with a random password, until they
+-- set one using the password reset. They confirm sensitive actions by logging in with the
+-- provider again instead of with the password.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS passwordless BOOLEAN NOT NULL DEFAULT false;
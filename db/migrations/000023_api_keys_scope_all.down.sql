@@ -0,0 +1,2 @@
+ALTER TABLE api_keys ALTER COLUMN scopes SET DEFAULT '{}';
+UPDATE api_keys SET scopes = '{}' WHERE scopes = '{*}';
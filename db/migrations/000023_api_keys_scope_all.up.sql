@@ -0,0 +1,4 @@
+-- keys without scopes used to have all the access of their user, which is now granted
+-- explicitly with the * scope. Keys without scopes cannot be used for anything.
+UPDATE api_keys SET scopes = '{*}' WHERE scopes = '{}';
+ALTER TABLE api_keys ALTER COLUMN scopes DROP DEFAULT;
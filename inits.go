@@ -12,12 +12,17 @@ import (
 	"github.com/baobei23/goapp/cmd/server/grpc"
 	xhttp "github.com/baobei23/goapp/cmd/server/http"
 	"github.com/baobei23/goapp/internal/api"
+	"github.com/baobei23/goapp/internal/apikeys"
+	"github.com/baobei23/goapp/internal/audit"
 	"github.com/baobei23/goapp/internal/configs"
 	"github.com/baobei23/goapp/internal/pkg/apm"
 	"github.com/baobei23/goapp/internal/pkg/health"
 	"github.com/baobei23/goapp/internal/pkg/jwt"
 	"github.com/baobei23/goapp/internal/pkg/logger"
+	"github.com/baobei23/goapp/internal/pkg/oidc"
 	"github.com/baobei23/goapp/internal/pkg/postgres"
+	"github.com/baobei23/goapp/internal/sso"
+	"github.com/baobei23/goapp/internal/tokens"
 	"github.com/baobei23/goapp/internal/usernotes"
 	"github.com/baobei23/goapp/internal/users"
 )
@@ -113,8 +118,7 @@ func start(
 	probestatus *health.ProbeResponder,
 	cfgs *configs.Configs,
 	fatalErr chan<- error,
-) (hserver *xhttp.HTTP, gserver *grpc.GRPC) {
-	_ = ctx
+) (hserver *xhttp.HTTP, gserver *grpc.GRPC, stopJobs func()) {
 	pqdriver, err := postgres.NewPool(cfgs.Postgres())
 	if err != nil {
 		panic(errors.Wrap(err))
@@ -132,15 +136,79 @@ func start(
 		}),
 	})
 
+	sbox, err := cfgs.SecretBox()
+	if err != nil {
+		panic(errors.Wrap(err))
+	}
+
+	// a nil *secretbox.Box would not be a nil users.SecretCipher
+	var cipher users.SecretCipher
+	if sbox != nil {
+		cipher = sbox
+	} else {
+		logger.Warn(ctx, "MFA_ENCRYPTION_KEY is not set, two-factor authentication is disabled")
+	}
+
+	// background jobs are stopped on shutdown, after the APIs
+	jobs := make([]func(), 0, 2)
+
 	userPGstore := users.NewPostgresStore(pqdriver, cfgs.UserPostgresTable())
-	userSvc := users.NewService(userPGstore)
+	hasher, err := cfgs.PasswordHasher()
+	if err != nil {
+		panic(errors.Wrap(err))
+	}
+
+	sender, err := cfgs.Mailer()
+	if err != nil {
+		panic(errors.Wrap(err))
+	}
+
+	userSvc := users.NewService(cfgs.Users(), userPGstore, sender, hasher, cipher)
 
 	notePGstore := usernotes.NewPostgresStore(pqdriver, "user_notes")
-	noteSvc := usernotes.NewService(notePGstore)
+	noteCfg, err := cfgs.UserNotes()
+	if err != nil {
+		panic(errors.Wrap(err))
+	}
 
-	svrAPIs := api.NewServer(userSvc, noteSvc)
+	noteSvc := usernotes.NewService(noteCfg, notePGstore, hasher)
+	jobs = append(jobs, noteSvc.StartPurge(ctx))
+
+	tokenPGstore := tokens.NewPostgresStore(pqdriver, "refresh_tokens")
+	tokenSvc := tokens.NewService(cfgs.Tokens(), tokenPGstore)
+	jobs = append(jobs, tokenSvc.StartPurge(ctx))
+
+	apiKeyPGstore := apikeys.NewPostgresStore(pqdriver, "api_keys")
+	apiKeySvc := apikeys.NewService(apiKeyPGstore)
+
+	providerCfgs, err := cfgs.OIDCProviders()
+	if err != nil {
+		panic(errors.Wrap(err))
+	}
+	providers := make([]*oidc.Provider, 0, len(providerCfgs))
+	for _, providerCfg := range providerCfgs {
+		providers = append(providers, oidc.NewProvider(providerCfg, nil))
+	}
+
+	ssoPGstore := sso.NewPostgresStore(pqdriver, "oidc_login_states")
+	ssoSvc := sso.NewService(cfgs.SSO(), ssoPGstore, providers...)
+
+	auditPGstore := audit.NewPostgresStore(pqdriver, "audit_log")
+	auditSvc := audit.NewService(auditPGstore)
+
+	svrAPIs := api.NewServer(userSvc, noteSvc, tokenSvc, apiKeySvc, ssoSvc, auditSvc)
+
+	tm, err := cfgs.JWT()
+	if err != nil {
+		panic(errors.Wrap(err))
+	}
 
-	tm := cfgs.JWT()
 	hserver, gserver = startServers(svrAPIs, cfgs, tm, fatalErr)
+	stopJobs = func() {
+		for _, stop := range jobs {
+			stop()
+		}
+	}
+
 	return
 }
@@ -2,7 +2,12 @@ package api
 
 import (
 	"context"
+	"time"
 
+	"github.com/baobei23/goapp/internal/apikeys"
+	"github.com/baobei23/goapp/internal/audit"
+	"github.com/baobei23/goapp/internal/sso"
+	"github.com/baobei23/goapp/internal/tokens"
 	"github.com/baobei23/goapp/internal/usernotes"
 	"github.com/baobei23/goapp/internal/users"
 )
@@ -10,10 +15,59 @@ import (
 // Server has all the methods required to run the server
 type Server interface {
 	Register(ctx context.Context, user *users.User) (*users.User, error)
-	Login(ctx context.Context, email, password string) (*users.User, error)
+	Login(ctx context.Context, email, password, clientIP string) (*users.User, error)
 	ReadUserByEmail(ctx context.Context, email string) (*users.User, error)
+	ReadUserByID(ctx context.Context, userID string) (*users.User, error)
+	UpdateUserProfile(ctx context.Context, userID string, update *users.ProfileUpdate) (*users.User, error)
+	ChangePassword(ctx context.Context, userID, currentPassword, newPassword string, tokensExpireAt time.Time) (*users.User, error)
+	DeleteUser(ctx context.Context, userID string, reauth *users.Reauthentication) error
+	AssignUserRole(ctx context.Context, userID, role string) error
+	RevokeUserRole(ctx context.Context, userID, role string) error
+	UnlockUser(ctx context.Context, userID string) error
+	Impersonate(ctx context.Context, actorID, userID, reason string) (*users.User, error)
+	RecordAudit(ctx context.Context, entry *audit.Entry) error
+	ListAuditLog(ctx context.Context, filter *audit.Filter) ([]audit.Entry, error)
+	EnrollMFA(ctx context.Context, userID string) (*users.MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, userID, code string) error
+	VerifyMFA(ctx context.Context, userID, code string) (*users.User, error)
+	DisableMFA(ctx context.Context, userID string, reauth *users.Reauthentication) error
+	ExportUserData(ctx context.Context, userID string) (*UserDataExport, error)
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string, tokensExpireAt time.Time) error
+	IssueEmailVerification(ctx context.Context, userID string) error
+	ResendEmailVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	IssueRefreshToken(ctx context.Context, rt *tokens.RefreshToken, device *tokens.Device) error
+	RotateRefreshToken(ctx context.Context, currentID string, next *tokens.RefreshToken, device *tokens.Device) error
+	RevokeSession(ctx context.Context, userID, tokenID, familyID string, expiresAt time.Time) error
+	RevokeAllTokens(ctx context.Context, userID string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, tokenID, userID, familyID string, issuedAt, expiresAt time.Time) (bool, error)
+	ListSessions(ctx context.Context, userID string) ([]tokens.Session, error)
+	EndSession(ctx context.Context, userID, sessionID string) error
+	CreateAPIKey(ctx context.Context, key *apikeys.APIKey) (*apikeys.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]apikeys.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, keyID string) error
+	AuthenticateAPIKey(ctx context.Context, secret string) (*apikeys.APIKey, *users.User, error)
+	BeginSSOLogin(ctx context.Context, provider, audience string, useCookies bool) (*sso.Redirect, error)
+	CompleteSSOLogin(ctx context.Context, provider, state, code string) (*users.User, *sso.Login, error)
 	RegisterNote(ctx context.Context, un *usernotes.Note) (*usernotes.Note, error)
 	ReadUserNote(ctx context.Context, userID string, noteID string) (*usernotes.Note, error)
+	ListUserNotes(ctx context.Context, filter *usernotes.ListFilter) (*usernotes.Page, error)
+	UpdateUserNote(ctx context.Context, userID, noteID string, update *usernotes.NoteUpdate, version int) (*usernotes.Note, error)
+	TrashUserNote(ctx context.Context, userID, noteID string) error
+	RestoreUserNote(ctx context.Context, userID, noteID string) (*usernotes.Note, error)
+	SearchUserNotes(ctx context.Context, userID, query string, limit int) ([]usernotes.SearchResult, error)
+	ListUserNoteTags(ctx context.Context, userID string) ([]usernotes.TagCount, error)
+	ListUserNoteRevisions(ctx context.Context, userID, noteID string) ([]usernotes.Revision, error)
+	DiffUserNoteRevisions(ctx context.Context, userID, noteID string, from, to int) (*usernotes.RevisionDiff, error)
+	RestoreUserNoteRevision(ctx context.Context, userID, noteID string, revision, version int) (*usernotes.Note, error)
+	ShareUserNote(ctx context.Context, userID, noteID, email, role string) error
+	ListUserNoteShares(ctx context.Context, userID, noteID string) ([]usernotes.Share, error)
+	RevokeUserNoteShare(ctx context.Context, userID, noteID, sharedWithID string) error
+	CreateUserNoteLink(ctx context.Context, userID, noteID string, expiresAt *time.Time, password string) (*usernotes.Link, error)
+	ListUserNoteLinks(ctx context.Context, userID string) ([]usernotes.Link, error)
+	RevokeUserNoteLink(ctx context.Context, userID, linkID string) error
+	ViewSharedNote(ctx context.Context, token, password, clientIP string) (*usernotes.Note, *usernotes.Link, error)
 }
 
 // Subscriber has all the methods required to run the subscriber
@@ -22,21 +76,43 @@ type Subscriber interface {
 }
 
 type API struct {
-	users  *users.Users
-	unotes *usernotes.UserNotes
+	users   *users.Users
+	unotes  *usernotes.UserNotes
+	tokens  *tokens.Tokens
+	apikeys *apikeys.APIKeys
+	sso     *sso.SSO
+	audit   *audit.Audit
 }
 
-func New(us *users.Users, un *usernotes.UserNotes) *API {
+func New(
+	us *users.Users,
+	un *usernotes.UserNotes,
+	tk *tokens.Tokens,
+	ak *apikeys.APIKeys,
+	ss *sso.SSO,
+	au *audit.Audit,
+) *API {
 	return &API{
-		users:  us,
-		unotes: un,
+		users:   us,
+		unotes:  un,
+		tokens:  tk,
+		apikeys: ak,
+		sso:     ss,
+		audit:   au,
 	}
 }
 
-func NewServer(us *users.Users, un *usernotes.UserNotes) Server {
-	return New(us, un)
+func NewServer(
+	us *users.Users,
+	un *usernotes.UserNotes,
+	tk *tokens.Tokens,
+	ak *apikeys.APIKeys,
+	ss *sso.SSO,
+	au *audit.Audit,
+) Server {
+	return New(us, un, tk, ak, ss, au)
 }
 
 func NewSubscriber(us *users.Users) Subscriber {
-	return New(us, nil)
+	return New(us, nil, nil, nil, nil, nil)
 }
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+
+	"github.com/baobei23/goapp/internal/apikeys"
+	"github.com/baobei23/goapp/internal/users"
+)
+
+// CreateAPIKey is the API to create a new API key for a user. Keys can only be granted the
+// scopes available to every user, and the permissions the user has.
+func (a *API) CreateAPIKey(ctx context.Context, key *apikeys.APIKey) (*apikeys.APIKey, string, error) {
+	user, err := a.users.ReadByID(ctx, key.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	grantable := append(append([]string{}, apikeys.UserScopes...), user.Permissions...)
+
+	return a.apikeys.Create(ctx, key, grantable)
+}
+
+// ListAPIKeys is the API to list the active API keys of a user
+func (a *API) ListAPIKeys(ctx context.Context, userID string) ([]apikeys.APIKey, error) {
+	return a.apikeys.List(ctx, userID)
+}
+
+// RevokeAPIKey is the API to revoke an API key of a user
+func (a *API) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	return a.apikeys.Revoke(ctx, userID, keyID)
+}
+
+// AuthenticateAPIKey is the API to resolve an API key to the key and the user it belongs to
+func (a *API) AuthenticateAPIKey(ctx context.Context, secret string) (*apikeys.APIKey, *users.User, error) {
+	key, err := a.apikeys.Authenticate(ctx, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := a.users.ReadByID(ctx, key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, user, nil
+}
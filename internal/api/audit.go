@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"strings"
+
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/audit"
+	"github.com/baobei23/goapp/internal/users"
+)
+
+// Impersonate is the API to let an admin act as another user. It returns the user to be
+// impersonated, after recording the impersonation along with the reason given for it. The admin
+// cannot gain any permission by impersonating, see users.User.CanImpersonate
+func (a *API) Impersonate(ctx context.Context, actorID, userID, reason string) (*users.User, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.Validation("a reason is required to impersonate a user")
+	}
+
+	// the permissions are read afresh, rather than trusting the ones in the token of the actor
+	actor, err := a.users.ReadByID(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.users.ReadByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = actor.CanImpersonate(user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.audit.Record(ctx, &audit.Entry{
+		ActorID: actorID,
+		UserID:  user.ID,
+		Action:  audit.ActionImpersonationStarted,
+		Details: reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// RecordAudit is the API to append an entry to the audit trail
+func (a *API) RecordAudit(ctx context.Context, entry *audit.Entry) error {
+	return a.audit.Record(ctx, entry)
+}
+
+// ListAuditLog is the API to list the audit trail, latest first
+func (a *API) ListAuditLog(ctx context.Context, filter *audit.Filter) ([]audit.Entry, error) {
+	return a.audit.List(ctx, filter)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+
+	"github.com/baobei23/goapp/internal/sso"
+	"github.com/baobei23/goapp/internal/users"
+)
+
+// BeginSSOLogin is the API to start a login with an external identity provider. It returns where
+// at the provider the user is to be redirected to
+func (a *API) BeginSSOLogin(ctx context.Context, provider, audience string, useCookies bool) (*sso.Redirect, error) {
+	return a.sso.Begin(ctx, provider, audience, useCookies)
+}
+
+// CompleteSSOLogin is the API to complete a login with an external identity provider, returning
+// the user linked to the external identity
+func (a *API) CompleteSSOLogin(ctx context.Context, provider, state, code string) (*users.User, *sso.Login, error) {
+	login, err := a.sso.Complete(ctx, provider, state, code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := a.users.LoginWithIdentity(ctx, &users.ExternalIdentity{
+		Provider:      login.Provider,
+		Subject:       login.Identity.Subject,
+		Email:         login.Identity.Email,
+		EmailVerified: login.Identity.EmailVerified,
+		FullName:      login.Identity.Name,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, login, nil
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/baobei23/goapp/internal/tokens"
+)
+
+// IssueRefreshToken is the API to start tracking a refresh token issued on login to the device
+func (a *API) IssueRefreshToken(ctx context.Context, rt *tokens.RefreshToken, device *tokens.Device) error {
+	return a.tokens.Issue(ctx, rt, device)
+}
+
+// RotateRefreshToken is the API to replace a refresh token with the next one of its family
+func (a *API) RotateRefreshToken(ctx context.Context, currentID string, next *tokens.RefreshToken, device *tokens.Device) error {
+	return a.tokens.Rotate(ctx, currentID, next, device)
+}
+
+// RevokeSession is the API to revoke an access token along with all the refresh tokens of its family
+func (a *API) RevokeSession(ctx context.Context, userID, tokenID, familyID string, expiresAt time.Time) error {
+	err := a.tokens.Revoke(ctx, tokenID, userID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	if familyID == "" {
+		return nil
+	}
+
+	return a.tokens.RevokeFamily(ctx, userID, familyID)
+}
+
+// RevokeAllTokens is the API to revoke every token issued to the user so far
+func (a *API) RevokeAllTokens(ctx context.Context, userID string, expiresAt time.Time) error {
+	return a.tokens.RevokeAll(ctx, userID, expiresAt)
+}
+
+// IsTokenRevoked is the API to check if a token has been revoked
+func (a *API) IsTokenRevoked(ctx context.Context, tokenID, userID, familyID string, issuedAt, expiresAt time.Time) (bool, error) {
+	return a.tokens.IsRevoked(ctx, tokenID, userID, familyID, issuedAt, expiresAt)
+}
+
+// ListSessions is the API to list the devices the user is logged in on
+func (a *API) ListSessions(ctx context.Context, userID string) ([]tokens.Session, error) {
+	return a.tokens.Sessions(ctx, userID)
+}
+
+// EndSession is the API to sign out a device of the user
+func (a *API) EndSession(ctx context.Context, userID, sessionID string) error {
+	return a.tokens.EndSession(ctx, userID, sessionID)
+}
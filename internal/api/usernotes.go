@@ -2,8 +2,13 @@ package api
 
 import (
 	"context"
+	"strings"
+	"time"
+
+	"github.com/naughtygopher/errors"
 
 	"github.com/baobei23/goapp/internal/usernotes"
+	"github.com/baobei23/goapp/internal/users"
 )
 
 func (a *API) RegisterNote(ctx context.Context, un *usernotes.Note) (*usernotes.Note, error) {
@@ -13,3 +18,115 @@ func (a *API) RegisterNote(ctx context.Context, un *usernotes.Note) (*usernotes.
 func (a *API) ReadUserNote(ctx context.Context, userID string, noteID string) (*usernotes.Note, error) {
 	return a.unotes.GetNoteByID(ctx, userID, noteID)
 }
+
+// ListUserNotes is the API to list a page of the user's notes
+func (a *API) ListUserNotes(ctx context.Context, filter *usernotes.ListFilter) (*usernotes.Page, error) {
+	return a.unotes.ListNotes(ctx, filter)
+}
+
+// UpdateUserNote is the API to update a note of the user, provided it's still at the given version
+func (a *API) UpdateUserNote(ctx context.Context, userID, noteID string, update *usernotes.NoteUpdate, version int) (*usernotes.Note, error) {
+	return a.unotes.UpdateNote(ctx, userID, noteID, update, version)
+}
+
+// TrashUserNote is the API to move a note of the user to the trash
+func (a *API) TrashUserNote(ctx context.Context, userID, noteID string) error {
+	return a.unotes.TrashNote(ctx, userID, noteID)
+}
+
+// RestoreUserNote is the API to move a note of the user out of the trash
+func (a *API) RestoreUserNote(ctx context.Context, userID, noteID string) (*usernotes.Note, error) {
+	return a.unotes.RestoreNote(ctx, userID, noteID)
+}
+
+// SearchUserNotes is the API to search the notes of the user
+func (a *API) SearchUserNotes(ctx context.Context, userID, query string, limit int) ([]usernotes.SearchResult, error) {
+	return a.unotes.SearchNotes(ctx, userID, query, limit)
+}
+
+// ListUserNoteTags is the API to list the tags of the user's notes, along with their usage
+func (a *API) ListUserNoteTags(ctx context.Context, userID string) ([]usernotes.TagCount, error) {
+	return a.unotes.ListTags(ctx, userID)
+}
+
+// ListUserNoteRevisions is the API to list the revisions of a note of the user
+func (a *API) ListUserNoteRevisions(ctx context.Context, userID, noteID string) ([]usernotes.Revision, error) {
+	return a.unotes.ListRevisions(ctx, userID, noteID)
+}
+
+// DiffUserNoteRevisions is the API to diff two revisions of a note of the user
+func (a *API) DiffUserNoteRevisions(ctx context.Context, userID, noteID string, from, to int) (*usernotes.RevisionDiff, error) {
+	return a.unotes.DiffRevisions(ctx, userID, noteID, from, to)
+}
+
+// RestoreUserNoteRevision is the API to update a note of the user back to one of its revisions
+func (a *API) RestoreUserNoteRevision(ctx context.Context, userID, noteID string, revision, version int) (*usernotes.Note, error) {
+	return a.unotes.RestoreRevision(ctx, userID, noteID, revision, version)
+}
+
+// ShareUserNote is the API to share a note of the user with the user having the email, as an
+// editor or a viewer. The outcome is the same whether or not there is a user with the email, so
+// that sharing cannot be used to find out who is registered. Nothing is shared if there is none.
+func (a *API) ShareUserNote(ctx context.Context, userID, noteID, email, role string) error {
+	sharedWith, err := a.users.ReadByEmail(ctx, strings.TrimSpace(email))
+	if errors.Is(err, users.ErrUserEmailNotFound) {
+		return a.unotes.CanShare(ctx, userID, noteID, role)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = a.unotes.ShareNote(ctx, userID, noteID, sharedWith.ID, role)
+	return err
+}
+
+// ListUserNoteShares is the API to list the users a note of the user is shared with
+func (a *API) ListUserNoteShares(ctx context.Context, userID, noteID string) ([]usernotes.Share, error) {
+	return a.unotes.ListShares(ctx, userID, noteID)
+}
+
+// RevokeUserNoteShare is the API to stop sharing a note with a user
+func (a *API) RevokeUserNoteShare(ctx context.Context, userID, noteID, sharedWithID string) error {
+	return a.unotes.RevokeShare(ctx, userID, noteID, sharedWithID)
+}
+
+// CreateUserNoteLink is the API to create a public link to a note of the user
+func (a *API) CreateUserNoteLink(ctx context.Context, userID, noteID string, expiresAt *time.Time, password string) (*usernotes.Link, error) {
+	return a.unotes.CreateLink(ctx, userID, noteID, expiresAt, password)
+}
+
+// ListUserNoteLinks is the API to list the public links the user has created to their notes
+func (a *API) ListUserNoteLinks(ctx context.Context, userID string) ([]usernotes.Link, error) {
+	return a.unotes.ListLinks(ctx, userID)
+}
+
+// RevokeUserNoteLink is the API to revoke a public link to a note of the user
+func (a *API) RevokeUserNoteLink(ctx context.Context, userID, linkID string) error {
+	return a.unotes.RevokeLink(ctx, userID, linkID)
+}
+
+// ViewSharedNote is the API for anyone to view a note with a public link to it. Attempts at the
+// password of the link are throttled per link and per client IP, like logins
+func (a *API) ViewSharedNote(ctx context.Context, token, password, clientIP string) (*usernotes.Note, *usernotes.Link, error) {
+	if password == "" {
+		return a.unotes.ViewLink(ctx, token, password)
+	}
+
+	attempt, err := a.users.StartLinkPasswordAttempt(ctx, token, clientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	note, link, err := a.unotes.ViewLink(ctx, token, password)
+	switch {
+	case err == nil:
+		attempt.Succeeded(ctx)
+	case errors.Is(err, usernotes.ErrInvalidLinkPassword):
+		attempt.Failed(ctx)
+	default:
+		attempt.Discard(ctx)
+	}
+
+	return note, link, err
+}
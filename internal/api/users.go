@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"time"
 
+	"github.com/baobei23/goapp/internal/usernotes"
 	"github.com/baobei23/goapp/internal/users"
 )
 
@@ -16,8 +18,8 @@ func (a *API) Register(ctx context.Context, u *users.User) (*users.User, error)
 	return u, nil
 }
 
-func (a *API) Login(ctx context.Context, email, password string) (*users.User, error) {
-	return a.users.Login(ctx, email, password)
+func (a *API) Login(ctx context.Context, email, password, clientIP string) (*users.User, error) {
+	return a.users.Login(ctx, email, password, clientIP)
 }
 
 // ReadUserByEmail is the API to read an existing user by their email
@@ -30,6 +32,129 @@ func (a *API) ReadUserByEmail(ctx context.Context, email string) (*users.User, e
 	return u, nil
 }
 
+// ReadUserByID is the API to read an existing user by their ID
+func (a *API) ReadUserByID(ctx context.Context, userID string) (*users.User, error) {
+	return a.users.ReadByID(ctx, userID)
+}
+
+// UpdateUserProfile is the API to update the profile of an existing user
+func (a *API) UpdateUserProfile(ctx context.Context, userID string, update *users.ProfileUpdate) (*users.User, error) {
+	return a.users.UpdateProfile(ctx, userID, update)
+}
+
+// ChangePassword is the API for a user to change their password. Every token issued to the user
+// so far is revoked, tokensExpireAt is the time by which they'd expire anyway
+func (a *API) ChangePassword(ctx context.Context, userID, currentPassword, newPassword string, tokensExpireAt time.Time) (*users.User, error) {
+	user, err := a.users.ChangePassword(ctx, userID, currentPassword, newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.tokens.RevokeAll(ctx, userID, tokensExpireAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// AssignUserRole is the API to grant a role to a user
+func (a *API) AssignUserRole(ctx context.Context, userID, role string) error {
+	return a.users.AssignRole(ctx, userID, role)
+}
+
+// RevokeUserRole is the API to take away a role from a user
+func (a *API) RevokeUserRole(ctx context.Context, userID, role string) error {
+	return a.users.RevokeRole(ctx, userID, role)
+}
+
+// UnlockUser is the API to lift the lock placed on a user's account after failed login attempts
+func (a *API) UnlockUser(ctx context.Context, userID string) error {
+	return a.users.Unlock(ctx, userID)
+}
+
+// EnrollMFA is the API to start enrolling a user into two-factor authentication
+func (a *API) EnrollMFA(ctx context.Context, userID string) (*users.MFAEnrollment, error) {
+	return a.users.EnrollMFA(ctx, userID)
+}
+
+// ConfirmMFA is the API to enable two-factor authentication, once the user has setup their authenticator
+func (a *API) ConfirmMFA(ctx context.Context, userID, code string) error {
+	return a.users.ConfirmMFA(ctx, userID, code)
+}
+
+// VerifyMFA is the API to verify the second factor of a user during login
+func (a *API) VerifyMFA(ctx context.Context, userID, code string) (*users.User, error) {
+	return a.users.VerifyMFA(ctx, userID, code)
+}
+
+// DisableMFA is the API to turn off two-factor authentication for a user
+func (a *API) DisableMFA(ctx context.Context, userID string, reauth *users.Reauthentication) error {
+	return a.users.DisableMFA(ctx, userID, reauth)
+}
+
+// DeleteUser is the API to permanently delete a user along with all their data
+func (a *API) DeleteUser(ctx context.Context, userID string, reauth *users.Reauthentication) error {
+	return a.users.Delete(ctx, userID, reauth)
+}
+
+// UserDataExport has all the personal data stored for a user
+type UserDataExport struct {
+	User       *users.User      `json:"user"`
+	Notes      []usernotes.Note `json:"notes"`
+	ExportedAt time.Time        `json:"exportedAt"`
+}
+
+// ExportUserData is the API to collect all the personal data stored for a user
+func (a *API) ExportUserData(ctx context.Context, userID string) (*UserDataExport, error) {
+	u, err := a.users.ReadByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := a.unotes.ListAllNotes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserDataExport{
+		User:       u,
+		Notes:      notes,
+		ExportedAt: time.Now(),
+	}, nil
+}
+
+// ForgotPassword is the API to request a password reset token for the user with the email
+func (a *API) ForgotPassword(ctx context.Context, email string) error {
+	return a.users.ForgotPassword(ctx, email)
+}
+
+// ResetPassword is the API to set a new password using a password reset token. Every token
+// issued to the user so far is revoked, tokensExpireAt is the time by which they'd expire anyway
+func (a *API) ResetPassword(ctx context.Context, token, password string, tokensExpireAt time.Time) error {
+	userID, err := a.users.ResetPassword(ctx, token, password)
+	if err != nil {
+		return err
+	}
+
+	return a.tokens.RevokeAll(ctx, userID, tokensExpireAt)
+}
+
+// IssueEmailVerification is the API to send a new email verification token to the user
+func (a *API) IssueEmailVerification(ctx context.Context, userID string) error {
+	return a.users.IssueVerification(ctx, userID)
+}
+
+// ResendEmailVerification is the API to send a new email verification token to an unverified email
+func (a *API) ResendEmailVerification(ctx context.Context, email string) error {
+	return a.users.ResendVerification(ctx, email)
+}
+
+// VerifyEmail is the API to verify a user's email using the verification token
+func (a *API) VerifyEmail(ctx context.Context, token string) error {
+	return a.users.VerifyEmail(ctx, token)
+}
+
 func (a *API) AsyncRegisters(ctx context.Context, users []users.User) error {
 	return a.users.AsyncRegisters(ctx, users)
 }
@@ -0,0 +1,213 @@
+// Package apikeys maintains the personal API keys of users, used by scripts and service accounts
+// instead of logging in with a password
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/naughtygopher/errors"
+)
+
+const (
+	// keyPrefix makes the keys easy to recognize, e.g. by secret scanners
+	keyPrefix = "gak_"
+	keyLength = 32
+	// displayPrefixLength is the number of characters of the key stored in plain text
+	displayPrefixLength = len(keyPrefix) + 8
+)
+
+// Scopes which can be granted to a key on top of the permissions of the user
+const (
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+	ScopeNotesRead    = "notes:read"
+	ScopeNotesWrite   = "notes:write"
+	// ScopeAll grants all the access of the user, including their permissions
+	ScopeAll = "*"
+)
+
+// UserScopes are the scopes every user can grant to their keys
+var UserScopes = []string{ScopeProfileRead, ScopeProfileWrite, ScopeNotesRead, ScopeNotesWrite, ScopeAll}
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrKeyNotFound   = errors.New("API key not found")
+)
+
+type APIKey struct {
+	ID     string `json:"id"`
+	UserID string `json:"-"`
+	Name   string `json:"name"`
+	// Prefix is the beginning of the key, to help identify it
+	Prefix string `json:"prefix"`
+	// Scopes limit what the key can be used for, ScopeAll grants all the access of its user
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (key *APIKey) Sanitize() {
+	key.Name = strings.TrimSpace(key.Name)
+	for i := range key.Scopes {
+		key.Scopes[i] = strings.ToLower(strings.TrimSpace(key.Scopes[i]))
+	}
+	slices.Sort(key.Scopes)
+	key.Scopes = slices.Compact(key.Scopes)
+}
+
+// ValidateForCreate validates the key, only the grantable scopes are allowed
+func (key *APIKey) ValidateForCreate(grantable []string) error {
+	if key == nil {
+		return errors.Validation("empty API key")
+	}
+
+	key.Sanitize()
+	if key.UserID == "" {
+		return errors.Validation("API key owner cannot be empty")
+	}
+
+	if key.Name == "" {
+		return errors.Validation("API key name cannot be empty")
+	}
+
+	if len(key.Scopes) == 0 {
+		return errors.Validationf("API key needs at least one scope, %q for all the access of the user", ScopeAll)
+	}
+
+	for _, scope := range key.Scopes {
+		if !slices.Contains(grantable, scope) {
+			return errors.Validationf("scope %q cannot be granted", scope)
+		}
+	}
+
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return errors.Validation("API key expiry must be in the future")
+	}
+
+	return nil
+}
+
+// HasScope reports whether the key can be used for the scope
+func (key *APIKey) HasScope(scope string) bool {
+	return HasScope(key.Scopes, scope)
+}
+
+// HasScope reports whether the scopes include the scope, a key without scopes has none
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, ScopeAll) || slices.Contains(scopes, scope)
+}
+
+// Expired reports whether the key has expired at the given time
+func (key *APIKey) Expired(at time.Time) bool {
+	return key.ExpiresAt != nil && !key.ExpiresAt.After(at)
+}
+
+type store interface {
+	SaveAPIKey(ctx context.Context, key *APIKey, keyHash []byte) error
+	GetAPIKeyByHash(ctx context.Context, keyHash []byte) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, keyID string) error
+	TouchAPIKey(ctx context.Context, keyID string) error
+}
+
+type APIKeys struct {
+	store store
+}
+
+// Create creates a new key for the user, and returns it along with the secret key. The key is
+// only stored hashed, hence cannot be shown again.
+func (ak *APIKeys) Create(ctx context.Context, key *APIKey, grantable []string) (*APIKey, string, error) {
+	err := key.ValidateForCreate(grantable)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := newKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key.Prefix = secret[:displayPrefixLength]
+	key.CreatedAt = time.Now()
+
+	err = ak.store.SaveAPIKey(ctx, key, hashKey(secret))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+// List returns all the active keys of the user
+func (ak *APIKeys) List(ctx context.Context, userID string) ([]APIKey, error) {
+	if userID == "" {
+		return nil, errors.Validation("no user ID provided")
+	}
+
+	return ak.store.ListAPIKeys(ctx, userID)
+}
+
+// Revoke revokes the key, it cannot be used anymore
+func (ak *APIKeys) Revoke(ctx context.Context, userID, keyID string) error {
+	if userID == "" || keyID == "" {
+		return errors.Validation("no user ID or key ID provided")
+	}
+
+	return ak.store.RevokeAPIKey(ctx, userID, keyID)
+}
+
+// Authenticate returns the key matching the secret key, if it's neither revoked nor expired.
+// The last used time of the key is updated as well.
+func (ak *APIKeys) Authenticate(ctx context.Context, secret string) (*APIKey, error) {
+	secret = strings.TrimSpace(secret)
+	if !strings.HasPrefix(secret, keyPrefix) {
+		return nil, errors.UnauthenticatedErr(ErrInvalidAPIKey, ErrInvalidAPIKey.Error())
+	}
+
+	key, err := ak.store.GetAPIKeyByHash(ctx, hashKey(secret))
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, errors.UnauthenticatedErr(ErrInvalidAPIKey, ErrInvalidAPIKey.Error())
+		}
+		return nil, err
+	}
+
+	if key.Expired(time.Now()) {
+		return nil, errors.Unauthenticated("API key has expired")
+	}
+
+	err = ak.store.TouchAPIKey(ctx, key.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func newKey() (string, error) {
+	raw := make([]byte, keyLength)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", errors.Wrap(err, "failed generating API key")
+	}
+
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func hashKey(secret string) []byte {
+	hashed := sha256.Sum256([]byte(secret))
+	return hashed[:]
+}
+
+func NewService(store store) *APIKeys {
+	return &APIKeys{
+		store: store,
+	}
+}
@@ -0,0 +1,89 @@
+package apikeys
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAPIKey_ValidateForCreate(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	grantable := []string{ScopeNotesRead, ScopeNotesWrite, ScopeAll, "users:read"}
+
+	tests := []struct {
+		name    string
+		key     APIKey
+		wantErr bool
+	}{
+		{
+			name:    "no scopes",
+			key:     APIKey{UserID: "user", Name: "ci"},
+			wantErr: true,
+		},
+		{
+			name: "all scopes",
+			key:  APIKey{UserID: "user", Name: "ci", Scopes: []string{ScopeAll}},
+		},
+		{
+			name: "grantable scopes",
+			key:  APIKey{UserID: "user", Name: "ci", Scopes: []string{" Notes:Read ", "users:read"}, ExpiresAt: &future},
+		},
+		{
+			name:    "scope not grantable",
+			key:     APIKey{UserID: "user", Name: "ci", Scopes: []string{"users:manage"}},
+			wantErr: true,
+		},
+		{
+			name:    "no name",
+			key:     APIKey{UserID: "user", Name: " "},
+			wantErr: true,
+		},
+		{
+			name:    "no user",
+			key:     APIKey{Name: "ci"},
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			key:     APIKey{UserID: "user", Name: "ci", Scopes: []string{ScopeNotesRead}, ExpiresAt: &past},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.key.ValidateForCreate(grantable)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error: %v, wantErr: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIKey_Sanitize(t *testing.T) {
+	key := APIKey{Name: " ci ", Scopes: []string{"notes:write", " NOTES:READ", "notes:write"}}
+	key.Sanitize()
+
+	expected := APIKey{Name: "ci", Scopes: []string{"notes:read", "notes:write"}}
+	if !reflect.DeepEqual(key, expected) {
+		t.Errorf("got: %+v, expected: %+v", key, expected)
+	}
+}
+
+func TestAPIKey_HasScope(t *testing.T) {
+	unscoped := APIKey{}
+	if unscoped.HasScope(ScopeNotesWrite) {
+		t.Errorf("expected a key without scopes to have no scope")
+	}
+
+	all := APIKey{Scopes: []string{ScopeAll}}
+	if !all.HasScope(ScopeNotesWrite) || !all.HasScope("users:read") {
+		t.Errorf("expected a key with all scopes to have every scope")
+	}
+
+	scoped := APIKey{Scopes: []string{ScopeNotesRead}}
+	if !scoped.HasScope(ScopeNotesRead) || scoped.HasScope(ScopeNotesWrite) {
+		t.Errorf("expected a scoped key to only have its scopes")
+	}
+}
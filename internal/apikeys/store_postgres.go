@@ -0,0 +1,181 @@
+package apikeys
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/naughtygopher/errors"
+)
+
+var QueryTimeoutDuration = 5 * time.Second
+
+// lastUsedPrecision is how often the last used time of a key is updated at most, to avoid a
+// write on every request
+const lastUsedPrecision = time.Minute
+
+type pgstore struct {
+	pqdriver  *pgxpool.Pool
+	tableName string
+}
+
+func (ps *pgstore) SaveAPIKey(ctx context.Context, key *APIKey, keyHash []byte) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (id, user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key.ID = ps.newKeyID()
+	_, err := ps.pqdriver.Exec(
+		ctx,
+		query,
+		key.ID,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		keyHash,
+		key.Scopes,
+		key.ExpiresAt,
+		key.CreatedAt,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed storing API key")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) GetAPIKeyByHash(ctx context.Context, keyHash []byte) (*APIKey, error) {
+	query := fmt.Sprintf(`
+		SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM %s
+		WHERE key_hash = $1 AND revoked_at IS NULL`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key := new(APIKey)
+	err := ps.pqdriver.QueryRow(ctx, query, keyHash).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.Scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NotFoundErr(ErrKeyNotFound, "API key not found")
+		}
+		return nil, errors.Wrap(err, "failed getting API key")
+	}
+
+	return key, nil
+}
+
+func (ps *pgstore) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	query := fmt.Sprintf(`
+		SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM %s
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at, id`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed getting API keys")
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		key := APIKey{UserID: userID}
+		err = rows.Scan(
+			&key.ID,
+			&key.Name,
+			&key.Prefix,
+			&key.Scopes,
+			&key.ExpiresAt,
+			&key.LastUsedAt,
+			&key.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading API key")
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed getting API keys")
+	}
+
+	return keys, nil
+}
+
+func (ps *pgstore) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET revoked_at = now()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query, keyID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed revoking API key")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.NotFoundErr(ErrKeyNotFound, keyID)
+	}
+
+	return nil
+}
+
+func (ps *pgstore) TouchAPIKey(ctx context.Context, keyID string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - make_interval(secs => $2))`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, keyID, lastUsedPrecision.Seconds())
+	if err != nil {
+		return errors.Wrap(err, "failed updating API key last used time")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) newKeyID() string {
+	return uuid.NewString()
+}
+
+func NewPostgresStore(pqdriver *pgxpool.Pool, tableName string) store {
+	return &pgstore{
+		pqdriver:  pqdriver,
+		tableName: tableName,
+	}
+}
@@ -0,0 +1,122 @@
+// Package audit keeps an append-only trail of sensitive actions, e.g. admins acting as other users
+package audit
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+)
+
+const (
+	// ActionImpersonationStarted is recorded when an admin is issued a token to act as a user
+	ActionImpersonationStarted = "impersonation.started"
+	// ActionImpersonatedWrite is recorded for every write request made while impersonating
+	ActionImpersonatedWrite = "impersonation.write"
+	// ActionImpersonatedWriteBlocked is recorded for write requests rejected while impersonating
+	ActionImpersonatedWriteBlocked = "impersonation.write_blocked"
+
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+type Entry struct {
+	ID string `json:"id"`
+	// ActorID is the user who performed the action
+	ActorID string `json:"actorID"`
+	// UserID is the user the action was performed on, or on behalf of
+	UserID string `json:"userID"`
+	Action string `json:"action"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Status int    `json:"status,omitempty"`
+	// Details is free text, e.g. the reason given for impersonating a user
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (e *Entry) Sanitize() {
+	e.ActorID = strings.TrimSpace(e.ActorID)
+	e.UserID = strings.TrimSpace(e.UserID)
+	e.Action = strings.TrimSpace(e.Action)
+	e.Details = strings.TrimSpace(e.Details)
+}
+
+func (e *Entry) ValidateForCreate() error {
+	if e.ActorID == "" {
+		return errors.Validation("audit entry actor cannot be empty")
+	}
+
+	if e.Action == "" {
+		return errors.Validation("audit entry action cannot be empty")
+	}
+
+	return nil
+}
+
+// Filter narrows down the listed entries, empty fields match everything
+type Filter struct {
+	ActorID string
+	UserID  string
+	Limit   int
+}
+
+func (f *Filter) Sanitize() {
+	f.ActorID = strings.TrimSpace(f.ActorID)
+	f.UserID = strings.TrimSpace(f.UserID)
+	if f.Limit <= 0 {
+		f.Limit = defaultListLimit
+	}
+	f.Limit = min(f.Limit, maxListLimit)
+}
+
+func (f *Filter) Validate() error {
+	for _, id := range []string{f.ActorID, f.UserID} {
+		if id != "" && uuid.Validate(id) != nil {
+			return errors.Validationf("invalid user ID %q", id)
+		}
+	}
+
+	return nil
+}
+
+type store interface {
+	SaveEntry(ctx context.Context, entry *Entry) error
+	ListEntries(ctx context.Context, filter *Filter) ([]Entry, error)
+}
+
+type Audit struct {
+	store store
+}
+
+// Record appends the entry to the audit trail
+func (a *Audit) Record(ctx context.Context, entry *Entry) error {
+	entry.Sanitize()
+	err := entry.ValidateForCreate()
+	if err != nil {
+		return err
+	}
+
+	entry.CreatedAt = time.Now()
+
+	return a.store.SaveEntry(ctx, entry)
+}
+
+// List returns the entries matching the filter, latest first
+func (a *Audit) List(ctx context.Context, filter *Filter) ([]Entry, error) {
+	filter.Sanitize()
+	err := filter.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return a.store.ListEntries(ctx, filter)
+}
+
+func NewService(store store) *Audit {
+	return &Audit{
+		store: store,
+	}
+}
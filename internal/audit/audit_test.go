@@ -0,0 +1,65 @@
+package audit
+
+import "testing"
+
+func TestFilter_Sanitize(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    Filter
+		wantLimit int
+		wantErr   bool
+	}{
+		{
+			name:      "default limit",
+			filter:    Filter{},
+			wantLimit: defaultListLimit,
+		},
+		{
+			name:      "limit capped",
+			filter:    Filter{Limit: 10000},
+			wantLimit: maxListLimit,
+		},
+		{
+			name:      "valid users",
+			filter:    Filter{ActorID: " 6f1c7a52-4a8e-4d4b-9a57-0c6f2b1d9e10 ", Limit: 10},
+			wantLimit: 10,
+		},
+		{
+			name:      "invalid user",
+			filter:    Filter{UserID: "someone"},
+			wantLimit: defaultListLimit,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Sanitize()
+			if tt.filter.Limit != tt.wantLimit {
+				t.Errorf("got limit: %d, expected: %d", tt.filter.Limit, tt.wantLimit)
+			}
+
+			err := tt.filter.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error: %v, wantErr: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEntry_ValidateForCreate(t *testing.T) {
+	entry := Entry{ActorID: " admin ", Action: " "}
+	entry.Sanitize()
+	if entry.ActorID != "admin" {
+		t.Errorf("got actor: %q, expected: admin", entry.ActorID)
+	}
+
+	if entry.ValidateForCreate() == nil {
+		t.Errorf("expected entry without an action to be invalid")
+	}
+
+	entry.Action = ActionImpersonatedWrite
+	if err := entry.ValidateForCreate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/naughtygopher/errors"
+)
+
+var QueryTimeoutDuration = 5 * time.Second
+
+type pgstore struct {
+	pqdriver  *pgxpool.Pool
+	tableName string
+}
+
+func (ps *pgstore) SaveEntry(ctx context.Context, entry *Entry) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (id, actor_id, user_id, action, method, path, status, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	entry.ID = uuid.NewString()
+	_, err := ps.pqdriver.Exec(
+		ctx,
+		query,
+		entry.ID,
+		entry.ActorID,
+		sql.NullString{String: entry.UserID, Valid: entry.UserID != ""},
+		entry.Action,
+		entry.Method,
+		entry.Path,
+		entry.Status,
+		entry.Details,
+		entry.CreatedAt,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed storing audit entry")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) ListEntries(ctx context.Context, filter *Filter) ([]Entry, error) {
+	query := fmt.Sprintf(`
+		SELECT id, actor_id, user_id, action, method, path, status, details, created_at
+		FROM %s
+		WHERE ($1 = '' OR actor_id = NULLIF($1, '')::uuid)
+			AND ($2 = '' OR user_id = NULLIF($2, '')::uuid)
+		ORDER BY created_at DESC
+		LIMIT $3`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, filter.ActorID, filter.UserID, filter.Limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing audit entries")
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0)
+	for rows.Next() {
+		entry := Entry{}
+		actorID := new(uuid.NullUUID)
+		userID := new(uuid.NullUUID)
+		err := rows.Scan(
+			&entry.ID,
+			actorID,
+			userID,
+			&entry.Action,
+			&entry.Method,
+			&entry.Path,
+			&entry.Status,
+			&entry.Details,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading audit entry")
+		}
+
+		// the users are kept as null in the trail once deleted
+		if actorID.Valid {
+			entry.ActorID = actorID.UUID.String()
+		}
+		if userID.Valid {
+			entry.UserID = userID.UUID.String()
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed listing audit entries")
+	}
+
+	return entries, nil
+}
+
+func NewPostgresStore(pqdriver *pgxpool.Pool, tableName string) store {
+	return &pgstore{
+		pqdriver:  pqdriver,
+		tableName: tableName,
+	}
+}
@@ -1,13 +1,27 @@
 package configs
 
 import (
+	"encoding/base64"
+	"math"
+	stdhttp "net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/baobei23/goapp/cmd/server/http"
 	"github.com/baobei23/goapp/internal/pkg/jwt"
+	"github.com/baobei23/goapp/internal/pkg/mailer"
+	"github.com/baobei23/goapp/internal/pkg/oidc"
+	"github.com/baobei23/goapp/internal/pkg/password"
 	"github.com/baobei23/goapp/internal/pkg/postgres"
+	"github.com/baobei23/goapp/internal/pkg/secretbox"
+	"github.com/baobei23/goapp/internal/sso"
+	"github.com/baobei23/goapp/internal/tokens"
+	"github.com/baobei23/goapp/internal/usernotes"
+	"github.com/baobei23/goapp/internal/users"
+	"github.com/naughtygopher/errors"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type env string
@@ -35,16 +49,47 @@ type Configs struct {
 // HTTP returns the configuration required for HTTP package
 func (cfg *Configs) HTTP() (*http.Config, error) {
 	return &http.Config{
-		EnableAccessLog:   (cfg.Environment == EnvLocal) || (cfg.Environment == EnvTest),
-		TemplatesBasePath: strings.TrimSpace(os.Getenv("TEMPLATES_BASEPATH")),
-		Port:              8080,
-		ReadTimeout:       time.Second * 5,
-		WriteTimeout:      time.Second * 5,
-		DialTimeout:       time.Second * 3,
-		EnableTracing:     cfg.EnableTracing,
+		RequireVerifiedEmail:    cfg.emailVerificationPolicy() == emailVerificationRestrict,
+		Cookies:                 cfg.cookies(),
+		EnableAccessLog:         (cfg.Environment == EnvLocal) || (cfg.Environment == EnvTest),
+		TemplatesBasePath:       strings.TrimSpace(os.Getenv("TEMPLATES_BASEPATH")),
+		Port:                    8080,
+		ReadTimeout:             time.Second * 5,
+		WriteTimeout:            time.Second * 5,
+		DialTimeout:             time.Second * 3,
+		EnableTracing:           cfg.EnableTracing,
+		BlockImpersonatedWrites: os.Getenv("IMPERSONATION_READ_ONLY") == "true",
 	}, nil
 }
 
+// cookies returns the configuration of the session cookies. Cookies are secure (i.e. only sent
+// over HTTPS) unless running locally, or explicitly disabled using COOKIE_SECURE
+func (cfg *Configs) cookies() http.CookieConfig {
+	secure := cfg.Environment != EnvLocal
+	switch os.Getenv("COOKIE_SECURE") {
+	case "true":
+		secure = true
+	case "false":
+		secure = false
+	}
+
+	sameSite := stdhttp.SameSiteLaxMode
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "strict":
+		sameSite = stdhttp.SameSiteStrictMode
+	case "none":
+		// browsers reject SameSite=None cookies which are not secure
+		sameSite = stdhttp.SameSiteNoneMode
+		secure = true
+	}
+
+	return http.CookieConfig{
+		Domain:   strings.TrimSpace(os.Getenv("COOKIE_DOMAIN")),
+		Secure:   secure,
+		SameSite: sameSite,
+	}
+}
+
 func (cfg *Configs) Postgres() *postgres.Config {
 	return &postgres.Config{
 		Host:    os.Getenv("POSTGRES_HOST"),
@@ -65,11 +110,213 @@ func (cfg *Configs) Postgres() *postgres.Config {
 	}
 }
 
-func (cfg *Configs) JWT() *jwt.TokenManager {
+// JWT returns the token manager. Tokens are signed with the asymmetric keys in JWT_KEYS_DIR if
+// it's set, or with JWT_SECRET (HS256) otherwise
+func (cfg *Configs) JWT() (*jwt.TokenManager, error) {
+	var keys *jwt.Keyring
+	keysDir := strings.TrimSpace(os.Getenv("JWT_KEYS_DIR"))
+	if keysDir != "" {
+		var err error
+		keys, err = jwt.LoadKeyring(keysDir, strings.TrimSpace(os.Getenv("JWT_SIGNING_KEY_ID")))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed loading JWT keys")
+		}
+	} else {
+		// tokens signed with an empty secret could be forged by anyone
+		secret := os.Getenv("JWT_SECRET")
+		if strings.TrimSpace(secret) == "" {
+			return nil, errors.Validation("either JWT_SECRET or JWT_KEYS_DIR should be set")
+		}
+		keys = jwt.NewHMACKeyring(secret)
+	}
+
+	issuer := strings.TrimSpace(os.Getenv("JWT_ISSUER"))
+	if issuer == "" {
+		issuer = cfg.AppName
+	}
+
+	audiences := envList("JWT_AUDIENCES")
+	if len(audiences) == 0 && cfg.AppName != "" {
+		audiences = []string{cfg.AppName}
+	}
+
 	return &jwt.TokenManager{
-		SecretKey:     os.Getenv("JWT_SECRET"),
-		AccessExpiry:  15 * time.Minute,
-		RefreshExpiry: 24 * time.Hour,
+		Keys:                keys,
+		AccessExpiry:        15 * time.Minute,
+		RefreshExpiry:       24 * time.Hour,
+		MFAPendingExpiry:    5 * time.Minute,
+		ImpersonationExpiry: time.Duration(envUint("IMPERSONATION_TOKEN_MINUTES", 10)) * time.Minute,
+		Issuer:              issuer,
+		Audiences:           audiences,
+		Leeway:              time.Duration(envUint("JWT_LEEWAY_SECONDS", 30)) * time.Second,
+	}, nil
+}
+
+func (cfg *Configs) Users() *users.Config {
+	return &users.Config{
+		PasswordResetExpiry:       30 * time.Minute,
+		EmailVerificationExpiry:   48 * time.Hour,
+		EmailVerificationInterval: 2 * time.Minute,
+		PasswordResetInterval:     2 * time.Minute,
+		RejectUnverifiedLogin:     cfg.emailVerificationPolicy() == emailVerificationReject,
+		LoginThrottle: users.LoginThrottleConfig{
+			FreeAttempts:         3,
+			BackoffBase:          time.Second,
+			BackoffMax:           time.Minute,
+			AccountLockThreshold: int(envUint("LOGIN_LOCK_THRESHOLD", 10)),
+			IPLockThreshold:      int(envUint("LOGIN_IP_LOCK_THRESHOLD", 100)),
+			LockDuration:         time.Duration(envUint("LOGIN_LOCK_MINUTES", 15)) * time.Minute,
+			FailureWindow:        time.Hour,
+		},
+		MFAIssuer:    cfg.AppName,
+		ReauthMaxAge: 5 * time.Minute,
+	}
+}
+
+func (cfg *Configs) Tokens() *tokens.Config {
+	return &tokens.Config{
+		RevocationCacheTTL:      time.Duration(envUint("TOKEN_REVOCATION_CACHE_SECONDS", 30)) * time.Second,
+		RevocationPurgeInterval: 10 * time.Minute,
+	}
+}
+
+func (cfg *Configs) UserNotes() (*usernotes.Config, error) {
+	// notes in the trash would be purged right away, or never for an overflowing duration
+	retentionDays := envUint("NOTES_TRASH_RETENTION_DAYS", 30)
+	if retentionDays < 1 || retentionDays > math.MaxInt64/uint64(24*time.Hour) {
+		return nil, errors.Validation("NOTES_TRASH_RETENTION_DAYS should be a positive number of days")
+	}
+
+	return &usernotes.Config{
+		DefaultPageSize:    int(envUint("NOTES_PAGE_SIZE", 20)),
+		MaxPageSize:        int(envUint("NOTES_MAX_PAGE_SIZE", 100)),
+		TrashRetention:     time.Duration(retentionDays) * 24 * time.Hour,
+		TrashPurgeInterval: time.Hour,
+	}, nil
+}
+
+func (cfg *Configs) SSO() *sso.Config {
+	return &sso.Config{
+		StateExpiry: 10 * time.Minute,
+	}
+}
+
+// OIDCProviders returns the external identity providers listed in OIDC_PROVIDERS. Each provider
+// is configured with the OIDC_<NAME>_* variables, e.g. OIDC_GOOGLE_ISSUER for the provider google
+func (cfg *Configs) OIDCProviders() ([]*oidc.Config, error) {
+	names := envList("OIDC_PROVIDERS")
+	providers := make([]*oidc.Config, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		provider := &oidc.Config{
+			Name:         name,
+			Issuer:       strings.TrimSpace(os.Getenv(prefix + "ISSUER")),
+			ClientID:     strings.TrimSpace(os.Getenv(prefix + "CLIENT_ID")),
+			ClientSecret: strings.TrimSpace(os.Getenv(prefix + "CLIENT_SECRET")),
+			RedirectURL:  strings.TrimSpace(os.Getenv(prefix + "REDIRECT_URL")),
+			Scopes:       envList(prefix + "SCOPES"),
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"email", "profile"}
+		}
+
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			return nil, errors.Validationf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL are required", prefix, prefix, prefix)
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
+// Mailer returns the email sender. Emails are only logged if no SMTP server is configured, which
+// is allowed in local and test environments only since the emails have tokens in them
+func (cfg *Configs) Mailer() (mailer.Sender, error) {
+	host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
+	if host == "" {
+		if cfg.Environment != EnvLocal && cfg.Environment != EnvTest {
+			return nil, errors.Validationf("SMTP_HOST is required in %s environment", cfg.Environment)
+		}
+		return mailer.NewLogSender(), nil
+	}
+
+	return mailer.NewSMTPSender(&mailer.SMTPConfig{
+		Host:     host,
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}), nil
+}
+
+// PasswordHasher returns the password hasher. New passwords are hashed with argon2id, while
+// bcrypt hashes of existing users can still be verified (and are upgraded on login)
+func (cfg *Configs) PasswordHasher() (*password.Hasher, error) {
+	params := password.DefaultArgon2idParams()
+	memory := envUint("ARGON2_MEMORY_KIB", uint64(params.Memory))
+	iterations := envUint("ARGON2_ITERATIONS", uint64(params.Iterations))
+	parallelism := envUint("ARGON2_PARALLELISM", uint64(params.Parallelism))
+	if memory > math.MaxUint32 || iterations > math.MaxUint32 || parallelism > math.MaxUint8 {
+		return nil, errors.Validation("ARGON2_MEMORY_KIB and ARGON2_ITERATIONS must fit in 32 bits, ARGON2_PARALLELISM in 8 bits")
+	}
+
+	params.Memory = uint32(memory)
+	params.Iterations = uint32(iterations)
+	params.Parallelism = uint8(parallelism)
+	err := params.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ARGON2_* configuration")
+	}
+
+	return password.New(
+		password.NewArgon2id(params),
+		password.NewBcrypt(bcrypt.DefaultCost),
+	), nil
+}
+
+// SecretBox returns the cipher used to encrypt secrets stored at rest, e.g. TOTP secrets.
+// The key is expected to be base64 encoded. If no key is configured, nil is returned and
+// two-factor authentication is disabled.
+func (cfg *Configs) SecretBox() (*secretbox.Box, error) {
+	encoded := strings.TrimSpace(os.Getenv("MFA_ENCRYPTION_KEY"))
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != secretbox.KeyLength {
+		return nil, errors.Validationf(
+			"MFA_ENCRYPTION_KEY should be a base64 encoded %d byte key, e.g. generated using `openssl rand -base64 %d`",
+			secretbox.KeyLength,
+			secretbox.KeyLength,
+		)
+	}
+
+	return secretbox.New(key)
+}
+
+type emailVerificationPolicy string
+
+const (
+	// emailVerificationNone lets unverified users use the app without any restrictions
+	emailVerificationNone emailVerificationPolicy = "none"
+	// emailVerificationRestrict lets unverified users login, but not access protected APIs
+	emailVerificationRestrict emailVerificationPolicy = "restrict"
+	// emailVerificationReject does not let unverified users login
+	emailVerificationReject emailVerificationPolicy = "reject"
+)
+
+func (cfg *Configs) emailVerificationPolicy() emailVerificationPolicy {
+	switch emailVerificationPolicy(os.Getenv("EMAIL_VERIFICATION_POLICY")) {
+	case emailVerificationRestrict:
+		return emailVerificationRestrict
+	case emailVerificationReject:
+		return emailVerificationReject
+	default:
+		return emailVerificationNone
 	}
 }
 
@@ -81,6 +328,27 @@ func (cfg *Configs) UserNotesPostgresTable() string {
 	return "user_notes"
 }
 
+// envUint returns the environment variable parsed as an unsigned integer, or the fallback if it's not set or invalid
+func envUint(key string, fallback uint64) uint64 {
+	value, err := strconv.ParseUint(strings.TrimSpace(os.Getenv(key)), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// envList returns the comma separated values of the environment variable, ignoring empty ones
+func envList(key string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func loadEnv() env {
 	switch env(os.Getenv("ENV")) {
 	case EnvLocal:
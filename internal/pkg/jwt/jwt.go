@@ -1,68 +1,217 @@
 package jwt
 
 import (
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/naughtygopher/errors"
 )
 
 type TokenManager struct {
-	SecretKey     string        `json:"secretKey"`
-	AccessExpiry  time.Duration `json:"accessExpiry"`
-	RefreshExpiry time.Duration `json:"refreshExpiry"`
+	// Keys is the keyring tokens are signed and verified with
+	Keys             *Keyring      `json:"-"`
+	AccessExpiry     time.Duration `json:"accessExpiry"`
+	RefreshExpiry    time.Duration `json:"refreshExpiry"`
+	MFAPendingExpiry time.Duration `json:"mfaPendingExpiry"`
+	// ImpersonationExpiry is the expiry of the access tokens issued to admins acting as a user
+	ImpersonationExpiry time.Duration `json:"impersonationExpiry"`
+	// Issuer is the `iss` claim of the tokens. Tokens from any other issuer are rejected
+	Issuer string `json:"issuer"`
+	// Audiences are the clients tokens can be issued for, the first one being the default.
+	// Every token is issued for a single audience, and only these audiences are accepted
+	Audiences []string `json:"audiences"`
+	// Leeway is the clock skew tolerated when validating the time based claims
+	Leeway time.Duration `json:"leeway"`
 }
 
 type Claims struct {
-	UserID    string `json:"userID"`
-	Email     string `json:"email"`
-	TokenType string `json:"tokenType"` // "access" or "refresh"
+	UserID        string   `json:"userID"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"emailVerified"`
+	Roles         []string `json:"roles,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	TokenType     string   `json:"tokenType"` // "access", "refresh" or "mfa_pending"
+	// FamilyID is the refresh token family (i.e. the login) the access/refresh token belongs to
+	FamilyID string `json:"fid,omitempty"`
+	// Actor is set if the token was issued to someone else acting as the user
+	Actor *Actor `json:"act,omitempty"`
+	// AuthTime is when the user logged in, it's carried over to the refreshed tokens
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor is the party acting on behalf of the subject of the token, as in the `act` claim of
+// RFC 8693. e.g. an admin impersonating a user
+type Actor struct {
+	UserID string `json:"sub"`
+}
+
+// ActorID returns the ID of the user acting as the subject, if the token was issued for impersonation
+func (c *Claims) ActorID() string {
+	if c.Actor == nil {
+		return ""
+	}
+	return c.Actor.UserID
+}
+
+// IssuedFor returns the audience the token was issued for
+func (c *Claims) IssuedFor() string {
+	if len(c.Audience) == 0 {
+		return ""
+	}
+	return c.Audience[0]
+}
+
+// Subject is the identity for which tokens are generated
+type Subject struct {
+	UserID        string
+	Email         string
+	EmailVerified bool
+	Roles         []string
+	Permissions   []string
+	// FamilyID is the refresh token family, all refresh tokens issued since a login share it
+	FamilyID string
+	// Audience is the client the tokens are issued for, the default audience is used if empty
+	Audience string
+	// ActorID is the user acting as the subject, if the tokens are issued for impersonation
+	ActorID string
+	// AuthTime is when the user logged in
+	AuthTime time.Time
+}
+
+// Pair is a newly generated access and refresh token pair
+type Pair struct {
+	AccessToken  string
+	RefreshToken string
+	// Refresh is the claims of the refresh token, required to keep track of it
+	Refresh *Claims
+}
+
 func NewManager(secret string, accessMinutes, refreshHours int) *TokenManager {
 	return &TokenManager{
-		SecretKey:     secret,
+		Keys:          NewHMACKeyring(secret),
 		AccessExpiry:  time.Duration(accessMinutes) * time.Minute,
 		RefreshExpiry: time.Duration(refreshHours) * time.Hour,
 	}
 }
 
 // GeneratePair generates both access and refresh tokens
-func (tm *TokenManager) GeneratePair(userID, email string) (accessToken, refreshToken string, err error) {
-	accessToken, err = tm.generate(userID, email, "access", tm.AccessExpiry)
+func (tm *TokenManager) GeneratePair(sub *Subject) (*Pair, error) {
+	accessToken, _, err := tm.generate(sub, "access", tm.AccessExpiry)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	refreshToken, err = tm.generate(userID, email, "refresh", tm.RefreshExpiry)
+	refreshToken, refreshClaims, err := tm.generate(sub, "refresh", tm.RefreshExpiry)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+
+	return &Pair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Refresh:      refreshClaims,
+	}, nil
+}
+
+// GenerateMFAPending generates a short-lived token for a user who has passed the first step of
+// login. It can only be exchanged for a token pair along with a valid second factor.
+func (tm *TokenManager) GenerateMFAPending(userID, audience string) (string, error) {
+	token, _, err := tm.generate(&Subject{UserID: userID, Audience: audience}, "mfa_pending", tm.MFAPendingExpiry)
+	return token, err
+}
+
+// GenerateImpersonation generates a short-lived access token for the actor to act as the subject.
+// No refresh token is issued, the actor has to start over once it expires
+func (tm *TokenManager) GenerateImpersonation(sub *Subject) (string, *Claims, error) {
+	if sub.ActorID == "" {
+		return "", nil, errors.Validation("actor is required for impersonation")
 	}
 
-	return accessToken, refreshToken, nil
+	impersonated := *sub
+	impersonated.FamilyID = ""
+
+	return tm.generate(&impersonated, "access", tm.ImpersonationExpiry)
 }
 
-func (tm *TokenManager) generate(userID, email, tokenType string, expiry time.Duration) (string, error) {
-	claims := Claims{
-		UserID:    userID,
-		Email:     email,
-		TokenType: tokenType,
+// ResolveAudience returns the audience tokens are to be issued for. An empty audience resolves
+// to the default one, while unknown audiences are rejected.
+func (tm *TokenManager) ResolveAudience(audience string) (string, error) {
+	if len(tm.Audiences) == 0 {
+		if audience != "" {
+			return "", errors.Validationf("unknown audience %q", audience)
+		}
+		return "", nil
+	}
+
+	if audience == "" {
+		return tm.Audiences[0], nil
+	}
+
+	if !slices.Contains(tm.Audiences, audience) {
+		return "", errors.Validationf("unknown audience %q", audience)
+	}
+
+	return audience, nil
+}
+
+func (tm *TokenManager) generate(sub *Subject, tokenType string, expiry time.Duration) (string, *Claims, error) {
+	audience, err := tm.ResolveAudience(sub.Audience)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var audClaim jwt.ClaimStrings
+	if audience != "" {
+		audClaim = jwt.ClaimStrings{audience}
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID:        sub.UserID,
+		Email:         sub.Email,
+		EmailVerified: sub.EmailVerified,
+		Roles:         sub.Roles,
+		Permissions:   sub.Permissions,
+		TokenType:     tokenType,
+		FamilyID:      sub.FamilyID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+			Issuer:    tm.Issuer,
+			Audience:  audClaim,
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(tm.SecretKey))
+	if sub.ActorID != "" {
+		claims.Actor = &Actor{UserID: sub.ActorID}
+	}
+	if !sub.AuthTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(sub.AuthTime)
+	}
+
+	key := tm.Keys.Signing()
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signed, claims, nil
 }
 
-// Validate validates the token and returns the claims.
-// You can optionally pass expectedType ("access" or "refresh") to enforce token type.
+// Validate validates the token and returns the claims. Only tokens signed with one of the
+// algorithms of the keyring, by the configured issuer, for one of the configured audiences,
+// are valid.
 func (tm *TokenManager) Validate(tokenStr string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		return []byte(tm.SecretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, tm.verificationKey, tm.parserOptions()...)
 	if err != nil {
 		return nil, errors.Unauthorized("invalid token")
 	}
@@ -73,11 +222,62 @@ func (tm *TokenManager) Validate(tokenStr string) (*Claims, error) {
 	return nil, errors.Unauthorized("invalid claims")
 }
 
+func (tm *TokenManager) parserOptions() []jwt.ParserOption {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(tm.Keys.Methods()),
+		jwt.WithLeeway(tm.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+
+	if tm.Issuer != "" {
+		options = append(options, jwt.WithIssuer(tm.Issuer))
+	}
+
+	if len(tm.Audiences) > 0 {
+		options = append(options, jwt.WithAudience(tm.Audiences...))
+	}
+
+	return options
+}
+
+// verificationKey returns the key the token was signed with, as identified by its `kid` header
+func (tm *TokenManager) verificationKey(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := tm.Keys.Key(kid)
+	if !ok {
+		return nil, errors.Unauthorized("unknown signing key")
+	}
+
+	// the algorithm is decided by the key, not by the token, e.g. a token signed with HS256
+	// using a public key as the secret must not be accepted
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, errors.Unauthorized("unexpected signing method")
+	}
+
+	return key.Public, nil
+}
+
+// JWKS returns the public keys tokens can be verified with
+func (tm *TokenManager) JWKS() *JWKS {
+	return tm.Keys.JWKS()
+}
+
 // GetAccessExpiry returns the duration for access token expiration
 func (tm *TokenManager) GetAccessExpiry() time.Duration {
 	return tm.AccessExpiry
 }
 
+// GetMFAPendingExpiry returns the duration for MFA pending token expiration
+func (tm *TokenManager) GetMFAPendingExpiry() time.Duration {
+	return tm.MFAPendingExpiry
+}
+
+// GetImpersonationExpiry returns the duration for impersonation token expiration
+func (tm *TokenManager) GetImpersonationExpiry() time.Duration {
+	return tm.ImpersonationExpiry
+}
+
 // GetRefreshExpiry returns the duration for refresh token expiration
 func (tm *TokenManager) GetRefreshExpiry() time.Duration {
 	return tm.RefreshExpiry
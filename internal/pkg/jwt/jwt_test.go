@@ -0,0 +1,191 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenManager_Validate(t *testing.T) {
+	tm := &TokenManager{
+		Keys:         NewHMACKeyring("secret"),
+		AccessExpiry: time.Minute,
+		Issuer:       "goapp",
+		Audiences:    []string{"web", "mobile"},
+		Leeway:       30 * time.Second,
+	}
+
+	sign := func(claims *Claims) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	now := time.Now()
+	claims := func(modify func(rc *jwt.RegisteredClaims)) *Claims {
+		c := &Claims{
+			UserID: "user",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "goapp",
+				Audience:  jwt.ClaimStrings{"mobile"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+				NotBefore: jwt.NewNumericDate(now),
+				IssuedAt:  jwt.NewNumericDate(now),
+			},
+		}
+		modify(&c.RegisteredClaims)
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			token: sign(claims(func(rc *jwt.RegisteredClaims) {})),
+		},
+		{
+			name: "expired within leeway",
+			token: sign(claims(func(rc *jwt.RegisteredClaims) {
+				rc.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second))
+			})),
+		},
+		{
+			name: "expired",
+			token: sign(claims(func(rc *jwt.RegisteredClaims) {
+				rc.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+			})),
+			wantErr: true,
+		},
+		{
+			name: "no expiry",
+			token: sign(claims(func(rc *jwt.RegisteredClaims) {
+				rc.ExpiresAt = nil
+			})),
+			wantErr: true,
+		},
+		{
+			name: "not yet valid",
+			token: sign(claims(func(rc *jwt.RegisteredClaims) {
+				rc.NotBefore = jwt.NewNumericDate(now.Add(time.Minute))
+			})),
+			wantErr: true,
+		},
+		{
+			name: "other issuer",
+			token: sign(claims(func(rc *jwt.RegisteredClaims) {
+				rc.Issuer = "someone-else"
+			})),
+			wantErr: true,
+		},
+		{
+			name: "other audience",
+			token: sign(claims(func(rc *jwt.RegisteredClaims) {
+				rc.Audience = jwt.ClaimStrings{"partner"}
+			})),
+			wantErr: true,
+		},
+		{
+			name: "no audience",
+			token: sign(claims(func(rc *jwt.RegisteredClaims) {
+				rc.Audience = nil
+			})),
+			wantErr: true,
+		},
+		{
+			name:    "unsigned",
+			token:   unsigned(t, claims(func(rc *jwt.RegisteredClaims) {})),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tm.Validate(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error: %v, wantErr: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func unsigned(t *testing.T, claims *Claims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestTokenManager_ResolveAudience(t *testing.T) {
+	tm := &TokenManager{
+		Keys:         NewHMACKeyring("secret"),
+		AccessExpiry: time.Minute,
+		Audiences:    []string{"web", "mobile"},
+	}
+
+	pair, err := tm.GeneratePair(&Subject{UserID: "user", Audience: "mobile"})
+	if err != nil {
+		t.Fatalf("generate: %+v", err)
+	}
+
+	claims, err := tm.Validate(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("validate: %+v", err)
+	}
+
+	if claims.IssuedFor() != "mobile" {
+		t.Errorf("got: %s, expected: mobile", claims.IssuedFor())
+	}
+
+	audience, _ := tm.ResolveAudience("")
+	if audience != "web" {
+		t.Errorf("got: %s, expected the default audience web", audience)
+	}
+
+	_, err = tm.GeneratePair(&Subject{UserID: "user", Audience: "partner"})
+	if err == nil {
+		t.Errorf("expected generating tokens for an unknown audience to fail")
+	}
+}
+
+func TestTokenManager_GenerateImpersonation(t *testing.T) {
+	tm := &TokenManager{
+		Keys:                NewHMACKeyring("secret"),
+		ImpersonationExpiry: 5 * time.Minute,
+	}
+
+	_, _, err := tm.GenerateImpersonation(&Subject{UserID: "user"})
+	if err == nil {
+		t.Fatalf("expected impersonation without an actor to fail")
+	}
+
+	token, _, err := tm.GenerateImpersonation(&Subject{UserID: "user", ActorID: "admin", FamilyID: "family"})
+	if err != nil {
+		t.Fatalf("generate: %+v", err)
+	}
+
+	claims, err := tm.Validate(token)
+	if err != nil {
+		t.Fatalf("validate: %+v", err)
+	}
+
+	if claims.ActorID() != "admin" || claims.UserID != "user" || claims.TokenType != "access" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	// impersonation tokens are not part of any login, and cannot be refreshed
+	if claims.FamilyID != "" {
+		t.Errorf("got family: %s, expected none", claims.FamilyID)
+	}
+
+	if expiry := claims.ExpiresAt.Sub(claims.IssuedAt.Time); expiry != 5*time.Minute {
+		t.Errorf("got expiry: %s, expected: %s", expiry, 5*time.Minute)
+	}
+}
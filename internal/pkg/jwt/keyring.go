@@ -0,0 +1,330 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/naughtygopher/errors"
+)
+
+// Key is a key used to sign and/or verify tokens. Keys without a private part can only be used
+// for verification, e.g. a retired signing key whose tokens have not expired yet.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private is the key used for signing, it's nil for verification-only keys
+	Private any
+	// Public is the key used for verification
+	Public any
+}
+
+// Keyring holds the key tokens are signed with, along with all the keys accepted for
+// verification. Tokens carry the ID of the key they were signed with in the `kid` header.
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// Signing returns the key new tokens are signed with
+func (kr *Keyring) Signing() *Key {
+	return kr.signing
+}
+
+// Key returns the verification key with the given ID
+func (kr *Keyring) Key(kid string) (*Key, bool) {
+	key, ok := kr.keys[kid]
+	return key, ok
+}
+
+// Methods returns the signing algorithms of all the keys
+func (kr *Keyring) Methods() []string {
+	methods := make([]string, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		if !slices.Contains(methods, key.Method.Alg()) {
+			methods = append(methods, key.Method.Alg())
+		}
+	}
+	sort.Strings(methods)
+
+	return methods
+}
+
+// NewKeyring returns a keyring which signs tokens with the key identified by signingKID. All
+// the keys are accepted for verification.
+func NewKeyring(signingKID string, keys ...*Key) (*Keyring, error) {
+	kr := &Keyring{
+		keys: make(map[string]*Key, len(keys)),
+	}
+
+	for _, key := range keys {
+		if key.Method == nil || key.Public == nil {
+			return nil, errors.Validationf("key %q has no method or public key", key.ID)
+		}
+
+		_, exists := kr.keys[key.ID]
+		if exists {
+			return nil, errors.Validationf("duplicate key %q", key.ID)
+		}
+
+		kr.keys[key.ID] = key
+	}
+
+	signing, ok := kr.keys[signingKID]
+	if !ok {
+		return nil, errors.Validationf("signing key %q not found", signingKID)
+	}
+
+	if signing.Private == nil {
+		return nil, errors.Validationf("signing key %q has no private key", signingKID)
+	}
+
+	kr.signing = signing
+
+	return kr, nil
+}
+
+// NewHMACKeyring returns a keyring which signs and verifies tokens with a shared secret (HS256).
+// Since the secret cannot be published, such tokens can only be verified by this app.
+func NewHMACKeyring(secret string) *Keyring {
+	key := &Key{
+		Method:  jwt.SigningMethodHS256,
+		Private: []byte(secret),
+		Public:  []byte(secret),
+	}
+
+	return &Keyring{
+		signing: key,
+		keys:    map[string]*Key{key.ID: key},
+	}
+}
+
+// NewKey returns a key for the given private or public key (RSA, ECDSA P-256 or Ed25519), with
+// the signing method inferred from its type
+func NewKey(kid string, privateOrPublic any) (*Key, error) {
+	key := &Key{ID: kid}
+
+	switch k := privateOrPublic.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case *ecdsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodES256, k, &k.PublicKey
+	case *ecdsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodES256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, errors.Validationf("key %q has an unsupported type %T", kid, privateOrPublic)
+	}
+
+	ecKey, ok := key.Public.(*ecdsa.PublicKey)
+	if ok && ecKey.Curve != elliptic.P256() {
+		return nil, errors.Validationf("key %q is not on curve P-256, required for ES256", kid)
+	}
+
+	return key, nil
+}
+
+// ParsePEM parses a PEM encoded private (PKCS#8, PKCS#1 or SEC 1) or public (PKIX) key
+func ParsePEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Validationf("key %q is not PEM encoded", kid)
+	}
+
+	var (
+		parsed any
+		err    error
+	)
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errors.Validationf("key %q has an unsupported PEM type %q", kid, block.Type)
+	}
+	if err != nil {
+		return nil, errors.ValidationErrf(err, "failed parsing key %q", kid)
+	}
+
+	return NewKey(kid, parsed)
+}
+
+// LoadKeyring loads all the `<kid>.pem` files in the directory as keys, and signs tokens with
+// the one identified by signingKID
+func LoadKeyring(dir string, signingKID string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing keys")
+	}
+	sort.Strings(paths)
+
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed reading key %s", path)
+		}
+
+		key, err := ParsePEM(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return NewKeyring(signingKID, keys...)
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// PublicKey returns the public key of the JWK, for RSA, EC (P-256, P-384, P-521) and Ed25519 keys
+func (jwk *JWK) PublicKey() (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, errors.ValidationErrf(err, "invalid modulus of key %q", jwk.KeyID)
+		}
+
+		e, err := decode(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.Validationf("invalid exponent of key %q", jwk.KeyID)
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Validationf("unsupported curve %q of key %q", jwk.Curve, jwk.KeyID)
+		}
+
+		x, errX := decode(jwk.X)
+		y, errY := decode(jwk.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.Validationf("invalid coordinates of key %q", jwk.KeyID)
+		}
+
+		// uncompressed point, i.e. 0x04 || X || Y
+		point := append(append([]byte{4}, x...), y...)
+		pub, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+		if err != nil {
+			return nil, errors.ValidationErrf(err, "invalid point of key %q", jwk.KeyID)
+		}
+
+		return pub, nil
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil || jwk.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.Validationf("invalid Ed25519 key %q", jwk.KeyID)
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errors.Validationf("unsupported key type %q of key %q", jwk.KeyType, jwk.KeyID)
+	}
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the keyring. Symmetric keys are never included.
+func (kr *Keyring) JWKS() *JWKS {
+	jwks := &JWKS{Keys: make([]JWK, 0, len(kr.keys))}
+	for _, key := range kr.keys {
+		jwk, ok := key.jwk()
+		if ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+
+	return jwks
+}
+
+func (key *Key) jwk() (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{
+		KeyID:     key.ID,
+		Use:       "sig",
+		Algorithm: key.Method.Alg(),
+	}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdhKey, err := pub.ECDH()
+		if err != nil {
+			return JWK{}, false
+		}
+		// uncompressed point, i.e. 0x04 || X || Y with both coordinates padded to the curve size
+		point := ecdhKey.Bytes()[1:]
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = b64(point[:len(point)/2])
+		jwk.Y = b64(point[len(point)/2:])
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = b64(pub)
+	default:
+		return JWK{}, false
+	}
+
+	return jwk, true
+}
@@ -0,0 +1,149 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testKeys(t *testing.T) map[string]any {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]any{"RS256": rsaKey, "ES256": ecKey, "EdDSA": edKey}
+}
+
+func newTestManager(keys *Keyring) *TokenManager {
+	return &TokenManager{Keys: keys, AccessExpiry: time.Minute, RefreshExpiry: time.Hour}
+}
+
+func TestTokenManager_AsymmetricKeys(t *testing.T) {
+	for alg, private := range testKeys(t) {
+		t.Run(alg, func(t *testing.T) {
+			der, err := x509.MarshalPKCS8PrivateKey(private)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			key, err := ParsePEM("key-1", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+			if err != nil {
+				t.Fatalf("parse: %+v", err)
+			}
+
+			if key.Method.Alg() != alg {
+				t.Errorf("got: %s, expected: %s", key.Method.Alg(), alg)
+			}
+
+			keys, err := NewKeyring("key-1", key)
+			if err != nil {
+				t.Fatalf("keyring: %+v", err)
+			}
+
+			tm := newTestManager(keys)
+			pair, err := tm.GeneratePair(&Subject{UserID: "user"})
+			if err != nil {
+				t.Fatalf("generate: %+v", err)
+			}
+
+			claims, err := tm.Validate(pair.AccessToken)
+			if err != nil {
+				t.Fatalf("validate: %+v", err)
+			}
+
+			if claims.UserID != "user" {
+				t.Errorf("got: %s, expected: user", claims.UserID)
+			}
+
+			jwks := tm.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "key-1" || jwks.Keys[0].Algorithm != alg {
+				t.Errorf("unexpected JWKS: %+v", jwks)
+			}
+
+			public, err := jwks.Keys[0].PublicKey()
+			if err != nil {
+				t.Fatalf("public key: %+v", err)
+			}
+
+			if !public.(interface{ Equal(crypto.PublicKey) bool }).Equal(key.Public) {
+				t.Errorf("public key parsed from the JWK does not match")
+			}
+		})
+	}
+}
+
+func TestTokenManager_KeyRotation(t *testing.T) {
+	keys := testKeys(t)
+
+	oldKey, _ := NewKey("old", keys["RS256"])
+	newKey, _ := NewKey("new", keys["ES256"])
+
+	oldRing, _ := NewKeyring("old", oldKey)
+	token, _, err := newTestManager(oldRing).generate(&Subject{UserID: "user"}, "access", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the old key is retired, only its public part is kept for verification
+	retired, _ := NewKey("old", oldKey.Public)
+	newRing, err := NewKeyring("new", newKey, retired)
+	if err != nil {
+		t.Fatalf("keyring: %+v", err)
+	}
+
+	_, err = newTestManager(newRing).Validate(token)
+	if err != nil {
+		t.Errorf("expected token signed with the retired key to be valid: %+v", err)
+	}
+
+	onlyNew, _ := NewKeyring("new", newKey)
+	_, err = newTestManager(onlyNew).Validate(token)
+	if err == nil {
+		t.Errorf("expected token signed with a removed key to be invalid")
+	}
+
+	_, err = NewKeyring("old", retired)
+	if err == nil {
+		t.Errorf("expected signing with a public key to fail")
+	}
+}
+
+func TestTokenManager_AlgorithmConfusion(t *testing.T) {
+	key, _ := NewKey("key", testKeys(t)["RS256"])
+	keys, _ := NewKeyring("key", key)
+
+	// HS256 token using the (public) RSA modulus as the secret
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "user", TokenType: "access"})
+	token.Header["kid"] = "key"
+	signed, err := token.SignedString(key.Public.(*rsa.PublicKey).N.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newTestManager(keys).Validate(signed)
+	if err == nil {
+		t.Errorf("expected token signed with an unexpected algorithm to be invalid")
+	}
+}
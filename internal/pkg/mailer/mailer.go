@@ -0,0 +1,35 @@
+// Package mailer defines how the application sends emails. The actual delivery mechanism
+// is pluggable, any type implementing Sender can be used by the domain packages.
+package mailer
+
+import (
+	"context"
+
+	"github.com/baobei23/goapp/internal/pkg/logger"
+)
+
+// Message is a single email to be delivered
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email messages
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+type logSender struct{}
+
+// Send writes the message to the application logs instead of delivering it
+func (ls *logSender) Send(ctx context.Context, msg *Message) error {
+	logger.Info(ctx, "[mailer] outgoing email", msg)
+	return nil
+}
+
+// NewLogSender returns a Sender which only logs the messages. This is meant for
+// local development and testing, where no mail server is available.
+func NewLogSender() Sender {
+	return &logSender{}
+}
@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/naughtygopher/errors"
+)
+
+// SMTPConfig holds all the configuration required to send emails via an SMTP server
+type SMTPConfig struct {
+	Host     string `json:"host,omitempty"`
+	Port     string `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// From is the sender address set on all outgoing emails
+	From string `json:"from,omitempty"`
+}
+
+type smtpSender struct {
+	cfg *SMTPConfig
+}
+
+func (ss *smtpSender) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if ss.cfg.Username != "" {
+		auth = smtp.PlainAuth("", ss.cfg.Username, ss.cfg.Password, ss.cfg.Host)
+	}
+
+	body := strings.Join([]string{
+		fmt.Sprintf("From: %s", ss.cfg.From),
+		fmt.Sprintf("To: %s", msg.To),
+		fmt.Sprintf("Subject: %s", msg.Subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		msg.Body,
+	}, "\r\n")
+
+	err := smtp.SendMail(
+		net.JoinHostPort(ss.cfg.Host, ss.cfg.Port),
+		auth,
+		ss.cfg.From,
+		[]string{msg.To},
+		[]byte(body),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed sending email")
+	}
+
+	return nil
+}
+
+// NewSMTPSender returns a Sender which delivers emails using the SMTP server
+func NewSMTPSender(cfg *SMTPConfig) Sender {
+	return &smtpSender{
+		cfg: cfg,
+	}
+}
@@ -0,0 +1,368 @@
+// Package oidc is a client for OpenID Connect identity providers, logging in users using the
+// authorization code flow with PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/jwt"
+)
+
+// signingMethods are the algorithms ID tokens can be signed with. Symmetric algorithms are
+// deliberately not supported
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+const (
+	// keysRefreshInterval is how often the keys are fetched at most, when a token is signed with
+	// an unknown key
+	keysRefreshInterval = time.Minute
+	// leeway is the clock skew tolerated when validating ID tokens
+	leeway = time.Minute
+	// maxResponseSize is the maximum size of the responses read from the provider
+	maxResponseSize = 1 << 20
+)
+
+// Config is the configuration of an OpenID Connect provider
+type Config struct {
+	// Name identifies the provider in the login URLs, e.g. google
+	Name     string
+	Issuer   string
+	ClientID string
+	// ClientSecret is empty for public clients
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are requested in addition to openid
+	Scopes []string
+}
+
+// Discovery is the provider metadata published at /.well-known/openid-configuration
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is the user identity asserted by the ID token
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// flexibleBool is a boolean which some providers encode as a string
+type flexibleBool bool
+
+func (fb *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*fb = true
+	case "false", "null":
+		*fb = false
+	default:
+		return errors.Validationf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+type idTokenClaims struct {
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+	Name          string       `json:"name"`
+	gojwt.RegisteredClaims
+}
+
+// Provider is an OpenID Connect provider, caching its discovery document and signing keys
+type Provider struct {
+	cfg    *Config
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *Discovery
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// Name returns the name of the provider
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the URL of the provider the user is to be redirected to for logging in
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", errors.InternalErr(err, "invalid authorization endpoint")
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange exchanges the authorization code for the ID token, and returns the identity it asserts
+// after verifying it. The nonce must match the one the login was started with
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.InternalErr(err, "failed creating token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp := struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	status, err := p.do(req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK || resp.IDToken == "" {
+		return nil, errors.Unauthenticatedf("code exchange failed: %s %s", resp.Error, resp.ErrorDescription)
+	}
+
+	return p.verify(ctx, discovery, resp.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, discovery *Discovery, idToken, nonce string) (*Identity, error) {
+	claims := &idTokenClaims{}
+	_, err := gojwt.ParseWithClaims(
+		idToken,
+		claims,
+		func(t *gojwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.key(ctx, discovery, kid)
+		},
+		gojwt.WithValidMethods(signingMethods),
+		gojwt.WithIssuer(discovery.Issuer),
+		gojwt.WithAudience(p.cfg.ClientID),
+		gojwt.WithExpirationRequired(),
+		gojwt.WithIssuedAt(),
+		gojwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return nil, errors.UnauthenticatedErr(err, "invalid ID token")
+	}
+
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.Unauthenticated("invalid ID token nonce")
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.Unauthenticated("ID token has no subject")
+	}
+
+	return &Identity{
+		Subject:       claims.Subject,
+		Email:         strings.TrimSpace(claims.Email),
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          strings.TrimSpace(claims.Name),
+	}, nil
+}
+
+// key returns the public key of the provider with the given ID. The keys are fetched again if
+// the key is unknown, since the provider might have rotated its keys
+func (p *Provider) key(ctx context.Context, discovery *Discovery, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[kid]
+	if ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, errors.Unauthenticatedf("unknown signing key %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	key, ok = p.keys[kid]
+	if !ok {
+		return nil, errors.Unauthenticatedf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, errors.InternalErr(err, "failed creating JWKS request")
+	}
+
+	jwks := &jwt.JWKS{}
+	status, err := p.do(req, jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, errors.Internalf("failed fetching JWKS, status %d", status)
+	}
+
+	keys := make(map[string]any, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		// keys of unsupported types are skipped, the provider might publish keys for other purposes
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+// discover returns the provider metadata, which is fetched only once
+func (p *Provider) discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, errors.InternalErr(err, "failed creating discovery request")
+	}
+
+	discovery := &Discovery{}
+	status, err := p.do(req, discovery)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, errors.Internalf("failed fetching discovery document of %s, status %d", p.cfg.Name, status)
+	}
+
+	// the issuer must be exactly the one configured, as required by OpenID Connect Discovery
+	if discovery.Issuer != p.cfg.Issuer {
+		return nil, errors.Internalf("issuer mismatch in discovery document of %s: %q", p.cfg.Name, discovery.Issuer)
+	}
+
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.Internalf("incomplete discovery document of %s", p.cfg.Name)
+	}
+
+	p.discovery = discovery
+
+	return discovery, nil
+}
+
+// do sends the request and decodes the JSON response into out, regardless of the status
+func (p *Provider) do(req *http.Request, out any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, errors.InternalErr(err, fmt.Sprintf("failed requesting %s", req.URL.Host))
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out)
+	if err != nil && resp.StatusCode == http.StatusOK {
+		return 0, errors.InternalErr(err, fmt.Sprintf("invalid response from %s", req.URL.Host))
+	}
+
+	return resp.StatusCode, nil
+}
+
+// NewPKCE returns a new PKCE code verifier, along with its S256 code challenge
+func NewPKCE() (verifier string, challenge string, err error) {
+	verifier, err = RandomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	return verifier, CodeChallenge(verifier), nil
+}
+
+// CodeChallenge returns the S256 code challenge of the PKCE code verifier
+func CodeChallenge(verifier string) string {
+	hashed := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hashed[:])
+}
+
+// RandomString returns an unguessable string, e.g. for the state and nonce
+func RandomString() (string, error) {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", errors.Wrap(err, "failed generating random string")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// NewProvider returns a provider, the discovery document is fetched on first use
+func NewProvider(cfg *Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+	}
+}
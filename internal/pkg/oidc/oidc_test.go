@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+
+	"github.com/baobei23/goapp/internal/pkg/jwt"
+)
+
+// mockProvider is a minimal OpenID Connect provider, issuing a single authorization code
+type mockProvider struct {
+	server    *httptest.Server
+	key       *jwt.Key
+	challenge string
+	claims    gojwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := jwt.NewKey("mock-key", private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := jwt.NewKeyring("mock-key", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mp := &mockProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&Discovery{
+			Issuer:                mp.server.URL,
+			AuthorizationEndpoint: mp.server.URL + "/authorize",
+			TokenEndpoint:         mp.server.URL + "/token",
+			JWKSURI:               mp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(keys.JWKS())
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, _ := r.BasicAuth()
+		if clientID != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		if r.PostFormValue("code") != "code" || CodeChallenge(r.PostFormValue("code_verifier")) != mp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := gojwt.NewWithClaims(key.Method, mp.claims)
+		token.Header["kid"] = key.ID
+		signed, err := token.SignedString(key.Private)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+
+	mp.server = httptest.NewServer(mux)
+	t.Cleanup(mp.server.Close)
+
+	return mp
+}
+
+func (mp *mockProvider) idClaims(nonce string) gojwt.MapClaims {
+	now := time.Now()
+	return gojwt.MapClaims{
+		"iss":            mp.server.URL,
+		"sub":            "external-user",
+		"aud":            "client",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "user@example.com",
+		"email_verified": "true",
+	}
+}
+
+func TestProvider_Login(t *testing.T) {
+	mp := newMockProvider(t)
+
+	tests := []struct {
+		name    string
+		modify  func(claims gojwt.MapClaims)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(gojwt.MapClaims) {}},
+		{name: "wrong nonce", modify: func(c gojwt.MapClaims) { c["nonce"] = "other" }, wantErr: true},
+		{name: "wrong audience", modify: func(c gojwt.MapClaims) { c["aud"] = "other-client" }, wantErr: true},
+		{name: "wrong issuer", modify: func(c gojwt.MapClaims) { c["iss"] = "https://evil.example" }, wantErr: true},
+		{name: "expired", modify: func(c gojwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewProvider(&Config{
+				Name:         "mock",
+				Issuer:       mp.server.URL,
+				ClientID:     "client",
+				ClientSecret: "secret",
+				RedirectURL:  "http://localhost/callback",
+				Scopes:       []string{"email"},
+			}, mp.server.Client())
+
+			verifier, challenge, err := NewPKCE()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", challenge)
+			if err != nil {
+				t.Fatalf("auth URL: %+v", err)
+			}
+
+			parsed, _ := url.Parse(authURL)
+			if parsed.Query().Get("code_challenge") != challenge || parsed.Query().Get("scope") != "openid email" {
+				t.Errorf("unexpected auth URL: %s", authURL)
+			}
+
+			mp.challenge = challenge
+			mp.claims = mp.idClaims("nonce")
+			tt.modify(mp.claims)
+
+			identity, err := provider.Exchange(context.Background(), "code", verifier, "nonce")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error: %v, expected error: %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if identity.Subject != "external-user" || identity.Email != "user@example.com" || !identity.EmailVerified {
+				t.Errorf("unexpected identity: %+v", identity)
+			}
+		})
+	}
+}
+
+func TestProvider_ExchangeWrongVerifier(t *testing.T) {
+	mp := newMockProvider(t)
+	provider := NewProvider(&Config{
+		Name:         "mock",
+		Issuer:       mp.server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+	}, mp.server.Client())
+
+	_, challenge, _ := NewPKCE()
+	mp.challenge = challenge
+	mp.claims = mp.idClaims("nonce")
+
+	_, err := provider.Exchange(context.Background(), "code", "other-verifier", "nonce")
+	if err == nil {
+		t.Errorf("expected exchange with a wrong code verifier to fail")
+	}
+}
+
+func TestProvider_IssuerMismatch(t *testing.T) {
+	mp := newMockProvider(t)
+	provider := NewProvider(&Config{
+		Name:     "mock",
+		Issuer:   mp.server.URL + "/",
+		ClientID: "client",
+	}, mp.server.Client())
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err == nil {
+		t.Errorf("expected a discovery document of another issuer to be rejected")
+	}
+}
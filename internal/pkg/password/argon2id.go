@@ -0,0 +1,163 @@
+package password
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/naughtygopher/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+var (
+	ErrMalformedHash         = errors.New("malformed password hash")
+	ErrInvalidArgon2idParams = errors.New("invalid argon2id parameters")
+)
+
+var argon2idPrefix = []byte("$argon2id$")
+
+// Argon2idParams are the cost parameters of argon2id
+type Argon2idParams struct {
+	// Memory is the amount of memory used, in KiB
+	Memory      uint32 `json:"memory,omitempty"`
+	Iterations  uint32 `json:"iterations,omitempty"`
+	Parallelism uint8  `json:"parallelism,omitempty"`
+	SaltLength  uint32 `json:"saltLength,omitempty"`
+	KeyLength   uint32 `json:"keyLength,omitempty"`
+}
+
+// Validate checks the parameters are within the bounds argon2id supports, e.g. argon2.IDKey panics
+// if there are no iterations or no parallelism
+func (p *Argon2idParams) Validate() error {
+	if p.Iterations < 1 {
+		return errors.Wrap(ErrInvalidArgon2idParams, "iterations must be at least 1")
+	}
+
+	if p.Parallelism < 1 {
+		return errors.Wrap(ErrInvalidArgon2idParams, "parallelism must be at least 1")
+	}
+
+	if p.Memory < 8*uint32(p.Parallelism) {
+		return errors.Wrap(ErrInvalidArgon2idParams, "memory must be at least 8 KiB per degree of parallelism")
+	}
+
+	if p.SaltLength < 8 || p.KeyLength < 16 {
+		return errors.Wrap(ErrInvalidArgon2idParams, "salt must be at least 8 bytes and key at least 16 bytes long")
+	}
+
+	return nil
+}
+
+// DefaultArgon2idParams are the parameters recommended by OWASP
+func DefaultArgon2idParams() *Argon2idParams {
+	return &Argon2idParams{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+type argon2id struct {
+	params *Argon2idParams
+}
+
+// Hash returns the hash in the PHC string format, e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+func (a *argon2id) Hash(plain []byte) ([]byte, error) {
+	salt := make([]byte, a.params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed generating salt")
+	}
+
+	key := argon2.IDKey(plain, salt, a.params.Iterations, a.params.Memory, a.params.Parallelism, a.params.KeyLength)
+
+	return fmt.Appendf(
+		nil,
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		a.params.Memory,
+		a.params.Iterations,
+		a.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *argon2id) Identifies(hashed []byte) bool {
+	return bytes.HasPrefix(hashed, argon2idPrefix)
+}
+
+func (a *argon2id) Verify(hashed []byte, plain []byte) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hashed)
+	if err != nil {
+		return false, err
+	}
+
+	computed := argon2.IDKey(plain, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return subtle.ConstantTimeCompare(key, computed) == 1, nil
+}
+
+func (a *argon2id) Outdated(hashed []byte) bool {
+	params, salt, _, err := decodeArgon2id(hashed)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != a.params.Memory ||
+		params.Iterations != a.params.Iterations ||
+		params.Parallelism != a.params.Parallelism ||
+		params.KeyLength != a.params.KeyLength ||
+		uint32(len(salt)) != a.params.SaltLength
+}
+
+func decodeArgon2id(hashed []byte) (*Argon2idParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=19456,t=2,p=1", salt, key
+	parts := strings.Split(string(hashed), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, ErrMalformedHash
+	}
+
+	version := 0
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrMalformedHash
+	}
+
+	params := &Argon2idParams{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return nil, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrMalformedHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, ErrMalformedHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	if params.Validate() != nil {
+		return nil, nil, nil, ErrMalformedHash
+	}
+
+	return params, salt, key, nil
+}
+
+// NewArgon2id returns the argon2id scheme with the given parameters, which are expected to be valid
+// (see Argon2idParams.Validate)
+func NewArgon2id(params *Argon2idParams) Scheme {
+	return &argon2id{
+		params: params,
+	}
+}
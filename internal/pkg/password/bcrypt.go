@@ -0,0 +1,52 @@
+package password
+
+import (
+	"bytes"
+
+	"github.com/naughtygopher/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type bcryptScheme struct {
+	cost int
+}
+
+func (b *bcryptScheme) Hash(plain []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(plain, b.cost)
+}
+
+func (b *bcryptScheme) Identifies(hashed []byte) bool {
+	return bytes.HasPrefix(hashed, []byte("$2a$")) ||
+		bytes.HasPrefix(hashed, []byte("$2b$")) ||
+		bytes.HasPrefix(hashed, []byte("$2y$"))
+}
+
+func (b *bcryptScheme) Verify(hashed []byte, plain []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(hashed, plain)
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+func (b *bcryptScheme) Outdated(hashed []byte) bool {
+	cost, err := bcrypt.Cost(hashed)
+	if err != nil {
+		return true
+	}
+
+	return cost != b.cost
+}
+
+// NewBcrypt returns the bcrypt scheme with the given cost. Bcrypt only uses the first 72 bytes
+// of a password, and is hence meant to be used for verifying legacy hashes.
+func NewBcrypt(cost int) Scheme {
+	return &bcryptScheme{
+		cost: cost,
+	}
+}
@@ -0,0 +1,62 @@
+// Package password provides hashing of passwords. Hashes are self-describing, i.e. they carry
+// the algorithm identifier and parameters, so that hashes generated by older algorithms or
+// parameters can still be verified and then upgraded.
+package password
+
+import (
+	"github.com/naughtygopher/errors"
+)
+
+var ErrUnknownScheme = errors.New("unknown password hashing scheme")
+
+// Scheme is a single password hashing algorithm
+type Scheme interface {
+	// Hash returns the hash of the plain text password
+	Hash(plain []byte) ([]byte, error)
+	// Identifies reports whether the hash was generated by this scheme
+	Identifies(hashed []byte) bool
+	// Verify reports whether the plain text password matches the hash
+	Verify(hashed []byte, plain []byte) (bool, error)
+	// Outdated reports whether the hash was generated with parameters other than the scheme's current ones
+	Outdated(hashed []byte) bool
+}
+
+// Hasher hashes passwords using the preferred scheme, while still being able to verify
+// hashes generated by any of the legacy schemes
+type Hasher struct {
+	preferred Scheme
+	schemes   []Scheme
+}
+
+// Hash returns the hash of the plain text password, using the preferred scheme
+func (h *Hasher) Hash(plain []byte) ([]byte, error) {
+	return h.preferred.Hash(plain)
+}
+
+// Verify reports whether the plain text password matches the hash. needsRehash is true if the
+// hash was not generated by the preferred scheme with its current parameters.
+func (h *Hasher) Verify(hashed []byte, plain []byte) (ok bool, needsRehash bool, err error) {
+	for _, scheme := range h.schemes {
+		if !scheme.Identifies(hashed) {
+			continue
+		}
+
+		ok, err = scheme.Verify(hashed, plain)
+		if err != nil || !ok {
+			return false, false, err
+		}
+
+		return true, scheme != h.preferred || scheme.Outdated(hashed), nil
+	}
+
+	return false, false, ErrUnknownScheme
+}
+
+// New returns a Hasher which generates hashes with the preferred scheme, and can verify hashes
+// of the preferred as well as all the legacy schemes
+func New(preferred Scheme, legacy ...Scheme) *Hasher {
+	return &Hasher{
+		preferred: preferred,
+		schemes:   append([]Scheme{preferred}, legacy...),
+	}
+}
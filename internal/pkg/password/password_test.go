@@ -0,0 +1,170 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func testArgon2idParams() *Argon2idParams {
+	return &Argon2idParams{
+		Memory:      64,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func TestHasher_Verify(t *testing.T) {
+	current := New(NewArgon2id(testArgon2idParams()), NewBcrypt(4))
+
+	stronger := testArgon2idParams()
+	stronger.Iterations = 2
+	upgraded := New(NewArgon2id(stronger), NewBcrypt(4))
+
+	legacy := New(NewBcrypt(4))
+
+	tests := []struct {
+		name            string
+		generator       *Hasher
+		verifier        *Hasher
+		plain           string
+		attempt         string
+		wantOK          bool
+		wantNeedsRehash bool
+	}{
+		{
+			name:      "argon2id match",
+			generator: current,
+			verifier:  current,
+			plain:     "securepassword",
+			attempt:   "securepassword",
+			wantOK:    true,
+		},
+		{
+			name:      "argon2id mismatch",
+			generator: current,
+			verifier:  current,
+			plain:     "securepassword",
+			attempt:   "wrongpassword",
+			wantOK:    false,
+		},
+		{
+			name:            "argon2id with outdated parameters",
+			generator:       current,
+			verifier:        upgraded,
+			plain:           "securepassword",
+			attempt:         "securepassword",
+			wantOK:          true,
+			wantNeedsRehash: true,
+		},
+		{
+			name:            "legacy bcrypt",
+			generator:       legacy,
+			verifier:        current,
+			plain:           "securepassword",
+			attempt:         "securepassword",
+			wantOK:          true,
+			wantNeedsRehash: true,
+		},
+		{
+			name:      "legacy bcrypt mismatch",
+			generator: legacy,
+			verifier:  current,
+			plain:     "securepassword",
+			attempt:   "wrongpassword",
+			wantOK:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashed, err := tt.generator.Hash([]byte(tt.plain))
+			if err != nil {
+				t.Fatalf("Hasher.Hash() error = %v", err)
+			}
+
+			ok, needsRehash, err := tt.verifier.Verify(hashed, []byte(tt.attempt))
+			if err != nil {
+				t.Fatalf("Hasher.Verify() error = %v", err)
+			}
+
+			if ok != tt.wantOK || needsRehash != tt.wantNeedsRehash {
+				t.Errorf(
+					"Hasher.Verify() = (%v, %v), want (%v, %v)",
+					ok, needsRehash, tt.wantOK, tt.wantNeedsRehash,
+				)
+			}
+		})
+	}
+}
+
+func TestHasher_VerifyUnknownScheme(t *testing.T) {
+	hasher := New(NewArgon2id(testArgon2idParams()))
+	_, _, err := hasher.Verify([]byte("$unknown$hash"), []byte("securepassword"))
+	if err == nil {
+		t.Error("Hasher.Verify() expected error for unknown scheme")
+	}
+}
+
+func TestArgon2id_LongPasswords(t *testing.T) {
+	hasher := New(NewArgon2id(testArgon2idParams()))
+	long := make([]byte, 100)
+	for i := range long {
+		long[i] = 'a'
+	}
+
+	hashed, err := hasher.Hash(long)
+	if err != nil {
+		t.Fatalf("Hasher.Hash() error = %v", err)
+	}
+
+	// unlike bcrypt, bytes beyond the 72nd are significant
+	long[99] = 'b'
+	ok, _, err := hasher.Verify(hashed, long)
+	if err != nil {
+		t.Fatalf("Hasher.Verify() error = %v", err)
+	}
+
+	if ok {
+		t.Error("Hasher.Verify() matched a password differing after 72 bytes")
+	}
+}
+
+func TestArgon2idParams_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(p *Argon2idParams)
+		wantErr bool
+	}{
+		{name: "defaults", modify: func(p *Argon2idParams) {}},
+		{name: "no iterations", modify: func(p *Argon2idParams) { p.Iterations = 0 }, wantErr: true},
+		{name: "no parallelism", modify: func(p *Argon2idParams) { p.Parallelism = 0 }, wantErr: true},
+		{name: "too little memory", modify: func(p *Argon2idParams) { p.Memory = 8*uint32(p.Parallelism) - 1 }, wantErr: true},
+		{name: "short salt", modify: func(p *Argon2idParams) { p.SaltLength = 4 }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := DefaultArgon2idParams()
+			tt.modify(params)
+			err := params.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Argon2idParams.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHasher_VerifyInvalidArgon2idParams(t *testing.T) {
+	hasher := New(NewArgon2id(testArgon2idParams()))
+	hashed, err := hasher.Hash([]byte("securepassword"))
+	if err != nil {
+		t.Fatalf("Hasher.Hash() error = %v", err)
+	}
+
+	corrupt := []byte(strings.Replace(string(hashed), ",p=1", ",p=0", 1))
+	_, _, err = hasher.Verify(corrupt, []byte("securepassword"))
+	if err == nil {
+		t.Error("Hasher.Verify() expected error for a hash with no parallelism")
+	}
+}
@@ -0,0 +1,66 @@
+// Package secretbox encrypts small secrets to be stored at rest, using AES-256-GCM
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/naughtygopher/errors"
+)
+
+// KeyLength is the required length of the encryption key
+const KeyLength = 32
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+type Box struct {
+	aead cipher.AEAD
+}
+
+// Encrypt returns the encrypted secret, prefixed with the random nonce used
+func (b *Box) Encrypt(plain []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed generating nonce")
+	}
+
+	return b.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// Decrypt returns the secret encrypted by Encrypt
+func (b *Box) Decrypt(ciphertext []byte) ([]byte, error) {
+	size := b.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, ErrInvalidCiphertext
+	}
+
+	plain, err := b.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidCiphertext, err.Error())
+	}
+
+	return plain, nil
+}
+
+// New returns a Box which encrypts using the key, the key should be of length KeyLength
+func New(key []byte) (*Box, error) {
+	if len(key) != KeyLength {
+		return nil, errors.Validationf("encryption key should be %d bytes long", KeyLength)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating cipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating GCM")
+	}
+
+	return &Box{
+		aead: aead,
+	}, nil
+}
@@ -0,0 +1,187 @@
+// Package sso logs in users with external OpenID Connect providers. A login is started by
+// redirecting the user to the provider, and completed when the provider redirects back with an
+// authorization code. The state in between is kept in the datastore.
+package sso
+
+import (
+	"context"
+	"crypto/sha256"
+	"sort"
+	"time"
+
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/oidc"
+)
+
+var (
+	ErrProviderNotFound = errors.New("identity provider not found")
+	ErrInvalidState     = errors.New("login state is invalid or has expired")
+)
+
+type Config struct {
+	// StateExpiry is how long the user has to complete the login at the provider
+	StateExpiry time.Duration
+}
+
+// LoginState is what is remembered of a started login, until the provider redirects back
+type LoginState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	// Audience is the audience of the tokens issued once the login completes
+	Audience   string
+	UseCookies bool
+	ExpiresAt  time.Time
+}
+
+// Redirect is where the user is to be redirected to, to login at the provider
+type Redirect struct {
+	URL string
+	// State is also to be kept by the user agent, e.g. in a cookie, and checked when the provider
+	// redirects back. So that a login started by someone else cannot be completed in the browser
+	// of the user (login CSRF).
+	State     string
+	ExpiresAt time.Time
+}
+
+// Login is a completed login
+type Login struct {
+	Provider   string
+	Identity   *oidc.Identity
+	Audience   string
+	UseCookies bool
+}
+
+type store interface {
+	SaveLoginState(ctx context.Context, stateHash []byte, state *LoginState) error
+	// ConsumeLoginState removes and returns the login state, it returns ErrInvalidState if the
+	// state does not exist or is expired
+	ConsumeLoginState(ctx context.Context, stateHash []byte) (*LoginState, error)
+}
+
+type SSO struct {
+	cfg       *Config
+	store     store
+	providers map[string]*oidc.Provider
+}
+
+// Providers returns the names of the configured identity providers
+func (s *SSO) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Begin starts a login with the provider, and returns where the user is to be redirected to
+func (s *SSO) Begin(ctx context.Context, providerName string, audience string, useCookies bool) (*Redirect, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.cfg.StateExpiry)
+	err = s.store.SaveLoginState(ctx, hashState(state), &LoginState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Audience:     audience,
+		UseCookies:   useCookies,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Redirect{
+		URL:       authURL,
+		State:     state,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Complete completes the login using the state and authorization code the provider redirected
+// back with. A state can be used only once
+func (s *SSO) Complete(ctx context.Context, providerName string, state string, code string) (*Login, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	if state == "" || code == "" {
+		return nil, errors.Validation("state and code are required")
+	}
+
+	loginState, err := s.store.ConsumeLoginState(ctx, hashState(state))
+	if err != nil {
+		return nil, err
+	}
+
+	// the state must have been issued for the same provider, a state cannot be replayed elsewhere
+	if loginState.Provider != providerName {
+		return nil, errors.ValidationErr(ErrInvalidState, ErrInvalidState.Error())
+	}
+
+	identity, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Login{
+		Provider:   providerName,
+		Identity:   identity,
+		Audience:   loginState.Audience,
+		UseCookies: loginState.UseCookies,
+	}, nil
+}
+
+func (s *SSO) provider(name string) (*oidc.Provider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, errors.NotFoundErr(ErrProviderNotFound, name)
+	}
+
+	return provider, nil
+}
+
+func hashState(state string) []byte {
+	hashed := sha256.Sum256([]byte(state))
+	return hashed[:]
+}
+
+func NewService(cfg *Config, store store, providers ...*oidc.Provider) *SSO {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+
+	return &SSO{
+		cfg:       cfg,
+		store:     store,
+		providers: byName,
+	}
+}
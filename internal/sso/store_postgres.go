@@ -0,0 +1,89 @@
+package sso
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/naughtygopher/errors"
+)
+
+var QueryTimeoutDuration = 5 * time.Second
+
+type pgstore struct {
+	pqdriver  *pgxpool.Pool
+	tableName string
+}
+
+// SaveLoginState stores the state, and removes the expired ones along the way
+func (ps *pgstore) SaveLoginState(ctx context.Context, stateHash []byte, state *LoginState) error {
+	query := fmt.Sprintf(`
+		WITH expired AS (
+			DELETE FROM %[1]s WHERE expires_at <= now()
+		)
+		INSERT INTO %[1]s (state_hash, provider, nonce, code_verifier, audience, use_cookies, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(
+		ctx,
+		query,
+		stateHash,
+		state.Provider,
+		state.Nonce,
+		state.CodeVerifier,
+		state.Audience,
+		state.UseCookies,
+		state.ExpiresAt,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed storing login state")
+	}
+
+	return nil
+}
+
+// ConsumeLoginState deletes the state in a single statement, so it cannot be used twice even by
+// concurrent requests
+func (ps *pgstore) ConsumeLoginState(ctx context.Context, stateHash []byte) (*LoginState, error) {
+	query := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE state_hash = $1 AND expires_at > now()
+		RETURNING provider, nonce, code_verifier, audience, use_cookies, expires_at`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	state := new(LoginState)
+	err := ps.pqdriver.QueryRow(ctx, query, stateHash).Scan(
+		&state.Provider,
+		&state.Nonce,
+		&state.CodeVerifier,
+		&state.Audience,
+		&state.UseCookies,
+		&state.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ValidationErr(ErrInvalidState, ErrInvalidState.Error())
+		}
+		return nil, errors.Wrap(err, "failed consuming login state")
+	}
+
+	return state, nil
+}
+
+func NewPostgresStore(pqdriver *pgxpool.Pool, tableName string) store {
+	return &pgstore{
+		pqdriver:  pqdriver,
+		tableName: tableName,
+	}
+}
@@ -0,0 +1,195 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/logger"
+)
+
+// revocationEntry is the cached revocation status of a token
+type revocationEntry struct {
+	userID      string
+	familyID    string
+	revoked     bool
+	cachedUntil time.Time
+}
+
+// revocationCache caches the revocation status of tokens, so that the store is not hit on every
+// request. Revoked tokens are cached until they expire, since a revocation is never undone. Tokens
+// which are not revoked are cached only for the TTL, which bounds how long a token revoked by
+// another instance of the app can still be used.
+type revocationCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]revocationEntry
+}
+
+func (rc *revocationCache) get(tokenID string, now time.Time) (revoked bool, ok bool) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	entry, ok := rc.entries[tokenID]
+	if !ok || !entry.cachedUntil.After(now) {
+		return false, false
+	}
+
+	return entry.revoked, true
+}
+
+func (rc *revocationCache) set(tokenID string, entry revocationEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries[tokenID] = entry
+}
+
+// forgetUser removes all the cached entries of the user's tokens
+func (rc *revocationCache) forgetUser(userID string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for tokenID, entry := range rc.entries {
+		if entry.userID == userID {
+			delete(rc.entries, tokenID)
+		}
+	}
+}
+
+// forgetFamily removes all the cached entries of the tokens of the refresh token family
+func (rc *revocationCache) forgetFamily(familyID string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for tokenID, entry := range rc.entries {
+		if entry.familyID == familyID {
+			delete(rc.entries, tokenID)
+		}
+	}
+}
+
+// evictExpired removes all the entries which are not valid anymore
+func (rc *revocationCache) evictExpired(now time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for tokenID, entry := range rc.entries {
+		if !entry.cachedUntil.After(now) {
+			delete(rc.entries, tokenID)
+		}
+	}
+}
+
+func newRevocationCache(ttl time.Duration) *revocationCache {
+	return &revocationCache{
+		ttl:     ttl,
+		entries: make(map[string]revocationEntry),
+	}
+}
+
+// Revoke revokes a single token (identified by its jti) until it expires
+func (t *Tokens) Revoke(ctx context.Context, tokenID, userID string, expiresAt time.Time) error {
+	if tokenID == "" || userID == "" {
+		return errors.Validation("token ID and user ID are required to revoke a token")
+	}
+
+	err := t.store.RevokeToken(ctx, tokenID, userID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	t.cache.set(tokenID, revocationEntry{userID: userID, revoked: true, cachedUntil: expiresAt})
+
+	return nil
+}
+
+// RevokeFamily revokes all the refresh tokens issued since the login which started the family,
+// and thereby the access tokens issued along with them
+func (t *Tokens) RevokeFamily(ctx context.Context, userID, familyID string) error {
+	if familyID == "" {
+		return errors.Validation("refresh token family cannot be empty")
+	}
+
+	err := t.store.RevokeFamily(ctx, userID, familyID)
+	if err != nil {
+		return err
+	}
+
+	t.cache.forgetFamily(familyID)
+
+	return nil
+}
+
+// RevokeAll revokes every token issued to the user so far. expiresAt is the time by which all
+// of those tokens would have expired anyway.
+func (t *Tokens) RevokeAll(ctx context.Context, userID string, expiresAt time.Time) error {
+	if userID == "" {
+		return errors.Validation("user ID cannot be empty")
+	}
+
+	err := t.store.RevokeUserTokens(ctx, userID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	t.cache.forgetUser(userID)
+
+	return nil
+}
+
+// IsRevoked reports whether the token has been revoked, either by itself, along with its family
+// or along with all the other tokens of the user
+func (t *Tokens) IsRevoked(ctx context.Context, tokenID, userID, familyID string, issuedAt, expiresAt time.Time) (bool, error) {
+	now := time.Now()
+	revoked, ok := t.cache.get(tokenID, now)
+	if ok {
+		return revoked, nil
+	}
+
+	revoked, err := t.store.IsTokenRevoked(ctx, tokenID, userID, familyID, issuedAt)
+	if err != nil {
+		return false, err
+	}
+
+	entry := revocationEntry{
+		userID:      userID,
+		familyID:    familyID,
+		revoked:     revoked,
+		cachedUntil: now.Add(t.cfg.RevocationCacheTTL),
+	}
+	if revoked || entry.cachedUntil.After(expiresAt) {
+		entry.cachedUntil = expiresAt
+	}
+	t.cache.set(tokenID, entry)
+
+	return revoked, nil
+}
+
+// PurgeExpired removes revocations of tokens which have expired anyway
+func (t *Tokens) PurgeExpired(ctx context.Context) error {
+	t.cache.evictExpired(time.Now())
+	return t.store.PurgeRevocations(ctx)
+}
+
+// StartPurge periodically removes revocations of tokens which have expired anyway, until the
+// context is cancelled or the returned stop function is called
+func (t *Tokens) StartPurge(ctx context.Context) (stop func()) {
+	ctx, stop = context.WithCancel(ctx)
+	tick := time.NewTicker(t.cfg.RevocationPurgeInterval)
+	go func() {
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				err := t.PurgeExpired(ctx)
+				if err != nil {
+					logger.Error(ctx, fmt.Sprintf("[tokens] failed purging expired revocations: %+v", err))
+				}
+			}
+		}
+	}()
+
+	return stop
+}
@@ -0,0 +1,70 @@
+package tokens
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// maxUserAgentLength is the length user agents are truncated to before being stored
+const maxUserAgentLength = 512
+
+// Session is a login on a device. It lasts as long as its refresh token family, and the ID is that
+// of the family
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"-"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Device is the client a refresh token is issued to
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+func (d *Device) Sanitize() {
+	d.UserAgent = strings.TrimSpace(d.UserAgent)
+	if len(d.UserAgent) > maxUserAgentLength {
+		d.UserAgent = d.UserAgent[:maxUserAgentLength]
+	}
+	d.IP = strings.TrimSpace(d.IP)
+}
+
+// Sessions returns the active sessions of the user, most recently seen first
+func (t *Tokens) Sessions(ctx context.Context, userID string) ([]Session, error) {
+	if userID == "" {
+		return nil, errors.Validation("user ID cannot be empty")
+	}
+
+	return t.store.GetSessions(ctx, userID)
+}
+
+// EndSession signs out the session, revoking its refresh tokens along with the access tokens
+// issued to it
+func (t *Tokens) EndSession(ctx context.Context, userID, sessionID string) error {
+	if userID == "" || sessionID == "" {
+		return errors.Validation("user ID and session ID are required")
+	}
+
+	if uuid.Validate(sessionID) != nil {
+		return errors.NotFoundErr(ErrSessionNotFound, sessionID)
+	}
+
+	// makes sure the session belongs to the user
+	_, err := t.store.GetSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return t.RevokeFamily(ctx, userID, sessionID)
+}
@@ -0,0 +1,407 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/naughtygopher/errors"
+)
+
+var QueryTimeoutDuration = 5 * time.Second
+
+type pgstore struct {
+	pqdriver             *pgxpool.Pool
+	tableName            string
+	revokedTokensTable   string
+	userRevocationsTable string
+	sessionsTable        string
+}
+
+func (ps *pgstore) SaveRefreshToken(ctx context.Context, rt *RefreshToken, device *Device) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.pqdriver.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	err = ps.saveSession(ctx, tx, rt, device)
+	if err != nil {
+		return err
+	}
+
+	err = ps.insertRefreshToken(ctx, tx, rt)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed committing refresh token")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) insertRefreshToken(ctx context.Context, tx pgx.Tx, rt *RefreshToken) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (id, family_id, user_id, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		ps.tableName,
+	)
+
+	_, err := tx.Exec(ctx, query, rt.ID, rt.FamilyID, rt.UserID, rt.ExpiresAt)
+	if err != nil {
+		return errors.Wrap(err, "failed storing refresh token")
+	}
+
+	return nil
+}
+
+// saveSession starts the session of the token's family, or marks it as seen if it exists. Families
+// started before sessions were tracked get a session on their next rotation
+func (ps *pgstore) saveSession(ctx context.Context, tx pgx.Tx, rt *RefreshToken, device *Device) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %[1]s (id, user_id, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE
+		SET user_agent = EXCLUDED.user_agent,
+			ip = EXCLUDED.ip,
+			expires_at = EXCLUDED.expires_at,
+			last_seen_at = now()
+		WHERE %[1]s.user_id = EXCLUDED.user_id`,
+		ps.sessionsTable,
+	)
+
+	_, err := tx.Exec(ctx, query, rt.FamilyID, rt.UserID, device.UserAgent, device.IP, rt.ExpiresAt)
+	if err != nil {
+		return errors.Wrap(err, "failed storing session")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) GetRefreshToken(ctx context.Context, tokenID string) (*RefreshToken, error) {
+	query := fmt.Sprintf(`
+		SELECT id, family_id, user_id, expires_at, revoked_at, replaced_by, created_at
+		FROM %s
+		WHERE id = $1`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rt := new(RefreshToken)
+	replacedBy := new(uuid.NullUUID)
+	err := ps.pqdriver.QueryRow(ctx, query, tokenID).Scan(
+		&rt.ID,
+		&rt.FamilyID,
+		&rt.UserID,
+		&rt.ExpiresAt,
+		&rt.RevokedAt,
+		replacedBy,
+		&rt.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NotFoundErr(ErrRefreshTokenNotFound, tokenID)
+		}
+		return nil, errors.Wrap(err, "failed getting refresh token")
+	}
+
+	if replacedBy.Valid {
+		rt.ReplacedBy = replacedBy.UUID.String()
+	}
+
+	return rt, nil
+}
+
+func (ps *pgstore) RotateRefreshToken(ctx context.Context, currentID string, next *RefreshToken, device *Device) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.pqdriver.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// the condition on revoked_at makes sure only one of the concurrent rotations succeeds
+	tag, err := tx.Exec(ctx,
+		fmt.Sprintf(`
+			UPDATE %s
+			SET revoked_at = now(), replaced_by = $2
+			WHERE id = $1 AND revoked_at IS NULL AND expires_at > now()`,
+			ps.tableName,
+		),
+		currentID,
+		next.ID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed revoking refresh token")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.UnauthenticatedErr(ErrRefreshTokenInactive, ErrRefreshTokenInactive.Error())
+	}
+
+	err = ps.insertRefreshToken(ctx, tx, next)
+	if err != nil {
+		return err
+	}
+
+	err = ps.saveSession(ctx, tx, next, device)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed committing refresh token rotation")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) RevokeFamily(ctx context.Context, userID, familyID string) error {
+	query := fmt.Sprintf(`
+		WITH session AS (
+			UPDATE %s
+			SET revoked_at = now()
+			WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		)
+		UPDATE %s
+		SET revoked_at = now()
+		WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		ps.sessionsTable,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, familyID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed revoking refresh token family")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) RevokeToken(ctx context.Context, tokenID, userID string, expiresAt time.Time) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (id, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO NOTHING`,
+		ps.revokedTokensTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, tokenID, userID, expiresAt)
+	if err != nil {
+		return errors.Wrap(err, "failed revoking token")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) RevokeUserTokens(ctx context.Context, userID string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.pqdriver.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// token timestamps only have a precision of seconds, so tokens issued within the same second
+	// as the revocation are revoked as well, even if they were issued right after it
+	_, err = tx.Exec(ctx,
+		fmt.Sprintf(`
+			INSERT INTO %s (user_id, revoked_before, expires_at)
+			VALUES ($1, now(), $2)
+			ON CONFLICT (user_id) DO UPDATE
+			SET revoked_before = EXCLUDED.revoked_before,
+				expires_at = GREATEST(%s.expires_at, EXCLUDED.expires_at)`,
+			ps.userRevocationsTable,
+			ps.userRevocationsTable,
+		),
+		userID,
+		expiresAt,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed revoking user tokens")
+	}
+
+	_, err = tx.Exec(ctx,
+		fmt.Sprintf(`
+			UPDATE %s
+			SET revoked_at = now()
+			WHERE user_id = $1 AND revoked_at IS NULL`,
+			ps.tableName,
+		),
+		userID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed revoking refresh tokens")
+	}
+
+	_, err = tx.Exec(ctx,
+		fmt.Sprintf(`
+			UPDATE %s
+			SET revoked_at = now()
+			WHERE user_id = $1 AND revoked_at IS NULL`,
+			ps.sessionsTable,
+		),
+		userID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed revoking sessions")
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed committing token revocation")
+	}
+
+	return nil
+}
+
+// IsTokenRevoked checks the revocations of the token, its session and its user. Tokens issued
+// before sessions were tracked do not have a family
+func (ps *pgstore) IsTokenRevoked(ctx context.Context, tokenID, userID, familyID string, issuedAt time.Time) (bool, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			EXISTS (SELECT 1 FROM %s WHERE id = $1)
+			OR EXISTS (SELECT 1 FROM %s WHERE user_id = $2 AND revoked_before >= $3)
+			OR EXISTS (SELECT 1 FROM %s WHERE id = NULLIF($4, '')::uuid AND revoked_at IS NOT NULL)`,
+		ps.revokedTokensTable,
+		ps.userRevocationsTable,
+		ps.sessionsTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	revoked := false
+	err := ps.pqdriver.QueryRow(ctx, query, tokenID, userID, issuedAt, familyID).Scan(&revoked)
+	if err != nil {
+		return false, errors.Wrap(err, "failed checking token revocation")
+	}
+
+	return revoked, nil
+}
+
+func (ps *pgstore) PurgeRevocations(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	for _, table := range []string{ps.revokedTokensTable, ps.userRevocationsTable, ps.sessionsTable} {
+		_, err := ps.pqdriver.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE expires_at <= now()`, table))
+		if err != nil {
+			return errors.Wrap(err, "failed purging expired revocations")
+		}
+	}
+
+	return nil
+}
+
+func (ps *pgstore) GetSessions(ctx context.Context, userID string) ([]Session, error) {
+	query := fmt.Sprintf(`
+		SELECT id, user_id, user_agent, ip, expires_at, last_seen_at, created_at
+		FROM %s
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		ORDER BY last_seen_at DESC`,
+		ps.sessionsTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing sessions")
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading session")
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed listing sessions")
+	}
+
+	return sessions, nil
+}
+
+func (ps *pgstore) GetSession(ctx context.Context, userID, sessionID string) (*Session, error) {
+	query := fmt.Sprintf(`
+		SELECT id, user_id, user_agent, ip, expires_at, last_seen_at, created_at
+		FROM %s
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > now()`,
+		ps.sessionsTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	session, err := scanSession(ps.pqdriver.QueryRow(ctx, query, sessionID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NotFoundErr(ErrSessionNotFound, sessionID)
+		}
+		return nil, errors.Wrap(err, "failed getting session")
+	}
+
+	return session, nil
+}
+
+func scanSession(row pgx.Row) (*Session, error) {
+	session := new(Session)
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IP,
+		&session.ExpiresAt,
+		&session.LastSeenAt,
+		&session.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func NewPostgresStore(pqdriver *pgxpool.Pool, tableName string) store {
+	return &pgstore{
+		pqdriver:             pqdriver,
+		tableName:            tableName,
+		revokedTokensTable:   "revoked_tokens",
+		userRevocationsTable: "user_token_revocations",
+		sessionsTable:        "sessions",
+	}
+}
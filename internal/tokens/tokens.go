@@ -0,0 +1,183 @@
+// Package tokens keeps track of the refresh tokens issued to users. Refresh tokens are grouped
+// into families, a family starts with a login and every refresh rotates the token within it.
+package tokens
+
+import (
+	"context"
+	"time"
+
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/logger"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenInactive = errors.New("refresh token is revoked or expired")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected")
+)
+
+type RefreshToken struct {
+	// ID is the jti of the refresh token
+	ID         string
+	FamilyID   string
+	UserID     string
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy string
+	CreatedAt  time.Time
+}
+
+func (rt *RefreshToken) ValidateForCreate() error {
+	if rt.ID == "" {
+		return errors.Validation("refresh token ID cannot be empty")
+	}
+
+	if rt.FamilyID == "" {
+		return errors.Validation("refresh token family cannot be empty")
+	}
+
+	if rt.UserID == "" {
+		return errors.Validation("refresh token user cannot be empty")
+	}
+
+	if rt.ExpiresAt.IsZero() {
+		return errors.Validation("refresh token expiry cannot be empty")
+	}
+
+	return nil
+}
+
+// SecurityEvent is logged whenever something suspicious happens with the tokens of a user
+type SecurityEvent struct {
+	Event    string `json:"event"`
+	UserID   string `json:"userID"`
+	FamilyID string `json:"familyID"`
+	TokenID  string `json:"tokenID"`
+}
+
+type Config struct {
+	// RevocationCacheTTL is how long a token which is not revoked is cached as such
+	RevocationCacheTTL time.Duration
+	// RevocationPurgeInterval is how often revocations of expired tokens are removed
+	RevocationPurgeInterval time.Duration
+}
+
+type store interface {
+	// SaveRefreshToken saves the token, and starts or updates the session of its family
+	SaveRefreshToken(ctx context.Context, rt *RefreshToken, device *Device) error
+	GetRefreshToken(ctx context.Context, tokenID string) (*RefreshToken, error)
+	// RotateRefreshToken revokes the current token and saves the next one in its place. It returns
+	// ErrRefreshTokenInactive if the current token is not active anymore
+	RotateRefreshToken(ctx context.Context, currentID string, next *RefreshToken, device *Device) error
+	// RevokeFamily revokes the refresh tokens of the family, along with its session
+	RevokeFamily(ctx context.Context, userID, familyID string) error
+	RevokeToken(ctx context.Context, tokenID, userID string, expiresAt time.Time) error
+	// RevokeUserTokens revokes all the tokens issued to the user so far, including all refresh tokens
+	RevokeUserTokens(ctx context.Context, userID string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, tokenID, userID, familyID string, issuedAt time.Time) (bool, error)
+	PurgeRevocations(ctx context.Context) error
+
+	GetSessions(ctx context.Context, userID string) ([]Session, error)
+	GetSession(ctx context.Context, userID, sessionID string) (*Session, error)
+}
+
+type Tokens struct {
+	cfg   *Config
+	store store
+	cache *revocationCache
+}
+
+// Issue starts tracking a newly issued refresh token, along with the session on the device it's
+// issued to
+func (t *Tokens) Issue(ctx context.Context, rt *RefreshToken, device *Device) error {
+	err := rt.ValidateForCreate()
+	if err != nil {
+		return err
+	}
+
+	device.Sanitize()
+
+	return t.store.SaveRefreshToken(ctx, rt, device)
+}
+
+// Rotate replaces the current refresh token with the next one. If the current token was already
+// rotated, it's being reused (i.e. it has leaked), and the whole family is revoked. Tokens
+// revoked otherwise, e.g. by logging out, are only inactive. The session is marked as seen from
+// the device.
+func (t *Tokens) Rotate(ctx context.Context, currentID string, next *RefreshToken, device *Device) error {
+	err := next.ValidateForCreate()
+	if err != nil {
+		return err
+	}
+
+	device.Sanitize()
+
+	current, err := t.store.GetRefreshToken(ctx, currentID)
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return errors.UnauthenticatedErr(err, "invalid refresh token")
+		}
+		return err
+	}
+
+	if current.UserID != next.UserID || current.FamilyID != next.FamilyID {
+		return errors.Unauthenticated("invalid refresh token")
+	}
+
+	if current.RevokedAt != nil {
+		return t.revoked(ctx, current)
+	}
+
+	if !current.ExpiresAt.After(time.Now()) {
+		return errors.UnauthenticatedErr(ErrRefreshTokenInactive, ErrRefreshTokenInactive.Error())
+	}
+
+	err = t.store.RotateRefreshToken(ctx, currentID, next, device)
+	if err != nil {
+		// lost a race against a concurrent request using the same token, or logging out
+		if errors.Is(err, ErrRefreshTokenInactive) {
+			current, err = t.store.GetRefreshToken(ctx, currentID)
+			if err != nil {
+				return err
+			}
+			return t.revoked(ctx, current)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// revoked returns the error for using the revoked token, which is reuse only if it was rotated
+func (t *Tokens) revoked(ctx context.Context, rt *RefreshToken) error {
+	if rt.ReplacedBy != "" {
+		return t.reused(ctx, rt)
+	}
+
+	return errors.UnauthenticatedErr(ErrRefreshTokenInactive, ErrRefreshTokenInactive.Error())
+}
+
+func (t *Tokens) reused(ctx context.Context, rt *RefreshToken) error {
+	logger.Warn(ctx, &SecurityEvent{
+		Event:    "refresh_token_reuse",
+		UserID:   rt.UserID,
+		FamilyID: rt.FamilyID,
+		TokenID:  rt.ID,
+	})
+
+	err := t.RevokeFamily(ctx, rt.UserID, rt.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	return errors.UnauthenticatedErr(ErrRefreshTokenReused, ErrRefreshTokenReused.Error())
+}
+
+func NewService(cfg *Config, store store) *Tokens {
+	return &Tokens{
+		cfg:   cfg,
+		store: store,
+		cache: newRevocationCache(cfg.RevocationCacheTTL),
+	}
+}
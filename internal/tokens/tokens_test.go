@@ -0,0 +1,295 @@
+package tokens
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/naughtygopher/errors"
+)
+
+type memstore struct {
+	tokens        map[string]*RefreshToken
+	sessions      map[string]*Session
+	revoked       map[string]bool
+	revokedBefore map[string]time.Time
+	// endedSessions are the sessions revoked, like the revoked_at of sessions in pgstore
+	endedSessions map[string]bool
+	lookups       int
+	purges        atomic.Int32
+}
+
+func newMemstore() *memstore {
+	return &memstore{
+		tokens:        map[string]*RefreshToken{},
+		sessions:      map[string]*Session{},
+		revoked:       map[string]bool{},
+		revokedBefore: map[string]time.Time{},
+		endedSessions: map[string]bool{},
+	}
+}
+
+func (ms *memstore) SaveRefreshToken(ctx context.Context, rt *RefreshToken, device *Device) error {
+	cp := *rt
+	ms.tokens[rt.ID] = &cp
+	ms.sessions[rt.FamilyID] = &Session{
+		ID:         rt.FamilyID,
+		UserID:     rt.UserID,
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		ExpiresAt:  rt.ExpiresAt,
+		LastSeenAt: time.Now(),
+	}
+	return nil
+}
+
+func (ms *memstore) GetRefreshToken(ctx context.Context, tokenID string) (*RefreshToken, error) {
+	rt, ok := ms.tokens[tokenID]
+	if !ok {
+		return nil, errors.NotFoundErr(ErrRefreshTokenNotFound, tokenID)
+	}
+	cp := *rt
+	return &cp, nil
+}
+
+func (ms *memstore) RotateRefreshToken(ctx context.Context, currentID string, next *RefreshToken, device *Device) error {
+	rt := ms.tokens[currentID]
+	if rt == nil || rt.RevokedAt != nil {
+		return errors.UnauthenticatedErr(ErrRefreshTokenInactive, ErrRefreshTokenInactive.Error())
+	}
+	now := time.Now()
+	rt.RevokedAt = &now
+	rt.ReplacedBy = next.ID
+	return ms.SaveRefreshToken(ctx, next, device)
+}
+
+func (ms *memstore) RevokeFamily(ctx context.Context, userID, familyID string) error {
+	now := time.Now()
+	for _, rt := range ms.tokens {
+		if rt.UserID == userID && rt.FamilyID == familyID && rt.RevokedAt == nil {
+			rt.RevokedAt = &now
+		}
+	}
+	delete(ms.sessions, familyID)
+	ms.endedSessions[familyID] = true
+	return nil
+}
+
+func (ms *memstore) RevokeToken(ctx context.Context, tokenID, userID string, expiresAt time.Time) error {
+	ms.revoked[tokenID] = true
+	return nil
+}
+
+func (ms *memstore) RevokeUserTokens(ctx context.Context, userID string, expiresAt time.Time) error {
+	ms.revokedBefore[userID] = time.Now()
+	return nil
+}
+
+func (ms *memstore) IsTokenRevoked(ctx context.Context, tokenID, userID, familyID string, issuedAt time.Time) (bool, error) {
+	ms.lookups++
+	// as in pgstore, only a revoked session revokes its tokens, not a missing one
+	revokedBefore, ok := ms.revokedBefore[userID]
+	return ms.revoked[tokenID] || (ok && !revokedBefore.Before(issuedAt)) || ms.endedSessions[familyID], nil
+}
+
+func (ms *memstore) PurgeRevocations(ctx context.Context) error {
+	ms.purges.Add(1)
+	return nil
+}
+
+func (ms *memstore) GetSessions(ctx context.Context, userID string) ([]Session, error) {
+	sessions := make([]Session, 0)
+	for _, session := range ms.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (ms *memstore) GetSession(ctx context.Context, userID, sessionID string) (*Session, error) {
+	session, ok := ms.sessions[sessionID]
+	if !ok || session.UserID != userID {
+		return nil, errors.NotFoundErr(ErrSessionNotFound, sessionID)
+	}
+	cp := *session
+	return &cp, nil
+}
+
+const testFamilyID = "6f1c7a52-4a8e-4d4b-9a57-0c6f2b1d9e10"
+
+func refreshToken(id string) *RefreshToken {
+	return &RefreshToken{
+		ID:        id,
+		FamilyID:  testFamilyID,
+		UserID:    "user",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+func TestTokens_Rotate(t *testing.T) {
+	ctx := context.Background()
+	ms := newMemstore()
+	tk := NewService(&Config{RevocationCacheTTL: time.Minute}, ms)
+
+	err := tk.Issue(ctx, refreshToken("first"), &Device{})
+	if err != nil {
+		t.Fatalf("issue: %+v", err)
+	}
+
+	err = tk.Rotate(ctx, "first", refreshToken("second"), &Device{})
+	if err != nil {
+		t.Fatalf("rotate: %+v", err)
+	}
+
+	// reusing the rotated token must fail and revoke the whole family
+	err = tk.Rotate(ctx, "first", refreshToken("third"), &Device{})
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("got: %v, expected: %v", err, ErrRefreshTokenReused)
+	}
+
+	if ms.tokens["second"].RevokedAt == nil {
+		t.Errorf("expected the latest token of the family to be revoked")
+	}
+
+	err = tk.Rotate(ctx, "second", refreshToken("fourth"), &Device{})
+	if !errors.Is(err, ErrRefreshTokenInactive) {
+		t.Errorf("got: %v, expected: %v", err, ErrRefreshTokenInactive)
+	}
+
+	err = tk.Rotate(ctx, "unknown", refreshToken("fifth"), &Device{})
+	if !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Errorf("got: %v, expected: %v", err, ErrRefreshTokenNotFound)
+	}
+
+	// a token revoked by logging out is not reused, the family is left as is
+	err = tk.Issue(ctx, refreshToken("sixth"), &Device{})
+	if err != nil {
+		t.Fatalf("issue: %+v", err)
+	}
+
+	err = tk.RevokeFamily(ctx, "user", testFamilyID)
+	if err != nil {
+		t.Fatalf("revoke family: %+v", err)
+	}
+
+	err = tk.Rotate(ctx, "sixth", refreshToken("seventh"), &Device{})
+	if !errors.Is(err, ErrRefreshTokenInactive) || errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("got: %v, expected: %v", err, ErrRefreshTokenInactive)
+	}
+}
+
+func TestTokens_IsRevoked(t *testing.T) {
+	ctx := context.Background()
+	ms := newMemstore()
+	tk := NewService(&Config{RevocationCacheTTL: time.Minute}, ms)
+
+	issuedAt := time.Now().Add(-time.Minute)
+	expiresAt := time.Now().Add(time.Hour)
+	_ = tk.Issue(ctx, refreshToken("refresh"), &Device{})
+
+	revoked, _ := tk.IsRevoked(ctx, "access", "user", testFamilyID, issuedAt, expiresAt)
+	if revoked {
+		t.Fatalf("expected token not to be revoked")
+	}
+
+	// served from the cache
+	_, _ = tk.IsRevoked(ctx, "access", "user", testFamilyID, issuedAt, expiresAt)
+	if ms.lookups != 1 {
+		t.Errorf("got: %d store lookups, expected: 1", ms.lookups)
+	}
+
+	// e.g. impersonation tokens do not belong to any session
+	revoked, _ = tk.IsRevoked(ctx, "impersonation", "user", "", issuedAt, expiresAt)
+	if revoked {
+		t.Errorf("expected token without a session not to be revoked")
+	}
+
+	err := tk.Revoke(ctx, "access", "user", expiresAt)
+	if err != nil {
+		t.Fatalf("revoke: %+v", err)
+	}
+
+	revoked, _ = tk.IsRevoked(ctx, "access", "user", testFamilyID, issuedAt, expiresAt)
+	if !revoked {
+		t.Errorf("expected token to be revoked")
+	}
+
+	revoked, _ = tk.IsRevoked(ctx, "other", "user", testFamilyID, issuedAt, expiresAt)
+	if revoked {
+		t.Fatalf("expected other token not to be revoked")
+	}
+
+	err = tk.RevokeAll(ctx, "user", expiresAt)
+	if err != nil {
+		t.Fatalf("revoke all: %+v", err)
+	}
+
+	revoked, _ = tk.IsRevoked(ctx, "other", "user", testFamilyID, issuedAt, expiresAt)
+	if !revoked {
+		t.Errorf("expected all tokens of the user to be revoked")
+	}
+}
+
+func TestTokens_EndSession(t *testing.T) {
+	ctx := context.Background()
+	ms := newMemstore()
+	tk := NewService(&Config{RevocationCacheTTL: time.Minute}, ms)
+
+	err := tk.Issue(ctx, refreshToken("refresh"), &Device{UserAgent: " curl/8.0 ", IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("issue: %+v", err)
+	}
+
+	sessions, _ := tk.Sessions(ctx, "user")
+	if len(sessions) != 1 || sessions[0].ID != testFamilyID || sessions[0].UserAgent != "curl/8.0" {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+
+	issuedAt := time.Now().Add(-time.Minute)
+	expiresAt := time.Now().Add(time.Hour)
+	revoked, _ := tk.IsRevoked(ctx, "access", "user", testFamilyID, issuedAt, expiresAt)
+	if revoked {
+		t.Fatalf("expected token not to be revoked")
+	}
+
+	err = tk.EndSession(ctx, "other-user", testFamilyID)
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("got: %v, expected: %v", err, ErrSessionNotFound)
+	}
+
+	err = tk.EndSession(ctx, "user", testFamilyID)
+	if err != nil {
+		t.Fatalf("end session: %+v", err)
+	}
+
+	// the cached status of the access tokens of the session is forgotten
+	revoked, _ = tk.IsRevoked(ctx, "access", "user", testFamilyID, issuedAt, expiresAt)
+	if !revoked {
+		t.Errorf("expected access token of the ended session to be revoked")
+	}
+
+	if ms.tokens["refresh"].RevokedAt == nil {
+		t.Errorf("expected refresh token of the ended session to be revoked")
+	}
+}
+
+func TestTokens_StartPurge(t *testing.T) {
+	ms := newMemstore()
+	tk := NewService(&Config{RevocationCacheTTL: time.Minute, RevocationPurgeInterval: time.Millisecond}, ms)
+
+	stop := tk.StartPurge(context.Background())
+	for ms.purges.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+
+	// a purge could be in progress while stopping
+	time.Sleep(10 * time.Millisecond)
+	purges := ms.purges.Load()
+	time.Sleep(10 * time.Millisecond)
+	if ms.purges.Load() != purges {
+		t.Errorf("expected no purges after stopping")
+	}
+}
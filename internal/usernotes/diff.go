@@ -0,0 +1,125 @@
+package usernotes
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+
+	// maxDiffEdits bounds the work of diffing, texts differing by more lines than this are diffed
+	// as all of the old lines being replaced by the new ones
+	maxDiffEdits = 500
+	// maxDiffLines is the number of lines of both texts together, beyond which they are diffed as
+	// replaced without even trying, since every edit costs as many steps as there are lines
+	maxDiffLines = 5000
+)
+
+// DiffLine is a line of a diff, which is either in both texts, or only in the old (deleted) or
+// the new (inserted) one
+type DiffLine struct {
+	Op   string
+	Text string
+}
+
+// splitLines splits the text into lines, an empty text having no lines at all
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines returns the shortest line diff turning a into b, using the Myers algorithm
+func diffLines(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	if n+m > maxDiffLines {
+		return replaceDiff(a, b)
+	}
+
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	// v has the furthest x reached on each diagonal k = x - y, at index k + offset
+	v := make([]int, 2*limit+3)
+	// trace has v as it was at the start of each round d, for diagonals -d to d
+	trace := make([][]int, 0)
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+1]))
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace)
+			}
+		}
+	}
+
+	return replaceDiff(a, b)
+}
+
+// backtrackDiff walks back from the end of both texts through the trace of diffLines, collecting
+// the lines of the diff
+func backtrackDiff(a, b []string, trace [][]int) []DiffLine {
+	lines := make([]DiffLine, 0, len(a)+len(b))
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		prevK := k - 1
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			lines = append(lines, DiffLine{Op: DiffEqual, Text: a[x-1]})
+			x--
+			y--
+		}
+
+		if x == prevX {
+			lines = append(lines, DiffLine{Op: DiffInsert, Text: b[y-1]})
+		} else {
+			lines = append(lines, DiffLine{Op: DiffDelete, Text: a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+
+	for x > 0 && y > 0 {
+		lines = append(lines, DiffLine{Op: DiffEqual, Text: a[x-1]})
+		x--
+		y--
+	}
+
+	slices.Reverse(lines)
+	return lines
+}
+
+func replaceDiff(a, b []string) []DiffLine {
+	lines := make([]DiffLine, 0, len(a)+len(b))
+	for _, line := range a {
+		lines = append(lines, DiffLine{Op: DiffDelete, Text: line})
+	}
+	for _, line := range b {
+		lines = append(lines, DiffLine{Op: DiffInsert, Text: line})
+	}
+	return lines
+}
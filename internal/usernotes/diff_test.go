@@ -0,0 +1,86 @@
+package usernotes
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want []DiffLine
+	}{
+		{
+			name: "both empty",
+			want: []DiffLine{},
+		},
+		{
+			name: "equal",
+			a:    "milk\neggs",
+			b:    "milk\neggs",
+			want: []DiffLine{{DiffEqual, "milk"}, {DiffEqual, "eggs"}},
+		},
+		{
+			name: "from empty",
+			b:    "milk",
+			want: []DiffLine{{DiffInsert, "milk"}},
+		},
+		{
+			name: "to empty",
+			a:    "milk",
+			want: []DiffLine{{DiffDelete, "milk"}},
+		},
+		{
+			name: "changed line",
+			a:    "milk\neggs\nbread",
+			b:    "milk\nbutter\nbread",
+			want: []DiffLine{{DiffEqual, "milk"}, {DiffDelete, "eggs"}, {DiffInsert, "butter"}, {DiffEqual, "bread"}},
+		},
+		{
+			name: "inserted and deleted lines",
+			a:    "a\nb\nc\na\nb\nb\na",
+			b:    "c\nb\na\nb\na\nc",
+			want: []DiffLine{
+				{DiffDelete, "a"}, {DiffDelete, "b"}, {DiffEqual, "c"}, {DiffInsert, "b"}, {DiffEqual, "a"},
+				{DiffEqual, "b"}, {DiffDelete, "b"}, {DiffEqual, "a"}, {DiffInsert, "c"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffLines(splitLines(tt.a), splitLines(tt.b))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLines_TooManyLines(t *testing.T) {
+	a := strings.Split(strings.Repeat("a\n", maxDiffLines/2), "\n")
+	b := slices.Clone(a)
+	b[0] = "b"
+
+	got := diffLines(a, b)
+	if len(got) != len(a)+len(b) {
+		t.Errorf("diffLines() has %d lines, want all %d lines replaced", len(got), len(a)+len(b))
+	}
+}
+
+func TestDiffLines_TooManyEdits(t *testing.T) {
+	a := strings.Split(strings.Repeat("a\n", maxDiffEdits), "\n")
+	b := strings.Split(strings.Repeat("b\n", maxDiffEdits), "\n")
+
+	got := diffLines(a, b)
+	if len(got) != len(a)+len(b) {
+		t.Fatalf("diffLines() has %d lines, want %d", len(got), len(a)+len(b))
+	}
+	if got[0].Op != DiffDelete || got[len(got)-1].Op != DiffInsert {
+		t.Errorf("diffLines() = %v ... %v, want all lines replaced", got[0], got[len(got)-1])
+	}
+}
@@ -0,0 +1,173 @@
+package usernotes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+)
+
+// linkTokenLength is the number of random bytes of a link token
+const linkTokenLength = 32
+
+var (
+	ErrLinkNotFound         = errors.New("share link not found")
+	ErrLinkPasswordRequired = errors.New("share link password required")
+	ErrInvalidLinkPassword  = errors.New("invalid share link password")
+)
+
+// PasswordHasher hashes the passwords of links and verifies plain text passwords against them
+type PasswordHasher interface {
+	Hash(plain []byte) ([]byte, error)
+	Verify(hashed []byte, plain []byte) (ok bool, needsRehash bool, err error)
+}
+
+// Link is a public link to a note, anyone having its token can view the note until the link
+// expires or is revoked
+type Link struct {
+	ID     string
+	NoteID string
+	// UserID is the owner of the note, who created the link
+	UserID string
+	// Token is only set when the link is created. It's only stored hashed, hence cannot be shown again
+	Token string
+	// HasPassword is true if the password of the link is required to view the note
+	HasPassword  bool
+	ExpiresAt    *time.Time
+	Views        int64
+	LastViewedAt *time.Time
+	CreatedAt    time.Time
+}
+
+// Expired reports whether the link has expired at the given time
+func (link *Link) Expired(at time.Time) bool {
+	return link.ExpiresAt != nil && !link.ExpiresAt.After(at)
+}
+
+// CreateLink creates a public link to the note of the user, optionally expiring and protected by
+// a password (unless it's empty). Only the owner of the note can create links to it
+func (un *UserNotes) CreateLink(ctx context.Context, userID, noteID string, expiresAt *time.Time, password string) (*Link, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, errors.Validation("share link expiry must be in the future")
+	}
+
+	_, err := un.ownedNote(ctx, userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	var passwordHash []byte
+	if password != "" {
+		passwordHash, err = un.hasher.Hash([]byte(password))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed hashing share link password")
+		}
+	}
+
+	token, err := newLinkToken()
+	if err != nil {
+		return nil, err
+	}
+
+	link := &Link{
+		NoteID:      noteID,
+		UserID:      userID,
+		Token:       token,
+		HasPassword: passwordHash != nil,
+		ExpiresAt:   expiresAt,
+		CreatedAt:   time.Now(),
+	}
+
+	err = un.store.SaveLink(ctx, link, hashLinkToken(token), passwordHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// ListLinks returns the links the user has created which are not revoked, newest first
+func (un *UserNotes) ListLinks(ctx context.Context, userID string) ([]Link, error) {
+	if userID == "" {
+		return nil, errors.Validation("no user ID provided")
+	}
+
+	return un.store.GetLinks(ctx, userID)
+}
+
+// RevokeLink revokes the link of the user, the note cannot be viewed with it anymore
+func (un *UserNotes) RevokeLink(ctx context.Context, userID, linkID string) error {
+	if userID == "" || linkID == "" {
+		return errors.Validation("no user ID or link ID provided")
+	}
+
+	if uuid.Validate(linkID) != nil {
+		return errors.NotFoundErr(ErrLinkNotFound, linkID)
+	}
+
+	return un.store.RevokeLink(ctx, userID, linkID)
+}
+
+// ViewLink returns the note the link is to, counting the view. The password is required if the
+// link has one. Links which are expired or revoked, as well as trashed notes, are not found
+func (un *UserNotes) ViewLink(ctx context.Context, token, password string) (*Note, *Link, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, nil, errors.NotFoundErr(ErrLinkNotFound, ErrLinkNotFound.Error())
+	}
+
+	link, passwordHash, err := un.store.GetLinkByHash(ctx, hashLinkToken(token))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if link.Expired(time.Now()) {
+		return nil, nil, errors.NotFoundErr(ErrLinkNotFound, ErrLinkNotFound.Error())
+	}
+
+	if passwordHash != nil {
+		if password == "" {
+			return nil, nil, errors.UnauthenticatedErr(ErrLinkPasswordRequired, ErrLinkPasswordRequired.Error())
+		}
+
+		ok, _, err := un.hasher.Verify(passwordHash, []byte(password))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed verifying share link password")
+		}
+		if !ok {
+			return nil, nil, errors.UnauthenticatedErr(ErrInvalidLinkPassword, ErrInvalidLinkPassword.Error())
+		}
+	}
+
+	note, err := un.store.GetNoteByID(ctx, link.UserID, link.NoteID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	link.Views, err = un.store.CountLinkView(ctx, link.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return note, link, nil
+}
+
+func newLinkToken() (string, error) {
+	raw := make([]byte, linkTokenLength)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", errors.Wrap(err, "failed generating share link token")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func hashLinkToken(token string) []byte {
+	hashed := sha256.Sum256([]byte(token))
+	return hashed[:]
+}
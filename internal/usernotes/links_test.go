@@ -0,0 +1,145 @@
+package usernotes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+)
+
+// plainHasher "hashes" passwords as they are, which is only good enough for tests
+type plainHasher struct{}
+
+func (plainHasher) Hash(plain []byte) ([]byte, error) {
+	return plain, nil
+}
+
+func (plainHasher) Verify(hashed []byte, plain []byte) (bool, bool, error) {
+	return string(hashed) == string(plain), false, nil
+}
+
+func TestUserNotes_Links(t *testing.T) {
+	ctx := context.Background()
+	store := newMemstore()
+	un := NewService(&Config{}, store, plainHasher{})
+	owner, viewer := uuid.NewString(), uuid.NewString()
+
+	note, err := un.SaveNote(ctx, &Note{UserID: owner, Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("SaveNote() error = %v", err)
+	}
+
+	_, err = un.ShareNote(ctx, owner, note.ID, viewer, RoleViewer)
+	if err != nil {
+		t.Fatalf("ShareNote() error = %v", err)
+	}
+
+	_, err = un.CreateLink(ctx, viewer, note.ID, nil, "")
+	if errors.Type(err) != errors.TypeUnauthorized {
+		t.Errorf("CreateLink() by a viewer error = %v, want unauthorized", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	_, err = un.CreateLink(ctx, owner, note.ID, &past, "")
+	if errors.Type(err) != errors.TypeValidation {
+		t.Errorf("CreateLink() expiring in the past error = %v, want a validation error", err)
+	}
+
+	link, err := un.CreateLink(ctx, owner, note.ID, nil, "secret")
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+	if link.Token == "" || !link.HasPassword {
+		t.Fatalf("CreateLink() = %+v, want a token and a password", link)
+	}
+
+	_, _, err = un.ViewLink(ctx, link.Token, "")
+	if !errors.Is(err, ErrLinkPasswordRequired) {
+		t.Errorf("ViewLink() without the password error = %v, want %v", err, ErrLinkPasswordRequired)
+	}
+
+	_, _, err = un.ViewLink(ctx, link.Token, "guess")
+	if !errors.Is(err, ErrInvalidLinkPassword) {
+		t.Errorf("ViewLink() with a wrong password error = %v, want %v", err, ErrInvalidLinkPassword)
+	}
+
+	for views := int64(1); views <= 2; views++ {
+		viewed, viewedLink, err := un.ViewLink(ctx, link.Token, "secret")
+		if err != nil {
+			t.Fatalf("ViewLink() error = %v", err)
+		}
+		if viewed.ID != note.ID || viewedLink.Views != views {
+			t.Errorf("ViewLink() = note %s, %d views, want note %s, %d views", viewed.ID, viewedLink.Views, note.ID, views)
+		}
+	}
+
+	_, _, err = un.ViewLink(ctx, "unknown", "")
+	if !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("ViewLink() of an unknown token error = %v, want %v", err, ErrLinkNotFound)
+	}
+
+	// expired links are not found, as if they didn't exist
+	expiring := time.Now().Add(time.Minute)
+	expired, err := un.CreateLink(ctx, owner, note.ID, &expiring, "")
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+	store.links[string(hashLinkToken(expired.Token))].ExpiresAt = &past
+	_, _, err = un.ViewLink(ctx, expired.Token, "")
+	if !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("ViewLink() of an expired link error = %v, want %v", err, ErrLinkNotFound)
+	}
+
+	links, err := un.ListLinks(ctx, owner)
+	if err != nil || len(links) != 2 {
+		t.Errorf("ListLinks() = %d links, %v, want 2", len(links), err)
+	}
+
+	err = un.RevokeLink(ctx, viewer, link.ID)
+	if !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("RevokeLink() by another user error = %v, want %v", err, ErrLinkNotFound)
+	}
+
+	err = un.RevokeLink(ctx, owner, link.ID)
+	if err != nil {
+		t.Fatalf("RevokeLink() error = %v", err)
+	}
+
+	_, _, err = un.ViewLink(ctx, link.Token, "secret")
+	if !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("ViewLink() of a revoked link error = %v, want %v", err, ErrLinkNotFound)
+	}
+}
+
+// brokenHasher hashes passwords as they are, but fails verifying them
+type brokenHasher struct {
+	plainHasher
+}
+
+func (brokenHasher) Verify(hashed []byte, plain []byte) (bool, bool, error) {
+	return false, false, errors.New("broken hasher")
+}
+
+func TestUserNotes_ViewLinkVerifyError(t *testing.T) {
+	ctx := context.Background()
+	un := NewService(&Config{}, newMemstore(), brokenHasher{})
+	owner := uuid.NewString()
+
+	note, err := un.SaveNote(ctx, &Note{UserID: owner, Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("SaveNote() error = %v", err)
+	}
+
+	link, err := un.CreateLink(ctx, owner, note.ID, nil, "secret")
+	if err != nil {
+		t.Fatalf("CreateLink() error = %v", err)
+	}
+
+	// failing to verify the password is not a wrong password
+	_, _, err = un.ViewLink(ctx, link.Token, "secret")
+	if err == nil || errors.Is(err, ErrInvalidLinkPassword) {
+		t.Errorf("ViewLink() error = %v, want the verify error", err)
+	}
+}
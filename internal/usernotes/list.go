@@ -0,0 +1,257 @@
+package usernotes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+)
+
+const (
+	SortCreated = "created"
+	SortUpdated = "updated"
+	SortTitle   = "title"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortColumns are the columns notes are sorted by, for each of the sort options
+var sortColumns = map[string]string{
+	SortCreated: "created_at",
+	SortUpdated: "updated_at",
+	SortTitle:   "title",
+}
+
+// ListFilter selects the notes to be listed, and the page of them to be returned
+type ListFilter struct {
+	UserID string
+	// Sort is one of created (the default), updated or title
+	Sort string
+	// Order is asc or desc. Notes are listed newest first, or alphabetically when sorted by title
+	Order string
+	// From and To limit the notes to those created in [From, To), the zero time leaves either end open
+	From time.Time
+	To   time.Time
+	// Limit is the page size, capped to the maximum configured
+	Limit int
+	// Cursor is the next or previous cursor of a page listed with the same filter, empty for the
+	// first page
+	Cursor string
+	// Trashed lists the notes in the trash instead of the others
+	Trashed bool
+	// Shared lists the notes shared with the user instead of the ones they own
+	Shared bool
+	// Tags limits the notes to those having all (the default) or any of the tags, as per TagMatch
+	Tags     []string
+	TagMatch string
+}
+
+func (f *ListFilter) Sanitize() {
+	f.UserID = strings.TrimSpace(f.UserID)
+	f.Sort = strings.ToLower(strings.TrimSpace(f.Sort))
+	f.Order = strings.ToLower(strings.TrimSpace(f.Order))
+	f.Cursor = strings.TrimSpace(f.Cursor)
+	f.Tags = normalizeTags(f.Tags)
+	f.TagMatch = strings.ToLower(strings.TrimSpace(f.TagMatch))
+}
+
+// Page is a page of notes, along with the cursors to the pages around it. A cursor is empty if
+// there are no notes in that direction
+type Page struct {
+	Notes []Note
+	Next  string
+	Prev  string
+}
+
+// cursor is the position in a listing after (or before) which the page starts. It's handed out
+// base64 encoded, and is opaque to clients
+type cursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	// Value is the sort key of the note at the position
+	Value  string `json:"v"`
+	ID     string `json:"id"`
+	Before bool   `json:"b,omitempty"`
+}
+
+func (c *cursor) encode() string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// key returns the sort key of the cursor, as a value comparable to the sort column
+func (c *cursor) key() (any, error) {
+	if c.Sort == SortTitle {
+		return c.Value, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, c.Value)
+}
+
+func decodeCursor(encoded string) (*cursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.ValidationErr(ErrInvalidCursor, "invalid cursor")
+	}
+
+	c := &cursor{}
+	err = json.Unmarshal(payload, c)
+	if err != nil {
+		return nil, errors.ValidationErr(ErrInvalidCursor, "invalid cursor")
+	}
+
+	_, validSort := sortColumns[c.Sort]
+	validOrder := c.Order == OrderAsc || c.Order == OrderDesc
+	if !validSort || !validOrder || uuid.Validate(c.ID) != nil {
+		return nil, errors.ValidationErr(ErrInvalidCursor, "invalid cursor")
+	}
+
+	_, err = c.key()
+	if err != nil {
+		return nil, errors.ValidationErr(ErrInvalidCursor, "invalid cursor")
+	}
+
+	return c, nil
+}
+
+func newCursor(note *Note, sort, order string, before bool) *cursor {
+	c := &cursor{Sort: sort, Order: order, ID: note.ID, Before: before}
+	switch sort {
+	case SortCreated:
+		c.Value = note.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case SortUpdated:
+		c.Value = note.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case SortTitle:
+		c.Value = note.Title
+	}
+
+	return c
+}
+
+// listQuery is a resolved ListFilter, as required by the store
+type listQuery struct {
+	userID string
+	sort   string
+	order  string
+	from   time.Time
+	to     time.Time
+	limit  int
+	// trashed lists the notes in the trash instead of the others
+	trashed  bool
+	shared   bool
+	tags     []string
+	tagMatch string
+	// cursor is nil for the first page
+	cursor *cursor
+	key    any
+}
+
+// backward reports whether the page is the one before the cursor, in which case the store lists
+// the notes in the reverse order
+func (q *listQuery) backward() bool {
+	return q.cursor != nil && q.cursor.Before
+}
+
+func (un *UserNotes) newListQuery(filter *ListFilter) (*listQuery, error) {
+	if filter == nil || filter.UserID == "" {
+		return nil, errors.Validation("no user ID provided")
+	}
+
+	q := &listQuery{
+		userID:   filter.UserID,
+		sort:     filter.Sort,
+		order:    filter.Order,
+		from:     filter.From,
+		to:       filter.To,
+		limit:    filter.Limit,
+		trashed:  filter.Trashed,
+		shared:   filter.Shared,
+		tags:     filter.Tags,
+		tagMatch: filter.TagMatch,
+	}
+
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		if (q.sort != "" && q.sort != c.Sort) || (q.order != "" && q.order != c.Order) {
+			return nil, errors.Validation("cursor does not belong to a listing with the same sort order")
+		}
+
+		q.sort, q.order, q.cursor = c.Sort, c.Order, c
+		q.key, _ = c.key()
+	}
+
+	if q.sort == "" {
+		q.sort = SortCreated
+	}
+	if _, ok := sortColumns[q.sort]; !ok {
+		return nil, errors.Validationf("invalid sort %q, expected one of created, updated or title", q.sort)
+	}
+
+	if q.order == "" {
+		q.order = OrderDesc
+		if q.sort == SortTitle {
+			q.order = OrderAsc
+		}
+	}
+	if q.order != OrderAsc && q.order != OrderDesc {
+		return nil, errors.Validationf("invalid order %q, expected asc or desc", q.order)
+	}
+
+	if q.tagMatch == "" {
+		q.tagMatch = TagMatchAll
+	}
+	if q.tagMatch != TagMatchAll && q.tagMatch != TagMatchAny {
+		return nil, errors.Validationf("invalid tag match %q, expected all or any", q.tagMatch)
+	}
+
+	if !q.from.IsZero() && !q.to.IsZero() && !q.to.After(q.from) {
+		return nil, errors.Validation("the end of the date range must be after its start")
+	}
+
+	if q.limit <= 0 {
+		q.limit = un.cfg.DefaultPageSize
+	}
+	q.limit = min(q.limit, un.cfg.MaxPageSize)
+
+	return q, nil
+}
+
+// newPage builds the page out of the notes listed by the store for the query, i.e. at most one
+// more than the page size, the extra one only telling that there are more
+func newPage(notes []Note, q *listQuery) *Page {
+	more := len(notes) > q.limit
+	if more {
+		notes = notes[:q.limit]
+	}
+
+	backward := q.backward()
+	if backward {
+		slices.Reverse(notes)
+	}
+
+	page := &Page{Notes: notes}
+	if len(notes) == 0 {
+		return page
+	}
+
+	first, last := &notes[0], &notes[len(notes)-1]
+	if (backward && more) || (!backward && q.cursor != nil) {
+		page.Prev = newCursor(first, q.sort, q.order, true).encode()
+	}
+	if (!backward && more) || backward {
+		page.Next = newCursor(last, q.sort, q.order, false).encode()
+	}
+
+	return page
+}
@@ -0,0 +1,195 @@
+package usernotes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+)
+
+func testService() *UserNotes {
+	return NewService(&Config{DefaultPageSize: 2, MaxPageSize: 3}, nil, nil)
+}
+
+func testNotes(n int) []Note {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	notes := make([]Note, 0, n)
+	for i := range n {
+		notes = append(notes, Note{
+			ID:        uuid.New().String(),
+			Title:     string(rune('a' + i)),
+			CreatedAt: start.Add(time.Duration(i) * time.Hour),
+			UpdatedAt: start.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	return notes
+}
+
+func TestCursor(t *testing.T) {
+	note := &testNotes(1)[0]
+	for _, sort := range []string{SortCreated, SortUpdated, SortTitle} {
+		encoded := newCursor(note, sort, OrderAsc, true).encode()
+		c, err := decodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("decodeCursor(%s) error = %v", sort, err)
+		}
+		if c.Sort != sort || c.Order != OrderAsc || c.ID != note.ID || !c.Before {
+			t.Errorf("decodeCursor(%s) = %+v", sort, c)
+		}
+	}
+
+	invalid := []string{
+		"not base64!",
+		(&cursor{Sort: "size", Order: OrderAsc, ID: note.ID}).encode(),
+		(&cursor{Sort: SortCreated, Order: "up", Value: "2024-01-01T00:00:00Z", ID: note.ID}).encode(),
+		(&cursor{Sort: SortCreated, Order: OrderAsc, Value: "yesterday", ID: note.ID}).encode(),
+		(&cursor{Sort: SortTitle, Order: OrderAsc, Value: "a", ID: "1"}).encode(),
+	}
+	for _, encoded := range invalid {
+		_, err := decodeCursor(encoded)
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) error = %v, want %v", encoded, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestUserNotes_newListQuery(t *testing.T) {
+	un := testService()
+	note := &testNotes(1)[0]
+	titleCursor := newCursor(note, SortTitle, OrderDesc, false).encode()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		filter  *ListFilter
+		want    listQuery
+		wantErr bool
+	}{
+		{
+			name:   "defaults",
+			filter: &ListFilter{UserID: "user"},
+			want:   listQuery{sort: SortCreated, order: OrderDesc, limit: 2},
+		},
+		{
+			name:   "title is alphabetical by default",
+			filter: &ListFilter{UserID: "user", Sort: SortTitle},
+			want:   listQuery{sort: SortTitle, order: OrderAsc, limit: 2},
+		},
+		{
+			name:   "limit is capped",
+			filter: &ListFilter{UserID: "user", Limit: 10},
+			want:   listQuery{sort: SortCreated, order: OrderDesc, limit: 3},
+		},
+		{
+			name:   "cursor sets the sort order",
+			filter: &ListFilter{UserID: "user", Cursor: titleCursor},
+			want:   listQuery{sort: SortTitle, order: OrderDesc, limit: 2},
+		},
+		{
+			name:    "cursor of another sort order",
+			filter:  &ListFilter{UserID: "user", Order: OrderAsc, Cursor: titleCursor},
+			wantErr: true,
+		},
+		{
+			name:    "no user",
+			filter:  &ListFilter{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid sort",
+			filter:  &ListFilter{UserID: "user", Sort: "size"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid order",
+			filter:  &ListFilter{UserID: "user", Order: "up"},
+			wantErr: true,
+		},
+		{
+			name:    "empty date range",
+			filter:  &ListFilter{UserID: "user", From: day, To: day},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := un.newListQuery(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newListQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if q.sort != tt.want.sort || q.order != tt.want.order || q.limit != tt.want.limit {
+				t.Errorf("newListQuery() = %s %s %d, want %s %s %d", q.sort, q.order, q.limit, tt.want.sort, tt.want.order, tt.want.limit)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	notes := testNotes(4)
+	after := newCursor(&notes[0], SortCreated, OrderAsc, false)
+	before := newCursor(&notes[3], SortCreated, OrderAsc, true)
+
+	tests := []struct {
+		name      string
+		listed    []Note
+		cursor    *cursor
+		wantFirst string
+		wantNext  bool
+		wantPrev  bool
+	}{
+		{
+			name:      "first page with more",
+			listed:    []Note{notes[0], notes[1], notes[2]},
+			wantFirst: notes[0].ID,
+			wantNext:  true,
+		},
+		{
+			name:      "only page",
+			listed:    []Note{notes[0]},
+			wantFirst: notes[0].ID,
+		},
+		{
+			name:      "last page",
+			listed:    []Note{notes[1], notes[2]},
+			cursor:    after,
+			wantFirst: notes[1].ID,
+			wantPrev:  true,
+		},
+		{
+			// listed backward, i.e. in the reverse order
+			name:      "page before with more",
+			listed:    []Note{notes[2], notes[1], notes[0]},
+			cursor:    before,
+			wantFirst: notes[1].ID,
+			wantNext:  true,
+			wantPrev:  true,
+		},
+		{
+			name:      "first page listed backward",
+			listed:    []Note{notes[2], notes[1]},
+			cursor:    before,
+			wantFirst: notes[1].ID,
+			wantNext:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := newPage(tt.listed, &listQuery{sort: SortCreated, order: OrderAsc, limit: 2, cursor: tt.cursor})
+			if page.Notes[0].ID != tt.wantFirst {
+				t.Errorf("newPage() first note = %s, want %s", page.Notes[0].ID, tt.wantFirst)
+			}
+			if (page.Next != "") != tt.wantNext {
+				t.Errorf("newPage() next = %q, want next %v", page.Next, tt.wantNext)
+			}
+			if (page.Prev != "") != tt.wantPrev {
+				t.Errorf("newPage() prev = %q, want prev %v", page.Prev, tt.wantPrev)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package usernotes
+
+import (
+	"context"
+	"time"
+
+	"github.com/naughtygopher/errors"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is a note as it was at one of its versions. Revisions are never changed, restoring one
+// creates a new revision instead
+type Revision struct {
+	NoteID string
+	// Version is the version of the note the revision is of
+	Version int
+	Title   string
+	Content string
+	Tags    []string
+	// AuthorID is the user who made the change, empty if they've been deleted since
+	AuthorID  string
+	CreatedAt time.Time
+}
+
+// RevisionDiff is the line diff of the title and the content of a note between two revisions
+type RevisionDiff struct {
+	From    int
+	To      int
+	Title   []DiffLine
+	Content []DiffLine
+}
+
+// ListRevisions returns the revisions of the note, newest first
+func (un *UserNotes) ListRevisions(ctx context.Context, userID, noteID string) ([]Revision, error) {
+	// makes sure the note is of the user
+	_, err := un.GetNoteByID(ctx, userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	return un.store.GetRevisions(ctx, noteID)
+}
+
+// DiffRevisions returns the diff from one revision of the note to another. If to is 0, the diff is
+// to the current version of the note
+func (un *UserNotes) DiffRevisions(ctx context.Context, userID, noteID string, from, to int) (*RevisionDiff, error) {
+	note, err := un.GetNoteByID(ctx, userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if to == 0 {
+		to = note.Version
+	}
+
+	fromRev, err := un.store.GetRevision(ctx, noteID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toRev, err := un.store.GetRevision(ctx, noteID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevisionDiff{
+		From:    from,
+		To:      to,
+		Title:   diffLines(splitLines(fromRev.Title), splitLines(toRev.Title)),
+		Content: diffLines(splitLines(fromRev.Content), splitLines(toRev.Content)),
+	}, nil
+}
+
+// RestoreRevision updates the note back to how it was at the revision, which creates a new
+// revision. Like UpdateNote, the note is only updated if it's still at the given version, unless
+// it's 0
+func (un *UserNotes) RestoreRevision(ctx context.Context, userID, noteID string, revision, version int) (*Note, error) {
+	_, err := un.GetNoteByID(ctx, userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := un.store.GetRevision(ctx, noteID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return un.UpdateNote(ctx, userID, noteID, &NoteUpdate{
+		Title:   &rev.Title,
+		Content: &rev.Content,
+		Tags:    rev.Tags,
+	}, version)
+}
@@ -0,0 +1,67 @@
+package usernotes
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/naughtygopher/errors"
+)
+
+func TestUserNotes_Revisions(t *testing.T) {
+	ctx := context.Background()
+	un := NewService(&Config{}, newMemstore(), nil)
+
+	note, err := un.SaveNote(ctx, &Note{UserID: "user", Title: "Groceries", Content: "milk\neggs"})
+	if err != nil {
+		t.Fatalf("SaveNote() error = %v", err)
+	}
+
+	content := "milk\nbutter"
+	_, err = un.UpdateNote(ctx, note.UserID, note.ID, &NoteUpdate{Content: &content}, 1)
+	if err != nil {
+		t.Fatalf("UpdateNote() error = %v", err)
+	}
+
+	diff, err := un.DiffRevisions(ctx, note.UserID, note.ID, 1, 0)
+	if err != nil {
+		t.Fatalf("DiffRevisions() error = %v", err)
+	}
+	expected := []DiffLine{{DiffEqual, "milk"}, {DiffDelete, "eggs"}, {DiffInsert, "butter"}}
+	if diff.To != 2 || !reflect.DeepEqual(diff.Content, expected) {
+		t.Errorf("DiffRevisions() = to %d, %v, want to 2, %v", diff.To, diff.Content, expected)
+	}
+
+	// restoring an outdated version of the note is rejected like any other update
+	_, err = un.RestoreRevision(ctx, note.UserID, note.ID, 1, 1)
+	mismatch := &VersionMismatchError{}
+	if !errors.As(err, &mismatch) {
+		t.Errorf("RestoreRevision() at an outdated version error = %v, want a version mismatch", err)
+	}
+
+	restored, err := un.RestoreRevision(ctx, note.UserID, note.ID, 1, 2)
+	if err != nil {
+		t.Fatalf("RestoreRevision() error = %v", err)
+	}
+	if restored.Version != 3 || restored.Content != "milk\neggs" {
+		t.Errorf("RestoreRevision() = version %d, %q, want version 3 with the first content", restored.Version, restored.Content)
+	}
+
+	revisions, err := un.ListRevisions(ctx, note.UserID, note.ID)
+	if err != nil {
+		t.Fatalf("ListRevisions() error = %v", err)
+	}
+	if len(revisions) != 3 || revisions[0].Version != 3 || revisions[0].AuthorID != note.UserID {
+		t.Errorf("ListRevisions() = %+v, want 3 revisions, newest first", revisions)
+	}
+
+	_, err = un.RestoreRevision(ctx, note.UserID, note.ID, 7, 0)
+	if !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("RestoreRevision() of a missing revision error = %v, want %v", err, ErrRevisionNotFound)
+	}
+
+	_, err = un.ListRevisions(ctx, "someone else", note.ID)
+	if !errors.Is(err, ErrNoteNotFound) {
+		t.Errorf("ListRevisions() of another user's note error = %v, want %v", err, ErrNoteNotFound)
+	}
+}
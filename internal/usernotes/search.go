@@ -0,0 +1,98 @@
+package usernotes
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/naughtygopher/errors"
+)
+
+// maxSearchQueryLength is the maximum length of a search query, in bytes
+const maxSearchQueryLength = 256
+
+// SearchResult is a note matching a search, along with the matches highlighted
+type SearchResult struct {
+	Note
+	// Rank is the relevance of the note, higher is better
+	Rank float32
+	// TitleHighlight is the title, and Snippet the fragments of the content around the matches.
+	// Both are HTML escaped, with the matching words wrapped in <mark>
+	TitleHighlight string
+	Snippet        string
+}
+
+// toTSQuery converts a search query to a Postgres tsquery, in which all the words have to match.
+// Words in double quotes have to match as a phrase, and a word ending with * matches as a prefix.
+// Anything other than letters and digits is dropped, so the result is always a valid tsquery
+func toTSQuery(query string) string {
+	terms := make([]string, 0)
+	for i, part := range strings.Split(query, `"`) {
+		// parts at odd indexes are between quotes
+		if i%2 == 1 {
+			if term := tsPhrase(part); term != "" {
+				terms = append(terms, term)
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			if term := tsPhrase(word); term != "" {
+				terms = append(terms, term)
+			}
+		}
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// tsPhrase returns the words of the text as a tsquery phrase, the last word being a prefix if the
+// text ends with *
+func tsPhrase(text string) string {
+	prefix := strings.HasSuffix(strings.TrimSpace(text), "*")
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	if prefix {
+		words[len(words)-1] += ":*"
+	}
+
+	if len(words) == 1 {
+		return words[0]
+	}
+
+	return "(" + strings.Join(words, " <-> ") + ")"
+}
+
+// SearchNotes returns the user's notes matching the query (see toTSQuery), most relevant first.
+// Trashed notes are not searched
+func (un *UserNotes) SearchNotes(ctx context.Context, userID, query string, limit int) ([]SearchResult, error) {
+	if userID == "" {
+		return nil, errors.Validation("no user ID provided")
+	}
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.Validation("search query cannot be empty")
+	}
+
+	if len(query) > maxSearchQueryLength {
+		return nil, errors.Validationf("search query cannot be longer than %d characters", maxSearchQueryLength)
+	}
+
+	tsquery := toTSQuery(query)
+	if tsquery == "" {
+		return nil, errors.Validation("search query has no words to search for")
+	}
+
+	if limit <= 0 {
+		limit = un.cfg.DefaultPageSize
+	}
+	limit = min(limit, un.cfg.MaxPageSize)
+
+	return un.store.SearchNotes(ctx, userID, tsquery, limit)
+}
@@ -0,0 +1,59 @@
+package usernotes
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestToTSQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "shopping list", want: "shopping & list"},
+		{query: `"shopping list" milk`, want: "(shopping <-> list) & milk"},
+		{query: "shop*", want: "shop:*"},
+		{query: `"grocery shop*"`, want: "(grocery <-> shop:*)"},
+		{query: "e-mail", want: "(e <-> mail)"},
+		{query: "café 2024", want: "café & 2024"},
+		{query: `milk & !(eggs | bread):* <->`, want: "milk & eggs & bread:*"},
+		{query: `"unterminated phrase`, want: "(unterminated <-> phrase)"},
+		{query: `& | ! "" *`, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := toTSQuery(tt.query)
+			if got != tt.want {
+				t.Errorf("toTSQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserNotes_SearchNotes(t *testing.T) {
+	un := NewService(&Config{DefaultPageSize: 2, MaxPageSize: 3}, newMemstore(), nil)
+
+	tests := []struct {
+		name    string
+		userID  string
+		query   string
+		wantErr bool
+	}{
+		{name: "valid", userID: "user", query: "milk"},
+		{name: "no user", query: "milk", wantErr: true},
+		{name: "empty", userID: "user", query: "  ", wantErr: true},
+		{name: "no words", userID: "user", query: "* & !", wantErr: true},
+		{name: "too long", userID: "user", query: strings.Repeat("a", maxSearchQueryLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := un.SearchNotes(context.Background(), tt.userID, tt.query, 0)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SearchNotes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package usernotes
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+)
+
+const (
+	// RoleOwner is the role of the user who created the note. It can't be shared
+	RoleOwner = "owner"
+	// RoleEditor can read and update the note
+	RoleEditor = "editor"
+	// RoleViewer can only read the note
+	RoleViewer = "viewer"
+)
+
+var ErrShareNotFound = errors.New("note share not found")
+
+// Share is a note being shared with another user than its owner
+type Share struct {
+	NoteID string
+	UserID string
+	// Email is that of the user the note is shared with
+	Email string
+	// Role is either editor or viewer
+	Role string
+	// SharedBy is the user who shared the note, empty if they've been deleted since
+	SharedBy  string
+	CreatedAt time.Time
+}
+
+// CanEdit reports whether the user the note was read by can update it
+func (note *Note) CanEdit() bool {
+	return note.Role == RoleOwner || note.Role == RoleEditor
+}
+
+// ownedNote returns the note if it's owned by the user, only the owner can share the note
+func (un *UserNotes) ownedNote(ctx context.Context, userID, noteID string) (*Note, error) {
+	note, err := un.GetNoteByID(ctx, userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if note.Role != RoleOwner {
+		return nil, errors.Unauthorized("only the owner of the note can share it")
+	}
+
+	return note, nil
+}
+
+// ShareNote shares the note of the user with another one, as an editor or a viewer. Sharing the
+// note again with the same user changes their role
+func (un *UserNotes) ShareNote(ctx context.Context, userID, noteID, sharedWithID, role string) (*Share, error) {
+	if sharedWithID == "" {
+		return nil, errors.Validation("no user to share the note with provided")
+	}
+
+	note, role, err := un.shareableNote(ctx, userID, noteID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if sharedWithID == note.UserID {
+		return nil, errors.Validation("note cannot be shared with its owner")
+	}
+
+	share := &Share{
+		NoteID:   noteID,
+		UserID:   sharedWithID,
+		Role:     role,
+		SharedBy: userID,
+	}
+
+	err = un.store.SaveShare(ctx, share)
+	if err != nil {
+		return nil, err
+	}
+
+	return share, nil
+}
+
+// CanShare returns the error ShareNote would, if the note could not be shared with anyone as
+// the role. e.g. to respond the same way when there is no user to share the note with.
+func (un *UserNotes) CanShare(ctx context.Context, userID, noteID, role string) error {
+	_, _, err := un.shareableNote(ctx, userID, noteID, role)
+	return err
+}
+
+// shareableNote returns the note of the user if they can share it as the role, along with the
+// normalized role
+func (un *UserNotes) shareableNote(ctx context.Context, userID, noteID, role string) (*Note, string, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if role != RoleEditor && role != RoleViewer {
+		return nil, "", errors.Validationf("invalid role %q, expected editor or viewer", role)
+	}
+
+	note, err := un.ownedNote(ctx, userID, noteID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return note, role, nil
+}
+
+// ListShares returns the users the note of the user is shared with, in the order it was shared
+func (un *UserNotes) ListShares(ctx context.Context, userID, noteID string) ([]Share, error) {
+	_, err := un.ownedNote(ctx, userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	return un.store.GetShares(ctx, noteID)
+}
+
+// RevokeShare stops sharing the note with the user. Other than the owner, users can only revoke
+// the note being shared with themselves
+func (un *UserNotes) RevokeShare(ctx context.Context, userID, noteID, sharedWithID string) error {
+	note, err := un.GetNoteByID(ctx, userID, noteID)
+	if err != nil {
+		return err
+	}
+
+	if note.Role != RoleOwner && sharedWithID != userID {
+		return errors.Unauthorized("only the owner of the note can manage its shares")
+	}
+
+	if uuid.Validate(sharedWithID) != nil {
+		return errors.NotFoundErr(ErrShareNotFound, sharedWithID)
+	}
+
+	return un.store.DeleteShare(ctx, noteID, sharedWithID)
+}
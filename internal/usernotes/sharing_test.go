@@ -0,0 +1,120 @@
+package usernotes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+)
+
+func TestUserNotes_Sharing(t *testing.T) {
+	ctx := context.Background()
+	store := newMemstore()
+	un := NewService(&Config{}, store, nil)
+	owner, editor, viewer := uuid.NewString(), uuid.NewString(), uuid.NewString()
+
+	note, err := un.SaveNote(ctx, &Note{UserID: owner, Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("SaveNote() error = %v", err)
+	}
+
+	_, err = un.ShareNote(ctx, owner, note.ID, owner, RoleEditor)
+	if errors.Type(err) != errors.TypeValidation {
+		t.Errorf("ShareNote() with the owner error = %v, want a validation error", err)
+	}
+
+	_, err = un.ShareNote(ctx, owner, note.ID, editor, RoleOwner)
+	if errors.Type(err) != errors.TypeValidation {
+		t.Errorf("ShareNote() as owner error = %v, want a validation error", err)
+	}
+
+	_, err = un.ShareNote(ctx, owner, note.ID, editor, RoleEditor)
+	if err != nil {
+		t.Fatalf("ShareNote() error = %v", err)
+	}
+
+	_, err = un.ShareNote(ctx, owner, note.ID, viewer, RoleViewer)
+	if err != nil {
+		t.Fatalf("ShareNote() error = %v", err)
+	}
+
+	// only the owner manages the shares of the note
+	_, err = un.ShareNote(ctx, editor, note.ID, uuid.NewString(), RoleViewer)
+	if errors.Type(err) != errors.TypeUnauthorized {
+		t.Errorf("ShareNote() by an editor error = %v, want unauthorized", err)
+	}
+
+	// CanShare fails the same way as ShareNote, without anyone to share the note with
+	err = un.CanShare(ctx, editor, note.ID, RoleViewer)
+	if errors.Type(err) != errors.TypeUnauthorized {
+		t.Errorf("CanShare() by an editor error = %v, want unauthorized", err)
+	}
+
+	err = un.CanShare(ctx, owner, note.ID, RoleOwner)
+	if errors.Type(err) != errors.TypeValidation {
+		t.Errorf("CanShare() as owner error = %v, want a validation error", err)
+	}
+
+	err = un.CanShare(ctx, owner, note.ID, RoleViewer)
+	if err != nil {
+		t.Errorf("CanShare() error = %v", err)
+	}
+
+	read, err := un.GetNoteByID(ctx, viewer, note.ID)
+	if err != nil || read.Role != RoleViewer {
+		t.Fatalf("GetNoteByID() by a viewer = %v, %v, want the note as a viewer", read, err)
+	}
+
+	title := "Renamed"
+	_, err = un.UpdateNote(ctx, viewer, note.ID, &NoteUpdate{Title: &title}, 0)
+	if errors.Type(err) != errors.TypeUnauthorized {
+		t.Errorf("UpdateNote() by a viewer error = %v, want unauthorized", err)
+	}
+
+	err = un.TrashNote(ctx, editor, note.ID)
+	if errors.Type(err) != errors.TypeUnauthorized {
+		t.Errorf("TrashNote() by an editor error = %v, want unauthorized", err)
+	}
+
+	updated, err := un.UpdateNote(ctx, editor, note.ID, &NoteUpdate{Title: &title}, 0)
+	if err != nil {
+		t.Fatalf("UpdateNote() by an editor error = %v", err)
+	}
+	if updated.UserID != owner {
+		t.Errorf("UpdateNote() by an editor changed the owner to %s", updated.UserID)
+	}
+
+	revisions, err := un.ListRevisions(ctx, viewer, note.ID)
+	if err != nil || revisions[0].AuthorID != editor {
+		t.Errorf("ListRevisions() = %v, %v, want the latest revision by the editor", revisions, err)
+	}
+
+	// the users the note is shared with can revoke their own share only
+	err = un.RevokeShare(ctx, viewer, note.ID, editor)
+	if errors.Type(err) != errors.TypeUnauthorized {
+		t.Errorf("RevokeShare() of another user error = %v, want unauthorized", err)
+	}
+
+	err = un.RevokeShare(ctx, viewer, note.ID, viewer)
+	if err != nil {
+		t.Fatalf("RevokeShare() of their own error = %v", err)
+	}
+
+	err = un.RevokeShare(ctx, owner, note.ID, editor)
+	if err != nil {
+		t.Fatalf("RevokeShare() error = %v", err)
+	}
+
+	for _, userID := range []string{editor, viewer} {
+		_, err = un.GetNoteByID(ctx, userID, note.ID)
+		if !errors.Is(err, ErrNoteNotFound) {
+			t.Errorf("GetNoteByID() after revoking error = %v, want %v", err, ErrNoteNotFound)
+		}
+	}
+
+	err = un.RevokeShare(ctx, owner, note.ID, editor)
+	if !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("RevokeShare() again error = %v, want %v", err, ErrShareNotFound)
+	}
+}
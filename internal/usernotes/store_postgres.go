@@ -3,31 +3,71 @@ package usernotes
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/naughtygopher/errors"
 )
 
 var QueryTimeoutDuration = 5 * time.Second
 
+// htmlEscapedColumn escapes the text of a column for HTML, so that highlighted search matches can be
+// rendered as is
+const htmlEscapedColumn = `replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+
 type pgstore struct {
-	pqdriver  *pgxpool.Pool
-	tableName string
+	pqdriver       *pgxpool.Pool
+	tableName      string
+	tagsTable      string
+	noteTagsTable  string
+	revisionsTable string
+	sharesTable    string
+	usersTable     string
+	linksTable     string
+}
+
+// tagsColumn is the expression selecting the tags of a note, sorted by name
+func (ps *pgstore) tagsColumn() string {
+	return fmt.Sprintf(`array(
+			SELECT t.name FROM %s nt JOIN %s t ON t.id = nt.tag_id
+			WHERE nt.note_id = %s.id
+			ORDER BY t.name
+		)`,
+		ps.noteTagsTable, ps.tagsTable, ps.tableName,
+	)
+}
+
+// roleColumn is the expression selecting the role of the user (the query param) on a note, NULL if
+// the note is neither owned by nor shared with the user
+func (ps *pgstore) roleColumn(userParam string) string {
+	return fmt.Sprintf(`CASE WHEN %[1]s.user_id = %[2]s THEN '%[3]s' ELSE (
+			SELECT s.role FROM %[4]s s WHERE s.note_id = %[1]s.id AND s.user_id = %[2]s
+		) END`,
+		ps.tableName, userParam, RoleOwner, ps.sharesTable,
+	)
+}
+
+// sharedWith is the condition on a note being shared with the user (the query param)
+func (ps *pgstore) sharedWith(userParam string) string {
+	return fmt.Sprintf(`id IN (SELECT note_id FROM %s WHERE user_id = %s)`, ps.sharesTable, userParam)
 }
 
 func (ps *pgstore) GetNoteByID(ctx context.Context, userID string, noteID string) (*Note, error) {
 	query := fmt.Sprintf(`
-		SELECT title, content, created_at, updated_at
+		SELECT user_id, title, content, %s, version, created_at, updated_at, %s
 		FROM %s
-		WHERE id = $1 AND user_id = $2`,
+		WHERE id = $1 AND deleted_at IS NULL AND (user_id = $2 OR %s)`,
+		ps.tagsColumn(),
+		ps.roleColumn("$2"),
 		ps.tableName,
+		ps.sharedWith("$2"),
 	)
 
 	usernote := &Note{
-		ID:     noteID,
-		UserID: userID,
+		ID: noteID,
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -36,12 +76,19 @@ func (ps *pgstore) GetNoteByID(ctx context.Context, userID string, noteID string
 	err := ps.pqdriver.QueryRow(
 		ctx, query, noteID, userID,
 	).Scan(
+		&usernote.UserID,
 		&usernote.Title,
 		&usernote.Content,
+		&usernote.Tags,
+		&usernote.Version,
 		&usernote.CreatedAt,
 		&usernote.UpdatedAt,
+		&usernote.Role,
 	)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NotFoundErr(ErrNoteNotFound, noteID)
+		}
 		return nil, errors.Wrap(err, "failed getting user note")
 	}
 
@@ -60,7 +107,15 @@ func (ps *pgstore) SaveNote(ctx context.Context, note *Note) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := ps.pqdriver.Exec(ctx, query,
+	tx, err := ps.pqdriver.Begin(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	_, err = tx.Exec(ctx, query,
 		noteID,
 		note.Title,
 		note.Content,
@@ -70,16 +125,743 @@ func (ps *pgstore) SaveNote(ctx context.Context, note *Note) (string, error) {
 		return "", errors.Wrap(err, "failed storing note")
 	}
 
+	err = ps.setTags(ctx, tx, noteID, note.UserID, note.Tags)
+	if err != nil {
+		return "", err
+	}
+
+	err = ps.saveRevision(ctx, tx, noteID, 1, note, note.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed committing transaction")
+	}
+
 	return noteID, nil
 }
 
+// setTags replaces the tags of the note, creating the ones the user doesn't have yet
+func (ps *pgstore) setTags(ctx context.Context, tx pgx.Tx, noteID, userID string, tags []string) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE note_id = $1`, ps.noteTagsTable), noteID)
+	if err != nil {
+		return errors.Wrap(err, "failed removing note tags")
+	}
+
+	// the no-op update makes sure the ID is returned if the tag exists
+	upsertTag := fmt.Sprintf(`
+		INSERT INTO %s (id, user_id, name)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id`,
+		ps.tagsTable,
+	)
+	linkTag := fmt.Sprintf(
+		`INSERT INTO %s (note_id, tag_id) VALUES ($1, $2)`,
+		ps.noteTagsTable,
+	)
+
+	for _, tag := range tags {
+		tagID := ""
+		err = tx.QueryRow(ctx, upsertTag, uuid.New().String(), userID, tag).Scan(&tagID)
+		if err != nil {
+			return errors.Wrap(err, "failed storing tag")
+		}
+
+		_, err = tx.Exec(ctx, linkTag, noteID, tagID)
+		if err != nil {
+			return errors.Wrap(err, "failed storing note tag")
+		}
+	}
+
+	return nil
+}
+
+func (ps *pgstore) UpdateNote(ctx context.Context, note *Note, version int, authorID string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET title = $1, content = $2, version = version + 1
+		WHERE id = $3 AND user_id = $4 AND version = $5 AND deleted_at IS NULL
+		RETURNING version, updated_at`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.pqdriver.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	err = tx.QueryRow(
+		ctx, query, note.Title, note.Content, note.ID, note.UserID, version,
+	).Scan(&note.Version, &note.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// the note was updated (or deleted) since it was read
+			return &VersionMismatchError{}
+		}
+		return errors.Wrap(err, "failed updating note")
+	}
+
+	err = ps.setTags(ctx, tx, note.ID, note.UserID, note.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = ps.saveRevision(ctx, tx, note.ID, note.Version, note, authorID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed committing transaction")
+	}
+
+	return nil
+}
+
+// saveRevision saves the note as the revision of the given version
+func (ps *pgstore) saveRevision(ctx context.Context, tx pgx.Tx, noteID string, version int, note *Note, authorID string) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (note_id, version, title, content, tags, author_id)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		ps.revisionsTable,
+	)
+
+	_, err := tx.Exec(ctx, query, noteID, version, note.Title, note.Content, note.Tags, authorID)
+	if err != nil {
+		return errors.Wrap(err, "failed storing note revision")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) GetRevisions(ctx context.Context, noteID string) ([]Revision, error) {
+	query := fmt.Sprintf(`
+		SELECT note_id, version, title, content, tags, COALESCE(author_id::text, ''), created_at
+		FROM %s
+		WHERE note_id = $1
+		ORDER BY version DESC`,
+		ps.revisionsTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, noteID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed getting note revisions")
+	}
+	defer rows.Close()
+
+	revisions := make([]Revision, 0)
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading note revision")
+		}
+		revisions = append(revisions, *revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed getting note revisions")
+	}
+
+	return revisions, nil
+}
+
+func (ps *pgstore) GetRevision(ctx context.Context, noteID string, version int) (*Revision, error) {
+	query := fmt.Sprintf(`
+		SELECT note_id, version, title, content, tags, COALESCE(author_id::text, ''), created_at
+		FROM %s
+		WHERE note_id = $1 AND version = $2`,
+		ps.revisionsTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	revision, err := scanRevision(ps.pqdriver.QueryRow(ctx, query, noteID, version))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NotFoundErr(ErrRevisionNotFound, fmt.Sprintf("%s@%d", noteID, version))
+		}
+		return nil, errors.Wrap(err, "failed getting note revision")
+	}
+
+	return revision, nil
+}
+
+func scanRevision(row pgx.Row) (*Revision, error) {
+	revision := &Revision{}
+	err := row.Scan(
+		&revision.NoteID,
+		&revision.Version,
+		&revision.Title,
+		&revision.Content,
+		&revision.Tags,
+		&revision.AuthorID,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+func (ps *pgstore) GetNotesByUser(ctx context.Context, userID string) ([]Note, error) {
+	query := fmt.Sprintf(`
+		SELECT id, title, content, %s, version, created_at, updated_at, deleted_at
+		FROM %s
+		WHERE user_id = $1
+		ORDER BY created_at, id`,
+		ps.tagsColumn(),
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed getting user notes")
+	}
+	defer rows.Close()
+
+	notes := make([]Note, 0)
+	for rows.Next() {
+		note := Note{UserID: userID, Role: RoleOwner}
+		err = rows.Scan(&note.ID, &note.Title, &note.Content, &note.Tags, &note.Version, &note.CreatedAt, &note.UpdatedAt, &note.DeletedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading user note")
+		}
+		notes = append(notes, note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed getting user notes")
+	}
+
+	return notes, nil
+}
+
+func (ps *pgstore) ListNotes(ctx context.Context, q *listQuery) ([]Note, error) {
+	column := sortColumns[q.sort]
+	desc := q.order == OrderDesc
+	if q.backward() {
+		desc = !desc
+	}
+
+	comparison, direction := ">", "ASC"
+	if desc {
+		comparison, direction = "<", "DESC"
+	}
+
+	args := []any{q.userID}
+	conditions := []string{"user_id = $1", "deleted_at IS NULL"}
+	if q.shared {
+		conditions[0] = ps.sharedWith("$1")
+	}
+	if q.trashed {
+		conditions[1] = "deleted_at IS NOT NULL"
+	}
+	if !q.from.IsZero() {
+		args = append(args, q.from)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !q.to.IsZero() {
+		args = append(args, q.to)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if len(q.tags) > 0 {
+		args = append(args, q.tags)
+		tagged := fmt.Sprintf(`
+			SELECT nt.note_id FROM %s nt JOIN %s t ON t.id = nt.tag_id
+			WHERE t.name = ANY($%d)`,
+			ps.noteTagsTable, ps.tagsTable, len(args),
+		)
+		if q.tagMatch == TagMatchAll {
+			tagged += fmt.Sprintf(" GROUP BY nt.note_id HAVING count(*) = %d", len(q.tags))
+		}
+		conditions = append(conditions, fmt.Sprintf("id IN (%s)", tagged))
+	}
+	if q.cursor != nil {
+		args = append(args, q.key, q.cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d, $%d)", column, comparison, len(args)-1, len(args)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, user_id, title, content, %s, version, created_at, updated_at, deleted_at, %s
+		FROM %s
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT %d`,
+		ps.tagsColumn(),
+		ps.roleColumn("$1"),
+		ps.tableName,
+		strings.Join(conditions, " AND "),
+		column, direction, direction,
+		q.limit+1,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing user notes")
+	}
+	defer rows.Close()
+
+	notes := make([]Note, 0, q.limit+1)
+	for rows.Next() {
+		note := Note{}
+		err = rows.Scan(
+			&note.ID,
+			&note.UserID,
+			&note.Title,
+			&note.Content,
+			&note.Tags,
+			&note.Version,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+			&note.DeletedAt,
+			&note.Role,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading user note")
+		}
+		notes = append(notes, note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed listing user notes")
+	}
+
+	return notes, nil
+}
+
+func (ps *pgstore) TrashNote(ctx context.Context, userID, noteID string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET deleted_at = now()
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query, noteID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed trashing note")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.NotFoundErr(ErrNoteNotFound, noteID)
+	}
+
+	return nil
+}
+
+func (ps *pgstore) RestoreNote(ctx context.Context, userID, noteID string) (*Note, error) {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET deleted_at = NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+		RETURNING title, content, %s, version, created_at, updated_at`,
+		ps.tableName,
+		ps.tagsColumn(),
+	)
+
+	note := &Note{
+		ID:     noteID,
+		UserID: userID,
+		Role:   RoleOwner,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ps.pqdriver.QueryRow(ctx, query, noteID, userID).Scan(
+		&note.Title,
+		&note.Content,
+		&note.Tags,
+		&note.Version,
+		&note.CreatedAt,
+		&note.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NotFoundErr(ErrNoteNotFound, noteID)
+		}
+		return nil, errors.Wrap(err, "failed restoring note")
+	}
+
+	return note, nil
+}
+
+func (ps *pgstore) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	query := fmt.Sprintf(
+		`DELETE FROM %s WHERE deleted_at < $1`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed purging trashed notes")
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (ps *pgstore) SearchNotes(ctx context.Context, userID, tsquery string, limit int) ([]SearchResult, error) {
+	query := fmt.Sprintf(`
+		SELECT id, title, content, %s, version, created_at, updated_at,
+			ts_rank_cd(search, tsq),
+			ts_headline('english', %s, tsq, 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'),
+			ts_headline('english', %s, tsq, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, FragmentDelimiter=" ... "')
+		FROM %s, to_tsquery('english', $2) tsq
+		WHERE user_id = $1 AND deleted_at IS NULL AND search @@ tsq
+		ORDER BY 8 DESC, created_at DESC, id
+		LIMIT $3`,
+		ps.tagsColumn(),
+		fmt.Sprintf(htmlEscapedColumn, "title"),
+		fmt.Sprintf(htmlEscapedColumn, "content"),
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, userID, tsquery, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed searching user notes")
+	}
+	defer rows.Close()
+
+	results := make([]SearchResult, 0, limit)
+	for rows.Next() {
+		result := SearchResult{Note: Note{UserID: userID, Role: RoleOwner}}
+		err = rows.Scan(
+			&result.ID,
+			&result.Title,
+			&result.Content,
+			&result.Tags,
+			&result.Version,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+			&result.Rank,
+			&result.TitleHighlight,
+			&result.Snippet,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading user note")
+		}
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed searching user notes")
+	}
+
+	return results, nil
+}
+
+func (ps *pgstore) ListTags(ctx context.Context, userID string) ([]TagCount, error) {
+	query := fmt.Sprintf(`
+		SELECT t.name, count(*)
+		FROM %s t
+		JOIN %s nt ON nt.tag_id = t.id
+		JOIN %s n ON n.id = nt.note_id AND n.deleted_at IS NULL
+		WHERE t.user_id = $1
+		GROUP BY t.name
+		ORDER BY count(*) DESC, t.name`,
+		ps.tagsTable,
+		ps.noteTagsTable,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing tags")
+	}
+	defer rows.Close()
+
+	tags := make([]TagCount, 0)
+	for rows.Next() {
+		tag := TagCount{}
+		err = rows.Scan(&tag.Name, &tag.Count)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading tag")
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed listing tags")
+	}
+
+	return tags, nil
+}
+
+func (ps *pgstore) SaveShare(ctx context.Context, share *Share) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (note_id, user_id, role, shared_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (note_id, user_id) DO UPDATE
+		SET role = EXCLUDED.role, shared_by = EXCLUDED.shared_by
+		RETURNING created_at`,
+		ps.sharesTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ps.pqdriver.QueryRow(
+		ctx, query, share.NoteID, share.UserID, share.Role, share.SharedBy,
+	).Scan(&share.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed storing note share")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) GetShares(ctx context.Context, noteID string) ([]Share, error) {
+	query := fmt.Sprintf(`
+		SELECT s.note_id, s.user_id, u.email, s.role, COALESCE(s.shared_by::text, ''), s.created_at
+		FROM %s s
+		JOIN %s u ON u.id = s.user_id
+		WHERE s.note_id = $1
+		ORDER BY s.created_at, s.user_id`,
+		ps.sharesTable,
+		ps.usersTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, noteID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed getting note shares")
+	}
+	defer rows.Close()
+
+	shares := make([]Share, 0)
+	for rows.Next() {
+		share := Share{}
+		err = rows.Scan(&share.NoteID, &share.UserID, &share.Email, &share.Role, &share.SharedBy, &share.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading note share")
+		}
+		shares = append(shares, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed getting note shares")
+	}
+
+	return shares, nil
+}
+
+func (ps *pgstore) DeleteShare(ctx context.Context, noteID, userID string) error {
+	query := fmt.Sprintf(
+		`DELETE FROM %s WHERE note_id = $1 AND user_id = $2`,
+		ps.sharesTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query, noteID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed deleting note share")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.NotFoundErr(ErrShareNotFound, userID)
+	}
+
+	return nil
+}
+
+func (ps *pgstore) SaveLink(ctx context.Context, link *Link, tokenHash, passwordHash []byte) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (id, note_id, user_id, token_hash, password_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		ps.linksTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	link.ID = uuid.New().String()
+	_, err := ps.pqdriver.Exec(
+		ctx, query, link.ID, link.NoteID, link.UserID, tokenHash, passwordHash, link.ExpiresAt, link.CreatedAt,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed storing share link")
+	}
+
+	return nil
+}
+
+// linkColumns are the columns scanned by scanLink
+const linkColumns = "id, note_id, user_id, password_hash IS NOT NULL, expires_at, views, last_viewed_at, created_at"
+
+func scanLink(row pgx.Row, extra ...any) (*Link, error) {
+	link := &Link{}
+	dest := []any{
+		&link.ID,
+		&link.NoteID,
+		&link.UserID,
+		&link.HasPassword,
+		&link.ExpiresAt,
+		&link.Views,
+		&link.LastViewedAt,
+		&link.CreatedAt,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+func (ps *pgstore) GetLinkByHash(ctx context.Context, tokenHash []byte) (*Link, []byte, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, password_hash
+		FROM %s
+		WHERE token_hash = $1 AND revoked_at IS NULL`,
+		linkColumns,
+		ps.linksTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var passwordHash []byte
+	link, err := scanLink(ps.pqdriver.QueryRow(ctx, query, tokenHash), &passwordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, errors.NotFoundErr(ErrLinkNotFound, ErrLinkNotFound.Error())
+		}
+		return nil, nil, errors.Wrap(err, "failed getting share link")
+	}
+
+	return link, passwordHash, nil
+}
+
+func (ps *pgstore) GetLinks(ctx context.Context, userID string) ([]Link, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC, id`,
+		linkColumns,
+		ps.linksTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed getting share links")
+	}
+	defer rows.Close()
+
+	links := make([]Link, 0)
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading share link")
+		}
+		links = append(links, *link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed getting share links")
+	}
+
+	return links, nil
+}
+
+func (ps *pgstore) RevokeLink(ctx context.Context, userID, linkID string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET revoked_at = now()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		ps.linksTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query, linkID, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed revoking share link")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.NotFoundErr(ErrLinkNotFound, linkID)
+	}
+
+	return nil
+}
+
+func (ps *pgstore) CountLinkView(ctx context.Context, linkID string) (int64, error) {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET views = views + 1, last_viewed_at = now()
+		WHERE id = $1
+		RETURNING views`,
+		ps.linksTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	views := int64(0)
+	err := ps.pqdriver.QueryRow(ctx, query, linkID).Scan(&views)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed counting share link view")
+	}
+
+	return views, nil
+}
+
 func (ps *pgstore) newNoteID() string {
 	return uuid.New().String()
 }
 
 func NewPostgresStore(pqdriver *pgxpool.Pool, tableName string) store {
 	return &pgstore{
-		pqdriver:  pqdriver,
-		tableName: tableName,
+		pqdriver:       pqdriver,
+		tableName:      tableName,
+		tagsTable:      "note_tags",
+		noteTagsTable:  "user_note_tags",
+		revisionsTable: "user_note_revisions",
+		sharesTable:    "user_note_shares",
+		usersTable:     "users",
+		linksTable:     "user_note_links",
 	}
 }
@@ -0,0 +1,72 @@
+package usernotes
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/naughtygopher/errors"
+)
+
+const (
+	// TagMatchAll lists the notes having all of the tags filtered by
+	TagMatchAll = "all"
+	// TagMatchAny lists the notes having any of the tags filtered by
+	TagMatchAny = "any"
+
+	maxTagsPerNote = 20
+	maxTagLength   = 50
+)
+
+// TagCount is a tag of the user, along with the number of notes (not in the trash) having it
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// normalizeTag lowercases the tag and replaces the whitespace in it with a single -, so that e.g.
+// "#Work Items" and "work-items" are the same tag
+func normalizeTag(tag string) string {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	return strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+}
+
+// normalizeTags normalizes the tags, dropping the empty and duplicate ones. The tags are sorted,
+// which is also the order the store returns them in
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+func validateTags(tags []string) error {
+	if len(tags) > maxTagsPerNote {
+		return errors.Validationf("a note cannot have more than %d tags", maxTagsPerNote)
+	}
+
+	for _, tag := range tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return errors.Validationf("tag %q cannot be longer than %d characters", tag, maxTagLength)
+		}
+	}
+
+	return nil
+}
+
+// ListTags returns the tags of the user's notes along with how many notes have each of them, most
+// used first
+func (un *UserNotes) ListTags(ctx context.Context, userID string) ([]TagCount, error) {
+	if userID == "" {
+		return nil, errors.Validation("no user ID provided")
+	}
+
+	return un.store.ListTags(ctx, userID)
+}
@@ -0,0 +1,81 @@
+package usernotes
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNote_SanitizeTags(t *testing.T) {
+	note := Note{Tags: []string{" Work ", "#work", "to  Do", "", "urgent", "  "}}
+	note.Sanitize()
+
+	expected := []string{"to-do", "urgent", "work"}
+	if !reflect.DeepEqual(note.Tags, expected) {
+		t.Errorf("got: %v, expected: %v", note.Tags, expected)
+	}
+}
+
+func TestNote_ValidateTags(t *testing.T) {
+	tooMany := make([]string, 0, maxTagsPerNote+1)
+	for i := range maxTagsPerNote + 1 {
+		tooMany = append(tooMany, strings.Repeat("a", i+1))
+	}
+
+	tests := []struct {
+		name    string
+		tags    []string
+		wantErr bool
+	}{
+		{name: "no tags"},
+		{name: "tags", tags: []string{"work", "urgent"}},
+		{name: "too many tags", tags: tooMany, wantErr: true},
+		{name: "tag too long", tags: []string{strings.Repeat("a", maxTagLength+1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			note := &Note{Title: "Title", Content: "Content", UserID: "user", Tags: tt.tags}
+			err := note.ValidateForCreate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error: %v, wantErr: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserNotes_UpdateNoteTags(t *testing.T) {
+	ctx := context.Background()
+	un := NewService(&Config{}, newMemstore(), nil)
+
+	note, err := un.SaveNote(ctx, &Note{UserID: "user", Title: "Title", Content: "Content", Tags: []string{"Work"}})
+	if err != nil {
+		t.Fatalf("SaveNote() error = %v", err)
+	}
+
+	// the same tags, once normalized, leave the note as is
+	updated, err := un.UpdateNote(ctx, note.UserID, note.ID, &NoteUpdate{Tags: []string{"#work"}}, 0)
+	if err != nil || updated.Version != 1 {
+		t.Fatalf("UpdateNote() = version %d, %v, want version 1", updated.Version, err)
+	}
+
+	updated, err = un.UpdateNote(ctx, note.UserID, note.ID, &NoteUpdate{Tags: []string{}}, 0)
+	if err != nil || updated.Version != 2 || len(updated.Tags) != 0 {
+		t.Fatalf("UpdateNote() = version %d, tags %v, %v, want version 2 without tags", updated.Version, updated.Tags, err)
+	}
+}
+
+func TestUserNotes_newListQueryTags(t *testing.T) {
+	un := testService()
+
+	q, err := un.newListQuery(&ListFilter{UserID: "user", Tags: []string{"work"}})
+	if err != nil || q.tagMatch != TagMatchAll {
+		t.Errorf("newListQuery() tag match = %q, %v, want %q", q.tagMatch, err, TagMatchAll)
+	}
+
+	_, err = un.newListQuery(&ListFilter{UserID: "user", Tags: []string{"work"}, TagMatch: "some"})
+	if err == nil {
+		t.Errorf("newListQuery() with an invalid tag match expected an error")
+	}
+}
@@ -0,0 +1,65 @@
+package usernotes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/logger"
+)
+
+// TrashNote moves the note to the trash, from where it can be restored until it's purged. Only the
+// owner of the note can trash it
+func (un *UserNotes) TrashNote(ctx context.Context, userID, noteID string) error {
+	note, err := un.GetNoteByID(ctx, userID, noteID)
+	if err != nil {
+		return err
+	}
+
+	if note.Role != RoleOwner {
+		return errors.Unauthorized("only the owner of the note can trash it")
+	}
+
+	return un.store.TrashNote(ctx, userID, noteID)
+}
+
+// RestoreNote moves the note out of the trash
+func (un *UserNotes) RestoreNote(ctx context.Context, userID, noteID string) (*Note, error) {
+	if uuid.Validate(noteID) != nil {
+		return nil, errors.NotFoundErr(ErrNoteNotFound, noteID)
+	}
+
+	return un.store.RestoreNote(ctx, userID, noteID)
+}
+
+// PurgeTrash permanently deletes the notes which have been in the trash for longer than the
+// retention period
+func (un *UserNotes) PurgeTrash(ctx context.Context) (int64, error) {
+	return un.store.PurgeTrash(ctx, time.Now().Add(-un.cfg.TrashRetention))
+}
+
+// StartPurge periodically purges the trash, until the context is cancelled or the returned
+// stop function is called
+func (un *UserNotes) StartPurge(ctx context.Context) (stop func()) {
+	ctx, stop = context.WithCancel(ctx)
+	tick := time.NewTicker(un.cfg.TrashPurgeInterval)
+	go func() {
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				_, err := un.PurgeTrash(ctx)
+				if err != nil {
+					logger.Error(ctx, fmt.Sprintf("[usernotes] failed purging trash: %+v", err))
+				}
+			}
+		}
+	}()
+
+	return stop
+}
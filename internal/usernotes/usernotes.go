@@ -3,19 +3,38 @@ package usernotes
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/naughtygopher/errors"
 )
 
+var ErrNoteNotFound = errors.New("note not found")
+
+// maxContentLength is the maximum length of the content of a note in bytes, which also bounds
+// the work of diffing its revisions
+const maxContentLength = 100 * 1024
+
 type Note struct {
-	ID        string
-	Title     string
-	Content   string
-	UserID    string
+	ID      string
+	Title   string
+	Content string
+	// UserID is the owner of the note
+	UserID string
+	// Tags are normalized (see normalizeTag) and sorted
+	Tags []string
+	// Version is incremented on every update, starting at 1
+	Version   int
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	// DeletedAt is when the note was moved to the trash, nil if it's not trashed
+	DeletedAt *time.Time
+	// Role is the access the user the note was read by has to it, i.e. owner, or the role it's
+	// shared with them
+	Role string
 }
 
 func (note *Note) ValidateForCreate() error {
@@ -32,25 +51,115 @@ func (note *Note) ValidateForCreate() error {
 		return errors.Validation("note content cannot be empty")
 	}
 
+	if len(note.Content) > maxContentLength {
+		return errors.Validationf("note content cannot be longer than %d bytes", maxContentLength)
+	}
+
 	if note.UserID == "" {
 		return errors.Validation("note creator cannot be anonymous")
 	}
 
-	return nil
+	return validateTags(note.Tags)
 }
 
 func (note *Note) Sanitize() {
 	note.Title = strings.TrimSpace(note.Title)
 	note.Content = strings.TrimSpace(note.Content)
+	note.Tags = normalizeTags(note.Tags)
+}
+
+// NoteUpdate has the fields of a note to be updated, nil fields are left as they are
+type NoteUpdate struct {
+	Title   *string
+	Content *string
+	// Tags replace the current tags of the note, unless nil. An empty slice removes all the tags
+	Tags []string
+}
+
+func (nu *NoteUpdate) apply(note *Note) {
+	if nu.Title != nil {
+		note.Title = *nu.Title
+	}
+	if nu.Content != nil {
+		note.Content = *nu.Content
+	}
+	if nu.Tags != nil {
+		note.Tags = nu.Tags
+	}
+}
+
+// VersionMismatchError is returned when a note is updated based on a version which is not the
+// current one anymore, i.e. it has been updated by someone else in the meantime
+type VersionMismatchError struct {
+	// Current is the current version of the note, 0 if unknown
+	Current int
+}
+
+func (vme *VersionMismatchError) Error() string {
+	if vme.Current == 0 {
+		return "note has been updated in the meantime"
+	}
+	return fmt.Sprintf("note has been updated in the meantime, current version is %d", vme.Current)
+}
+
+type Config struct {
+	// DefaultPageSize is the number of notes listed per page, unless asked otherwise
+	DefaultPageSize int
+	// MaxPageSize is the maximum number of notes which can be listed per page
+	MaxPageSize int
+	// TrashRetention is how long notes are kept in the trash before being deleted permanently
+	TrashRetention time.Duration
+	// TrashPurgeInterval is how often notes past the retention are removed from the trash
+	TrashPurgeInterval time.Duration
 }
 
 type store interface {
+	// GetNoteByID returns the note if it's owned by or shared with the user, unless it's trashed
 	GetNoteByID(ctx context.Context, userID string, noteID string) (*Note, error)
+	// SaveNote saves the note along with its tags, and its first revision
 	SaveNote(ctx context.Context, note *Note) (string, error)
+	// GetNotesByUser returns all the notes of the user, including the trashed ones
+	GetNotesByUser(ctx context.Context, userID string) ([]Note, error)
+	// UpdateNote saves the title, content and tags of the note if its version is still the given
+	// one, and sets the new version and update time on it. It returns a VersionMismatchError otherwise.
+	// The new version is saved as a revision by the author
+	UpdateNote(ctx context.Context, note *Note, version int, authorID string) error
+	// ListNotes returns up to one more note than the limit of the query, in its sort order (or
+	// in reverse if listing backward)
+	ListNotes(ctx context.Context, q *listQuery) ([]Note, error)
+	// TrashNote moves the note to the trash, returning ErrNoteNotFound if it's not there or
+	// already trashed
+	TrashNote(ctx context.Context, userID, noteID string) error
+	// RestoreNote moves the note out of the trash, returning ErrNoteNotFound if it's not trashed
+	RestoreNote(ctx context.Context, userID, noteID string) (*Note, error)
+	// PurgeTrash permanently deletes the notes trashed before the given time
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+	// SearchNotes returns the user's notes (other than the trashed ones) matching the tsquery, most
+	// relevant first
+	SearchNotes(ctx context.Context, userID, tsquery string, limit int) ([]SearchResult, error)
+	ListTags(ctx context.Context, userID string) ([]TagCount, error)
+	GetRevisions(ctx context.Context, noteID string) ([]Revision, error)
+	// GetRevision returns ErrRevisionNotFound if the note has no such revision
+	GetRevision(ctx context.Context, noteID string, version int) (*Revision, error)
+	// SaveShare shares the note with the user, or changes the role it's shared with
+	SaveShare(ctx context.Context, share *Share) error
+	GetShares(ctx context.Context, noteID string) ([]Share, error)
+	// DeleteShare returns ErrShareNotFound if the note is not shared with the user
+	DeleteShare(ctx context.Context, noteID, userID string) error
+	SaveLink(ctx context.Context, link *Link, tokenHash, passwordHash []byte) error
+	// GetLinkByHash returns the link which is not revoked, along with its password hash (nil if it
+	// has no password). It returns ErrLinkNotFound if there's no such link
+	GetLinkByHash(ctx context.Context, tokenHash []byte) (*Link, []byte, error)
+	GetLinks(ctx context.Context, userID string) ([]Link, error)
+	RevokeLink(ctx context.Context, userID, linkID string) error
+	// CountLinkView counts a view of the note with the link, and returns the number of views so far
+	CountLinkView(ctx context.Context, linkID string) (int64, error)
 }
 
 type UserNotes struct {
-	store store
+	cfg    *Config
+	store  store
+	hasher PasswordHasher
 }
 
 func (un *UserNotes) SaveNote(ctx context.Context, note *Note) (*Note, error) {
@@ -59,6 +168,8 @@ func (un *UserNotes) SaveNote(ctx context.Context, note *Note) (*Note, error) {
 		return nil, err
 	}
 
+	note.Version = 1
+	note.Role = RoleOwner
 	note.CreatedAt = time.Now()
 	note.UpdatedAt = time.Now()
 	note.ID, err = un.store.SaveNote(ctx, note)
@@ -69,12 +180,87 @@ func (un *UserNotes) SaveNote(ctx context.Context, note *Note) (*Note, error) {
 	return note, nil
 }
 
+// GetNoteByID returns the note if it's owned by or shared with the user
 func (un *UserNotes) GetNoteByID(ctx context.Context, userID string, noteID string) (*Note, error) {
+	if uuid.Validate(noteID) != nil {
+		return nil, errors.NotFoundErr(ErrNoteNotFound, noteID)
+	}
+
 	return un.store.GetNoteByID(ctx, userID, noteID)
 }
 
-func NewService(store store) *UserNotes {
+// UpdateNote updates the note, provided that its current version is the given one. A version of 0
+// updates the note whatever its version is. The note is left as is (i.e. its version is not
+// incremented) if nothing changes. Only the owner and the editors of the note can update it
+func (un *UserNotes) UpdateNote(ctx context.Context, userID, noteID string, update *NoteUpdate, version int) (*Note, error) {
+	if update == nil {
+		return nil, errors.Validation("empty note update")
+	}
+
+	note, err := un.GetNoteByID(ctx, userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !note.CanEdit() {
+		return nil, errors.Unauthorized("note is shared with the user as a viewer only")
+	}
+
+	if version != 0 && version != note.Version {
+		return nil, &VersionMismatchError{Current: note.Version}
+	}
+
+	current := *note
+	update.apply(note)
+	err = note.ValidateForCreate()
+	if err != nil {
+		return nil, err
+	}
+
+	if note.Title == current.Title && note.Content == current.Content && slices.Equal(note.Tags, current.Tags) {
+		return note, nil
+	}
+
+	err = un.store.UpdateNote(ctx, note, current.Version, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+// ListAllNotes returns every note owned by the user (including the ones in the trash), oldest first
+func (un *UserNotes) ListAllNotes(ctx context.Context, userID string) ([]Note, error) {
+	if userID == "" {
+		return nil, errors.Validation("no user ID provided")
+	}
+
+	return un.store.GetNotesByUser(ctx, userID)
+}
+
+// ListNotes returns a page of the user's notes, or of the notes shared with them, see ListFilter
+func (un *UserNotes) ListNotes(ctx context.Context, filter *ListFilter) (*Page, error) {
+	if filter != nil {
+		filter.Sanitize()
+	}
+
+	q, err := un.newListQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := un.store.ListNotes(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(notes, q), nil
+}
+
+func NewService(cfg *Config, store store, hasher PasswordHasher) *UserNotes {
 	return &UserNotes{
-		store: store,
+		cfg:    cfg,
+		store:  store,
+		hasher: hasher,
 	}
 }
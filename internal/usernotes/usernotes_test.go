@@ -0,0 +1,397 @@
+package usernotes
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/naughtygopher/errors"
+)
+
+type memstore struct {
+	notes     map[string]*Note
+	revisions map[string][]Revision
+	// shares are the roles of the users a note is shared with, by note
+	shares map[string]map[string]string
+	// links are by token hash, along with their password hash
+	links map[string]*memlink
+	// purges is the number of times the trash was purged
+	purges atomic.Int32
+}
+
+type memlink struct {
+	Link
+	passwordHash []byte
+	revoked      bool
+}
+
+func newMemstore() *memstore {
+	return &memstore{
+		notes:     map[string]*Note{},
+		revisions: map[string][]Revision{},
+		shares:    map[string]map[string]string{},
+		links:     map[string]*memlink{},
+	}
+}
+
+func (ms *memstore) saveRevision(note *Note, authorID string) {
+	ms.revisions[note.ID] = append(ms.revisions[note.ID], Revision{
+		NoteID:    note.ID,
+		Version:   note.Version,
+		Title:     note.Title,
+		Content:   note.Content,
+		Tags:      note.Tags,
+		AuthorID:  authorID,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (ms *memstore) GetNoteByID(ctx context.Context, userID string, noteID string) (*Note, error) {
+	note, ok := ms.notes[noteID]
+	if !ok || note.DeletedAt != nil {
+		return nil, errors.NotFoundErr(ErrNoteNotFound, noteID)
+	}
+
+	cp := *note
+	cp.Role = RoleOwner
+	if note.UserID != userID {
+		cp.Role, ok = ms.shares[noteID][userID]
+		if !ok {
+			return nil, errors.NotFoundErr(ErrNoteNotFound, noteID)
+		}
+	}
+	return &cp, nil
+}
+
+func (ms *memstore) SaveNote(ctx context.Context, note *Note) (string, error) {
+	cp := *note
+	cp.ID = uuid.New().String()
+	ms.notes[cp.ID] = &cp
+	ms.saveRevision(&cp, cp.UserID)
+	return cp.ID, nil
+}
+
+func (ms *memstore) GetNotesByUser(ctx context.Context, userID string) ([]Note, error) {
+	notes := make([]Note, 0)
+	for _, note := range ms.notes {
+		if note.UserID == userID {
+			notes = append(notes, *note)
+		}
+	}
+	return notes, nil
+}
+
+func (ms *memstore) ListNotes(ctx context.Context, q *listQuery) ([]Note, error) {
+	return ms.GetNotesByUser(ctx, q.userID)
+}
+
+func (ms *memstore) UpdateNote(ctx context.Context, note *Note, version int, authorID string) error {
+	current, ok := ms.notes[note.ID]
+	if !ok || current.UserID != note.UserID || current.Version != version {
+		return &VersionMismatchError{}
+	}
+	note.Version = version + 1
+	note.UpdatedAt = time.Now()
+	cp := *note
+	ms.notes[note.ID] = &cp
+	ms.saveRevision(&cp, authorID)
+	return nil
+}
+
+func (ms *memstore) TrashNote(ctx context.Context, userID, noteID string) error {
+	note, ok := ms.notes[noteID]
+	if !ok || note.UserID != userID || note.DeletedAt != nil {
+		return errors.NotFoundErr(ErrNoteNotFound, noteID)
+	}
+	now := time.Now()
+	note.DeletedAt = &now
+	return nil
+}
+
+func (ms *memstore) RestoreNote(ctx context.Context, userID, noteID string) (*Note, error) {
+	note, ok := ms.notes[noteID]
+	if !ok || note.UserID != userID || note.DeletedAt == nil {
+		return nil, errors.NotFoundErr(ErrNoteNotFound, noteID)
+	}
+	note.DeletedAt = nil
+	cp := *note
+	return &cp, nil
+}
+
+func (ms *memstore) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	ms.purges.Add(1)
+	purged := int64(0)
+	for id, note := range ms.notes {
+		if note.DeletedAt != nil && note.DeletedAt.Before(before) {
+			delete(ms.notes, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (ms *memstore) SearchNotes(ctx context.Context, userID, tsquery string, limit int) ([]SearchResult, error) {
+	return []SearchResult{}, nil
+}
+
+func (ms *memstore) ListTags(ctx context.Context, userID string) ([]TagCount, error) {
+	return []TagCount{}, nil
+}
+
+func (ms *memstore) GetRevisions(ctx context.Context, noteID string) ([]Revision, error) {
+	revisions := slices.Clone(ms.revisions[noteID])
+	slices.Reverse(revisions)
+	return revisions, nil
+}
+
+func (ms *memstore) GetRevision(ctx context.Context, noteID string, version int) (*Revision, error) {
+	for _, revision := range ms.revisions[noteID] {
+		if revision.Version == version {
+			return &revision, nil
+		}
+	}
+	return nil, errors.NotFoundErr(ErrRevisionNotFound, noteID)
+}
+
+func (ms *memstore) SaveShare(ctx context.Context, share *Share) error {
+	if ms.shares[share.NoteID] == nil {
+		ms.shares[share.NoteID] = map[string]string{}
+	}
+	ms.shares[share.NoteID][share.UserID] = share.Role
+	share.CreatedAt = time.Now()
+	return nil
+}
+
+func (ms *memstore) GetShares(ctx context.Context, noteID string) ([]Share, error) {
+	shares := make([]Share, 0)
+	for userID, role := range ms.shares[noteID] {
+		shares = append(shares, Share{NoteID: noteID, UserID: userID, Role: role})
+	}
+	return shares, nil
+}
+
+func (ms *memstore) DeleteShare(ctx context.Context, noteID, userID string) error {
+	if _, ok := ms.shares[noteID][userID]; !ok {
+		return errors.NotFoundErr(ErrShareNotFound, userID)
+	}
+	delete(ms.shares[noteID], userID)
+	return nil
+}
+
+func (ms *memstore) SaveLink(ctx context.Context, link *Link, tokenHash, passwordHash []byte) error {
+	link.ID = uuid.New().String()
+	ms.links[string(tokenHash)] = &memlink{Link: *link, passwordHash: passwordHash}
+	return nil
+}
+
+func (ms *memstore) GetLinkByHash(ctx context.Context, tokenHash []byte) (*Link, []byte, error) {
+	link, ok := ms.links[string(tokenHash)]
+	if !ok || link.revoked {
+		return nil, nil, errors.NotFoundErr(ErrLinkNotFound, ErrLinkNotFound.Error())
+	}
+	cp := link.Link
+	return &cp, link.passwordHash, nil
+}
+
+func (ms *memstore) GetLinks(ctx context.Context, userID string) ([]Link, error) {
+	links := make([]Link, 0)
+	for _, link := range ms.links {
+		if link.UserID == userID && !link.revoked {
+			links = append(links, link.Link)
+		}
+	}
+	return links, nil
+}
+
+func (ms *memstore) RevokeLink(ctx context.Context, userID, linkID string) error {
+	for _, link := range ms.links {
+		if link.ID == linkID && link.UserID == userID && !link.revoked {
+			link.revoked = true
+			return nil
+		}
+	}
+	return errors.NotFoundErr(ErrLinkNotFound, linkID)
+}
+
+func (ms *memstore) CountLinkView(ctx context.Context, linkID string) (int64, error) {
+	for _, link := range ms.links {
+		if link.ID == linkID {
+			link.Views++
+			return link.Views, nil
+		}
+	}
+	return 0, errors.NotFoundErr(ErrLinkNotFound, linkID)
+}
+
+func TestUserNotes_UpdateNote(t *testing.T) {
+	ctx := context.Background()
+	title, content, blank := "Renamed", "Rewritten", " "
+	tooLong := strings.Repeat("a", maxContentLength+1)
+
+	tests := []struct {
+		name        string
+		userID      string
+		update      *NoteUpdate
+		version     int
+		wantVersion int
+		wantErr     bool
+		wantCurrent int
+	}{
+		{
+			name:        "at the current version",
+			update:      &NoteUpdate{Title: &title},
+			version:     1,
+			wantVersion: 2,
+		},
+		{
+			name:        "at any version",
+			update:      &NoteUpdate{Title: &title, Content: &content},
+			wantVersion: 2,
+		},
+		{
+			name:        "nothing changed",
+			update:      &NoteUpdate{},
+			version:     1,
+			wantVersion: 1,
+		},
+		{
+			name:        "at an outdated version",
+			update:      &NoteUpdate{Title: &title},
+			version:     3,
+			wantErr:     true,
+			wantCurrent: 1,
+		},
+		{
+			name:    "invalid",
+			update:  &NoteUpdate{Content: &blank},
+			wantErr: true,
+		},
+		{
+			name:    "content too long",
+			update:  &NoteUpdate{Content: &tooLong},
+			wantErr: true,
+		},
+		{
+			name:    "note of another user",
+			userID:  "someone else",
+			update:  &NoteUpdate{Title: &title},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			un := NewService(&Config{}, newMemstore(), nil)
+			note, err := un.SaveNote(ctx, &Note{UserID: "user", Title: "Title", Content: "Content"})
+			if err != nil {
+				t.Fatalf("SaveNote() error = %v", err)
+			}
+
+			userID := tt.userID
+			if userID == "" {
+				userID = note.UserID
+			}
+
+			updated, err := un.UpdateNote(ctx, userID, note.ID, tt.update, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateNote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				mismatch := &VersionMismatchError{}
+				if errors.As(err, &mismatch) != (tt.wantCurrent != 0) {
+					t.Fatalf("UpdateNote() error = %v, want version mismatch %v", err, tt.wantCurrent != 0)
+				}
+				if tt.wantCurrent != 0 && mismatch.Current != tt.wantCurrent {
+					t.Errorf("UpdateNote() current version = %d, want %d", mismatch.Current, tt.wantCurrent)
+				}
+				return
+			}
+
+			if updated.Version != tt.wantVersion {
+				t.Errorf("UpdateNote() version = %d, want %d", updated.Version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestUserNotes_Trash(t *testing.T) {
+	ctx := context.Background()
+	store := newMemstore()
+	un := NewService(&Config{TrashRetention: time.Hour}, store, nil)
+
+	note, err := un.SaveNote(ctx, &Note{UserID: "user", Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("SaveNote() error = %v", err)
+	}
+
+	err = un.TrashNote(ctx, note.UserID, note.ID)
+	if err != nil {
+		t.Fatalf("TrashNote() error = %v", err)
+	}
+
+	_, err = un.GetNoteByID(ctx, note.UserID, note.ID)
+	if !errors.Is(err, ErrNoteNotFound) {
+		t.Errorf("GetNoteByID() of a trashed note error = %v, want %v", err, ErrNoteNotFound)
+	}
+
+	err = un.TrashNote(ctx, note.UserID, note.ID)
+	if !errors.Is(err, ErrNoteNotFound) {
+		t.Errorf("TrashNote() of a trashed note error = %v, want %v", err, ErrNoteNotFound)
+	}
+
+	_, err = un.RestoreNote(ctx, note.UserID, note.ID)
+	if err != nil {
+		t.Fatalf("RestoreNote() error = %v", err)
+	}
+
+	_, err = un.GetNoteByID(ctx, note.UserID, note.ID)
+	if err != nil {
+		t.Errorf("GetNoteByID() of a restored note error = %v", err)
+	}
+
+	// only notes trashed for longer than the retention are purged
+	err = un.TrashNote(ctx, note.UserID, note.ID)
+	if err != nil {
+		t.Fatalf("TrashNote() error = %v", err)
+	}
+
+	purged, err := un.PurgeTrash(ctx)
+	if err != nil || purged != 0 {
+		t.Errorf("PurgeTrash() = %d, %v, want nothing purged", purged, err)
+	}
+
+	trashedAt := time.Now().Add(-2 * time.Hour)
+	store.notes[note.ID].DeletedAt = &trashedAt
+	purged, err = un.PurgeTrash(ctx)
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeTrash() = %d, %v, want 1 purged", purged, err)
+	}
+
+	_, err = un.RestoreNote(ctx, note.UserID, note.ID)
+	if !errors.Is(err, ErrNoteNotFound) {
+		t.Errorf("RestoreNote() of a purged note error = %v, want %v", err, ErrNoteNotFound)
+	}
+}
+
+func TestUserNotes_StartPurge(t *testing.T) {
+	store := newMemstore()
+	un := NewService(&Config{TrashRetention: time.Hour, TrashPurgeInterval: time.Millisecond}, store, nil)
+
+	stop := un.StartPurge(context.Background())
+	for store.purges.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+
+	// a purge could be in progress while stopping
+	time.Sleep(10 * time.Millisecond)
+	purges := store.purges.Load()
+	time.Sleep(10 * time.Millisecond)
+	if store.purges.Load() != purges {
+		t.Errorf("expected no purges after stopping")
+	}
+}
@@ -0,0 +1,116 @@
+package users
+
+import (
+	"context"
+	"strings"
+
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/logger"
+)
+
+var (
+	ErrIdentityNotFound         = errors.New("external identity not found")
+	ErrIdentityEmailNotVerified = errors.New("email address of the external identity is not verified")
+)
+
+// ExternalIdentity is a user identity asserted by an external identity provider
+type ExternalIdentity struct {
+	// Provider is the name of the identity provider
+	Provider string
+	// Subject is the ID of the user at the identity provider
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FullName      string
+}
+
+// LoginWithIdentity returns the user linked to the external identity. An identity which is not
+// linked yet is linked to the user with the same email address, or to a new user if there is none.
+// Since the email address is the only link, it must be verified by both the identity provider
+// and the existing user.
+func (us *Users) LoginWithIdentity(ctx context.Context, identity *ExternalIdentity) (*User, error) {
+	if identity.Provider == "" || identity.Subject == "" {
+		return nil, errors.Validation("identity provider and subject are required")
+	}
+
+	userID, err := us.store.GetUserIDByIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		return us.ReadByID(ctx, userID)
+	}
+
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(identity.Email)
+	if email == "" || !identity.EmailVerified {
+		return nil, errors.UnauthorizedErr(ErrIdentityEmailNotVerified, ErrIdentityEmailNotVerified.Error())
+	}
+
+	user, err := us.store.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, ErrUserEmailNotFound) {
+		return nil, err
+	}
+
+	if user == nil {
+		user, err = us.registerIdentity(ctx, identity, email)
+		if err != nil {
+			return nil, err
+		}
+	} else if !user.IsVerified() {
+		// otherwise anyone could register with the email address beforehand, and have the account
+		// taken over by the owner of the identity while still knowing its password
+		return nil, errors.Unauthorized("email address of the existing account is not verified, verify it before logging in")
+	}
+
+	err = us.store.LinkIdentity(ctx, user.ID, identity.Provider, identity.Subject, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return us.ReadByID(ctx, user.ID)
+}
+
+// registerIdentity creates a passwordless user for the external identity. The user gets a random
+// password, which can be changed using the password reset
+func (us *Users) registerIdentity(ctx context.Context, identity *ExternalIdentity, email string) (*User, error) {
+	password, _, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+
+	fullName := strings.TrimSpace(identity.FullName)
+	if fullName == "" {
+		fullName, _, _ = strings.Cut(email, "@")
+	}
+
+	user := &User{
+		FullName:     fullName,
+		Email:        email,
+		Password:     []byte(password),
+		Passwordless: true,
+	}
+	user.Sanitize()
+	err = user.ValidateForCreate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.HashPassword(us.hasher)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hash password")
+	}
+
+	user.ID, err = us.store.SaveUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.store.MarkEmailVerified(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, errors.Wrap(err, "failed marking email of external identity as verified"))
+	}
+
+	return user, nil
+}
@@ -0,0 +1,272 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/logger"
+)
+
+// LoginThrottleConfig configures how failed login attempts are throttled. Attempts are tracked
+// per account as well as per client IP.
+type LoginThrottleConfig struct {
+	// FreeAttempts is the number of consecutive failures allowed before backoff kicks in
+	FreeAttempts int
+	// BackoffBase is the wait after the first failure beyond FreeAttempts, it doubles with every failure
+	BackoffBase time.Duration
+	// BackoffMax is the maximum wait between attempts
+	BackoffMax time.Duration
+	// AccountLockThreshold is the number of consecutive failures after which the account is locked
+	AccountLockThreshold int
+	// IPLockThreshold is the number of consecutive failures after which the client IP is locked
+	IPLockThreshold int
+	// LockDuration is how long an account or IP remains locked
+	LockDuration time.Duration
+	// FailureWindow is the duration after which earlier failures are forgotten
+	FailureWindow time.Duration
+}
+
+func (cfg *LoginThrottleConfig) backoff(failures int) time.Duration {
+	exceeded := failures - cfg.FreeAttempts
+	if exceeded <= 0 {
+		return 0
+	}
+
+	// avoid overflowing the duration, the backoff is capped anyway
+	if exceeded > 30 {
+		return cfg.BackoffMax
+	}
+
+	wait := cfg.BackoffBase << (exceeded - 1)
+	return min(wait, cfg.BackoffMax)
+}
+
+// LoginAttempts has the recent failed login attempts for an account or a client IP
+type LoginAttempts struct {
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  time.Time
+}
+
+// retryAfter returns how long to wait before the next login attempt is allowed, and whether it's
+// because of a lock rather than backoff
+func (la *LoginAttempts) retryAfter(cfg *LoginThrottleConfig, now time.Time) (time.Duration, bool) {
+	if now.Before(la.LockedUntil) {
+		return la.LockedUntil.Sub(now), true
+	}
+
+	if now.Sub(la.LastFailedAt) > cfg.FailureWindow {
+		return 0, false
+	}
+
+	allowedAt := la.LastFailedAt.Add(cfg.backoff(la.Failures))
+	if now.Before(allowedAt) {
+		return allowedAt.Sub(now), false
+	}
+
+	return 0, false
+}
+
+// LoginThrottledError is returned when a login attempt is rejected without verifying the
+// credentials, because of too many failed attempts
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	// Locked is true if the account or IP is temporarily locked, false if it's only backoff
+	Locked bool
+}
+
+func (lte *LoginThrottledError) Error() string {
+	if lte.Locked {
+		return fmt.Sprintf("too many failed login attempts, locked for %s", lte.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed login attempts, retry after %s", lte.RetryAfter.Round(time.Second))
+}
+
+func accountAttemptsKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptsKey(clientIP string) string {
+	return "ip:" + clientIP
+}
+
+// linkAttemptsKey is keyed by the hash of the link token, so that the token is not stored
+func linkAttemptsKey(linkToken string) string {
+	hashed := sha256.Sum256([]byte(linkToken))
+	return "link:" + hex.EncodeToString(hashed[:])
+}
+
+// linkIPAttemptsKey is separate from ipAttemptsKey, failed link passwords must not lock logins
+func linkIPAttemptsKey(clientIP string) string {
+	return "link-ip:" + clientIP
+}
+
+// throttleKey is what attempts are counted against, e.g. an account or a client IP
+type throttleKey struct {
+	key           string
+	lockThreshold int
+	// clearOnSuccess clears all failures of the key when the attempt succeeds, otherwise only the
+	// attempt itself is discounted. e.g. a successful login from an IP must not clear the
+	// failures of attempts against other accounts from the same IP.
+	clearOnSuccess bool
+}
+
+// loginAttempt is an attempt counted against its keys before the credentials are verified,
+// it is to be concluded with either loginFailed or loginSucceeded
+type loginAttempt struct {
+	keys     []throttleKey
+	failures []int
+}
+
+// startLoginAttempt counts the attempt against all the keys, or returns LoginThrottledError if
+// any of them is locked or backing off
+func (us *Users) startLoginAttempt(ctx context.Context, keys ...throttleKey) (*loginAttempt, error) {
+	now := time.Now()
+	attempt := &loginAttempt{
+		keys:     make([]throttleKey, 0, len(keys)),
+		failures: make([]int, 0, len(keys)),
+	}
+	for _, tk := range keys {
+		failures, ok, err := us.store.StartLoginAttempt(ctx, tk.key, now, &us.cfg.LoginThrottle, tk.lockThreshold)
+		if err == nil && !ok {
+			err = us.loginThrottled(ctx, tk.key, now)
+		}
+		if err != nil {
+			// the attempt was rejected, it should not count against the keys it was already counted for
+			us.discountLoginAttempt(ctx, attempt.keys...)
+			return nil, err
+		}
+
+		attempt.keys = append(attempt.keys, tk)
+		attempt.failures = append(attempt.failures, failures)
+	}
+
+	return attempt, nil
+}
+
+// loginThrottled returns the error for an attempt rejected by the throttle of the key
+func (us *Users) loginThrottled(ctx context.Context, key string, now time.Time) error {
+	attempts, err := us.store.GetLoginAttempts(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+
+	throttled := &LoginThrottledError{}
+	if len(attempts) != 0 {
+		throttled.RetryAfter, throttled.Locked = attempts[0].retryAfter(&us.cfg.LoginThrottle, now)
+	}
+
+	// the key could have been locked by a concurrent attempt which is yet to conclude
+	if throttled.RetryAfter <= 0 {
+		throttled.RetryAfter = us.cfg.LoginThrottle.BackoffBase
+	}
+
+	return throttled
+}
+
+// loginFailed locks the keys which reached their threshold. Failing to do so is only logged, so
+// that the user gets the actual reason for the failed login.
+func (us *Users) loginFailed(ctx context.Context, attempt *loginAttempt) {
+	now := time.Now()
+	for i, tk := range attempt.keys {
+		if tk.lockThreshold <= 0 || attempt.failures[i] < tk.lockThreshold {
+			continue
+		}
+
+		err := us.store.LockLogin(ctx, tk.key, now.Add(us.cfg.LoginThrottle.LockDuration))
+		if err != nil {
+			logger.Error(ctx, errors.Wrap(err, "failed locking login"))
+		}
+	}
+}
+
+// loginSucceeded clears the failures of the keys, or takes back the attempt if the failures are
+// not to be cleared. Failing to do so is not fatal.
+func (us *Users) loginSucceeded(ctx context.Context, attempt *loginAttempt) {
+	for _, tk := range attempt.keys {
+		if !tk.clearOnSuccess {
+			us.discountLoginAttempt(ctx, tk)
+			continue
+		}
+
+		err := us.store.ClearLoginFailures(ctx, tk.key)
+		if err != nil {
+			logger.Error(ctx, errors.Wrap(err, "failed clearing login failures"))
+		}
+	}
+}
+
+func (us *Users) discountLoginAttempt(ctx context.Context, keys ...throttleKey) {
+	for _, tk := range keys {
+		err := us.store.DiscountLoginAttempt(ctx, tk.key)
+		if err != nil {
+			logger.Error(ctx, errors.Wrap(err, "failed discounting login attempt"))
+		}
+	}
+}
+
+// PasswordAttempt is an attempt at the password of a share link, throttled the same way as
+// logins. It is to be concluded with one of Failed, Succeeded or Discard.
+type PasswordAttempt struct {
+	us      *Users
+	attempt *loginAttempt
+}
+
+// StartLinkPasswordAttempt counts an attempt at the password of the share link, per link and per
+// client IP. It returns LoginThrottledError if there were too many failed attempts.
+func (us *Users) StartLinkPasswordAttempt(ctx context.Context, linkToken, clientIP string) (*PasswordAttempt, error) {
+	attempt, err := us.startLoginAttempt(
+		ctx,
+		throttleKey{
+			key:            linkAttemptsKey(linkToken),
+			lockThreshold:  us.cfg.LoginThrottle.AccountLockThreshold,
+			clearOnSuccess: true,
+		},
+		throttleKey{
+			key:           linkIPAttemptsKey(clientIP),
+			lockThreshold: us.cfg.LoginThrottle.IPLockThreshold,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasswordAttempt{us: us, attempt: attempt}, nil
+}
+
+// Failed concludes the attempt with a wrong password
+func (pa *PasswordAttempt) Failed(ctx context.Context) {
+	pa.us.loginFailed(ctx, pa.attempt)
+}
+
+// Succeeded concludes the attempt with the right password
+func (pa *PasswordAttempt) Succeeded(ctx context.Context) {
+	pa.us.loginSucceeded(ctx, pa.attempt)
+}
+
+// Discard takes back the attempt, when the password could not be verified
+func (pa *PasswordAttempt) Discard(ctx context.Context) {
+	pa.us.discountLoginAttempt(ctx, pa.attempt.keys...)
+}
+
+// Unlock clears all failed login attempts of the user, lifting any lock on the account
+func (us *Users) Unlock(ctx context.Context, userID string) error {
+	user, err := us.ReadByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = us.store.ClearLoginFailures(ctx, accountAttemptsKey(user.Email))
+	if err != nil {
+		return errors.Wrap(err, "failed unlocking user")
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/totp"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("two-factor authentication is not enrolled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor authentication code")
+	ErrMFAUnavailable    = errors.New("two-factor authentication is not available")
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew is the number of time steps of clock drift tolerated between the server and the authenticator
+	totpSkew = 1
+)
+
+// SecretCipher encrypts and decrypts secrets which are stored at rest
+type SecretCipher interface {
+	Encrypt(plain []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// MFA is the two-factor authentication state of a user
+type MFA struct {
+	// Secret is the encrypted TOTP secret
+	Secret    []byte
+	EnabledAt *time.Time
+	// LastStep is the last TOTP time step used to authenticate
+	LastStep int64
+}
+
+// MFAEnrollment has everything the user needs to setup their authenticator app. This is
+// available only once, during enrollment.
+type MFAEnrollment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCode returns a random code of the form xxxxx-xxxxx
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", errors.Wrap(err, "failed generating recovery code")
+	}
+
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// EnrollMFA generates a new TOTP secret and recovery codes for the user. Two-factor authentication
+// is enabled only after the enrollment is confirmed with a valid code.
+func (us *Users) EnrollMFA(ctx context.Context, userID string) (*MFAEnrollment, error) {
+	user, err := us.ReadByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabled {
+		return nil, errors.DuplicateErr(ErrMFAAlreadyEnabled, ErrMFAAlreadyEnabled.Error())
+	}
+
+	if us.cipher == nil {
+		return nil, errors.ValidationErr(ErrMFAUnavailable, ErrMFAUnavailable.Error())
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := us.cipher.Encrypt(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed encrypting TOTP secret")
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashSecretToken(normalizeRecoveryCode(code)))
+	}
+
+	err = us.store.SaveMFASecret(ctx, user.ID, encrypted, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret:        totp.EncodeSecret(secret),
+		URI:           totp.URI(us.cfg.MFAIssuer, user.Email, secret),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// ConfirmMFA enables two-factor authentication, if the code is valid for the enrolled secret
+func (us *Users) ConfirmMFA(ctx context.Context, userID string, code string) error {
+	mfa, err := us.store.GetMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if len(mfa.Secret) == 0 {
+		return errors.ValidationErr(ErrMFANotEnrolled, ErrMFANotEnrolled.Error())
+	}
+
+	if mfa.EnabledAt != nil {
+		return errors.DuplicateErr(ErrMFAAlreadyEnabled, ErrMFAAlreadyEnabled.Error())
+	}
+
+	ok, err := us.verifyTOTP(ctx, userID, mfa, code)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.ValidationErr(ErrInvalidMFACode, ErrInvalidMFACode.Error())
+	}
+
+	return us.store.EnableMFA(ctx, userID)
+}
+
+// VerifyMFA completes the second step of login, using either a TOTP or a recovery code. Failed
+// attempts are throttled the same way as failed logins.
+func (us *Users) VerifyMFA(ctx context.Context, userID string, code string) (*User, error) {
+	user, err := us.ReadByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := us.store.GetMFA(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if mfa.EnabledAt == nil {
+		return nil, errors.ValidationErr(ErrMFANotEnabled, ErrMFANotEnabled.Error())
+	}
+
+	attempt, err := us.startLoginAttempt(ctx, throttleKey{
+		key:            accountAttemptsKey(user.Email),
+		lockThreshold:  us.cfg.LoginThrottle.AccountLockThreshold,
+		clearOnSuccess: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	code = strings.TrimSpace(code)
+	ok := false
+	if len(code) == totp.Digits {
+		ok, err = us.verifyTOTP(ctx, userID, mfa, code)
+	} else {
+		ok, err = us.store.ConsumeRecoveryCode(ctx, userID, hashSecretToken(normalizeRecoveryCode(code)))
+	}
+	if err != nil {
+		us.discountLoginAttempt(ctx, attempt.keys...)
+		return nil, err
+	}
+
+	if !ok {
+		us.loginFailed(ctx, attempt)
+		return nil, errors.UnauthenticatedErr(ErrInvalidMFACode, ErrInvalidMFACode.Error())
+	}
+
+	us.loginSucceeded(ctx, attempt)
+
+	return user, nil
+}
+
+// verifyTOTP checks the code against the secret. A code is accepted only once, i.e. a code of
+// a time step already used (or older) is rejected even if it's otherwise valid.
+func (us *Users) verifyTOTP(ctx context.Context, userID string, mfa *MFA, code string) (bool, error) {
+	// the encryption key is no longer configured, only recovery codes can be used
+	if us.cipher == nil {
+		return false, errors.ValidationErr(ErrMFAUnavailable, ErrMFAUnavailable.Error())
+	}
+
+	secret, err := us.cipher.Decrypt(mfa.Secret)
+	if err != nil {
+		return false, errors.Wrap(err, "failed decrypting TOTP secret")
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok || step <= mfa.LastStep {
+		return false, nil
+	}
+
+	return us.store.UseMFAStep(ctx, userID, step)
+}
+
+// DisableMFA turns off two-factor authentication for the user, after confirming it's them
+func (us *Users) DisableMFA(ctx context.Context, userID string, reauth *Reauthentication) error {
+	user, err := us.ReadByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = user.Reauthenticate(us.hasher, reauth, us.cfg.ReauthMaxAge)
+	if err != nil {
+		return err
+	}
+
+	return us.store.DisableMFA(ctx, user.ID)
+}
@@ -0,0 +1,87 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/logger"
+	"github.com/baobei23/goapp/internal/pkg/mailer"
+)
+
+var ErrInvalidResetToken = errors.New("password reset token is invalid or has expired")
+
+// ForgotPassword issues a single-use password reset token and mails it to the user, unless one
+// was issued within the reset interval. It does not disclose whether the email belongs to a
+// registered user, hence the email is sent in the background.
+func (us *Users) ForgotPassword(ctx context.Context, email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.Validation("no email provided")
+	}
+
+	user, err := us.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserEmailNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, hashed, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(us.cfg.PasswordResetExpiry)
+	saved, err := us.store.SavePasswordResetToken(ctx, user.ID, hashed, expiresAt, now.Add(-us.cfg.PasswordResetInterval))
+	if err != nil || !saved {
+		return err
+	}
+
+	msg := &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Use the following token to reset your password: %s\nThe token expires at %s.",
+			token,
+			expiresAt.UTC().Format(time.RFC1123),
+		),
+	}
+
+	// the request could be over before the email is sent
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		err := us.mailer.Send(ctx, msg)
+		if err != nil {
+			logger.Error(ctx, errors.Wrap(err, "failed sending password reset email"))
+		}
+	}()
+
+	return nil
+}
+
+// ResetPassword sets a new password for the user the reset token was issued to, and returns
+// the ID of the user. The token is consumed in the process and cannot be used again.
+func (us *Users) ResetPassword(ctx context.Context, token string, password string) (string, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.Validation("no reset token provided")
+	}
+
+	user := &User{Password: []byte(password)}
+	if len(user.Password) == 0 {
+		return "", errors.Validation("password cannot be empty")
+	}
+
+	err := user.HashPassword(us.hasher)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to hash password")
+	}
+
+	return us.store.ResetPassword(ctx, hashSecretToken(token), user.Password)
+}
@@ -0,0 +1,29 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/naughtygopher/errors"
+)
+
+const secretTokenLength = 32
+
+// newSecretToken generates a random token to be handed out to the user, along with its hash.
+// Only the hash is ever persisted.
+func newSecretToken() (string, []byte, error) {
+	raw := make([]byte, secretTokenLength)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed generating token")
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashSecretToken(token), nil
+}
+
+func hashSecretToken(token string) []byte {
+	hashed := sha256.Sum256([]byte(token))
+	return hashed[:]
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -13,16 +14,62 @@ import (
 )
 
 type pgstore struct {
-	pqdriver  *pgxpool.Pool
-	tableName string
+	pqdriver                *pgxpool.Pool
+	tableName               string
+	resetTokensTable        string
+	verificationTokensTable string
+	userRolesTable          string
+	rolePermissionsTable    string
+	loginAttemptsTable      string
+	recoveryCodesTable      string
+	identitiesTable         string
 }
 
 func (ps *pgstore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	user, err := ps.getUser(ctx, "email", email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NotFoundErr(ErrUserEmailNotFound, email)
+		}
+		return nil, errors.Wrap(err, "failed getting user info")
+	}
+
+	return user, nil
+}
+
+func (ps *pgstore) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	user, err := ps.getUser(ctx, "id", userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NotFoundErr(ErrUserIDNotFound, userID)
+		}
+		return nil, errors.Wrap(err, "failed getting user info")
+	}
+
+	return user, nil
+}
+
+func (ps *pgstore) getUser(ctx context.Context, column string, value string) (*User, error) {
 	query := fmt.Sprintf(`
-		SELECT id, full_name, email, password, phone, contact_address
-		FROM %s
-		WHERE email = $1`,
+		SELECT u.id, u.full_name, u.email, u.password, u.phone, u.contact_address,
+			u.password_changed_at, u.verified_at, u.mfa_enabled_at IS NOT NULL, u.passwordless,
+			ARRAY(
+				SELECT ur.role FROM %[2]s ur
+				WHERE ur.user_id = u.id
+				ORDER BY ur.role
+			),
+			ARRAY(
+				SELECT DISTINCT rp.permission FROM %[2]s ur
+				JOIN %[3]s rp ON rp.role = ur.role
+				WHERE ur.user_id = u.id
+				ORDER BY rp.permission
+			)
+		FROM %[1]s u
+		WHERE u.%[4]s = $1`,
 		ps.tableName,
+		ps.userRolesTable,
+		ps.rolePermissionsTable,
+		column,
 	)
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -32,18 +79,21 @@ func (ps *pgstore) GetUserByEmail(ctx context.Context, email string) (*User, err
 	uid := new(uuid.NullUUID)
 	address := new(sql.NullString)
 	phone := new(sql.NullString)
+	passwordChangedAt := new(sql.NullTime)
+	verifiedAt := new(sql.NullTime)
 
-	row := ps.pqdriver.QueryRow(ctx, query, email)
-	err := row.Scan(uid, &user.FullName, &user.Email, &user.Password, phone, address)
+	row := ps.pqdriver.QueryRow(ctx, query, value)
+	err := row.Scan(uid, &user.FullName, &user.Email, &user.Password, phone, address, passwordChangedAt, verifiedAt, &user.MFAEnabled, &user.Passwordless, &user.Roles, &user.Permissions)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, errors.NotFoundErr(ErrUserEmailNotFound, email)
-		}
-		return nil, errors.Wrap(err, "failed getting user info")
+		return nil, err
 	}
 	user.ID = uid.UUID.String()
 	user.ContactAddress = address.String
 	user.Phone = phone.String
+	user.PasswordChangedAt = passwordChangedAt.Time
+	if verifiedAt.Valid {
+		user.VerifiedAt = &verifiedAt.Time
+	}
 
 	return user, nil
 }
@@ -52,8 +102,8 @@ func (ps *pgstore) SaveUser(ctx context.Context, user *User) (string, error) {
 	user.ID = ps.newUserID()
 
 	query := fmt.Sprintf(`
-		INSERT INTO %s (id, full_name, email, password, phone, contact_address)
-		VALUES ($1, $2, $3, $4, $5, $6)`,
+		INSERT INTO %s (id, full_name, email, password, phone, contact_address, passwordless)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
 		ps.tableName,
 	)
 
@@ -73,6 +123,7 @@ func (ps *pgstore) SaveUser(ctx context.Context, user *User) (string, error) {
 			String: user.ContactAddress,
 			Valid:  len(user.ContactAddress) != 0,
 		},
+		user.Passwordless,
 	)
 
 	if err != nil {
@@ -130,13 +181,718 @@ func (ps *pgstore) BulkSaveUser(ctx context.Context, users []User) error {
 	return nil
 }
 
+func (ps *pgstore) UpdateUser(ctx context.Context, user *User) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET full_name = $2, phone = $3, contact_address = $4
+		WHERE id = $1`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query,
+		user.ID,
+		user.FullName,
+		sql.NullString{
+			String: user.Phone,
+			Valid:  len(user.Phone) != 0,
+		},
+		sql.NullString{
+			String: user.ContactAddress,
+			Valid:  len(user.ContactAddress) != 0,
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed updating user info")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.NotFoundErr(ErrUserIDNotFound, user.ID)
+	}
+
+	return nil
+}
+
+func (ps *pgstore) UpdatePassword(ctx context.Context, userID string, password []byte) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET password = $2, password_changed_at = now()
+		WHERE id = $1`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query, userID, password)
+	if err != nil {
+		return errors.Wrap(err, "failed updating password")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.NotFoundErr(ErrUserIDNotFound, userID)
+	}
+
+	return nil
+}
+
+// SetPasswordHash replaces the password hash without considering it a password change,
+// e.g. when the same password is rehashed with a different algorithm
+func (ps *pgstore) SetPasswordHash(ctx context.Context, userID string, password []byte) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET password = $2
+		WHERE id = $1`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, userID, password)
+	if err != nil {
+		return errors.Wrap(err, "failed updating password hash")
+	}
+
+	return nil
+}
+
+// DeleteUser deletes the user in a single statement, i.e. a single transaction. All the rows
+// referring to the user (notes, tokens etc.) are deleted by the respective "ON DELETE CASCADE" rules.
+func (ps *pgstore) DeleteUser(ctx context.Context, userID string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, ps.tableName)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed deleting user")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return errors.NotFoundErr(ErrUserIDNotFound, userID)
+	}
+
+	return nil
+}
+
+func (ps *pgstore) GetLoginAttempts(ctx context.Context, keys []string) ([]LoginAttempts, error) {
+	query := fmt.Sprintf(`
+		SELECT key, failures, last_failed_at, locked_until
+		FROM %s
+		WHERE key = ANY($1)`,
+		ps.loginAttemptsTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.pqdriver.Query(ctx, query, keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed getting login attempts")
+	}
+	defer rows.Close()
+
+	attempts := make([]LoginAttempts, 0, len(keys))
+	for rows.Next() {
+		la := LoginAttempts{}
+		lastFailedAt := new(sql.NullTime)
+		lockedUntil := new(sql.NullTime)
+		err = rows.Scan(&la.Key, &la.Failures, lastFailedAt, lockedUntil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading login attempts")
+		}
+		la.LastFailedAt = lastFailedAt.Time
+		la.LockedUntil = lockedUntil.Time
+		attempts = append(attempts, la)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed getting login attempts")
+	}
+
+	return attempts, nil
+}
+
+// StartLoginAttempt counts an attempt against the key before the credentials are verified and
+// returns the consecutive failures, including this attempt. The throttle is checked and the
+// attempt counted in a single statement, so concurrent attempts cannot all get past the check.
+// If the key is locked or still backing off, nothing is recorded and false is returned.
+// Failures which happened more than FailureWindow ago are not counted, and a lockThreshold of
+// 0 disables locking.
+func (ps *pgstore) StartLoginAttempt(ctx context.Context, key string, at time.Time, cfg *LoginThrottleConfig, lockThreshold int) (int, bool, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO %[1]s (key, failures, last_failed_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN %[1]s.last_failed_at IS NULL OR %[1]s.last_failed_at < $3 THEN 1
+				ELSE %[1]s.failures + 1
+			END,
+			last_failed_at = $2
+		WHERE (%[1]s.locked_until IS NULL OR %[1]s.locked_until <= $2)
+			AND (
+				%[1]s.last_failed_at IS NULL OR %[1]s.last_failed_at < $3
+				OR (
+					($4::int <= 0 OR %[1]s.failures < $4::int)
+					AND (
+						%[1]s.failures <= $5::int
+						OR %[1]s.last_failed_at + LEAST(
+							$6::interval * power(2::float8, LEAST(%[1]s.failures - $5::int - 1, 30)),
+							$7::interval
+						) <= $2
+					)
+				)
+			)
+		RETURNING failures`,
+		ps.loginAttemptsTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	failures := 0
+	err := ps.pqdriver.QueryRow(
+		ctx,
+		query,
+		key,
+		at,
+		at.Add(-cfg.FailureWindow),
+		lockThreshold,
+		cfg.FreeAttempts,
+		cfg.BackoffBase,
+		cfg.BackoffMax,
+	).Scan(&failures)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed recording login attempt")
+	}
+
+	return failures, true, nil
+}
+
+// DiscountLoginAttempt takes back an attempt counted by StartLoginAttempt, e.g. when it succeeded
+func (ps *pgstore) DiscountLoginAttempt(ctx context.Context, key string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET failures = GREATEST(failures - 1, 0)
+		WHERE key = $1`,
+		ps.loginAttemptsTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, key)
+	if err != nil {
+		return errors.Wrap(err, "failed discounting login attempt")
+	}
+
+	return nil
+}
+
+// LockLogin locks the key until the given time. The failures are reset, so that attempts
+// after the lock expires start afresh.
+func (ps *pgstore) LockLogin(ctx context.Context, key string, until time.Time) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET locked_until = $2, failures = 0
+		WHERE key = $1`,
+		ps.loginAttemptsTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, key, until)
+	if err != nil {
+		return errors.Wrap(err, "failed locking login")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) ClearLoginFailures(ctx context.Context, key string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE key = $1`, ps.loginAttemptsTable)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, key)
+	if err != nil {
+		return errors.Wrap(err, "failed clearing login failures")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) GetMFA(ctx context.Context, userID string) (*MFA, error) {
+	query := fmt.Sprintf(`
+		SELECT mfa_secret, mfa_enabled_at, mfa_last_step
+		FROM %s
+		WHERE id = $1`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	mfa := new(MFA)
+	enabledAt := new(sql.NullTime)
+	err := ps.pqdriver.QueryRow(ctx, query, userID).Scan(&mfa.Secret, enabledAt, &mfa.LastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NotFoundErr(ErrUserIDNotFound, userID)
+		}
+		return nil, errors.Wrap(err, "failed getting MFA info")
+	}
+
+	if enabledAt.Valid {
+		mfa.EnabledAt = &enabledAt.Time
+	}
+
+	return mfa, nil
+}
+
+// SaveMFASecret replaces the TOTP secret and all recovery codes of the user, and keeps
+// MFA disabled until it's enabled again using EnableMFA
+func (ps *pgstore) SaveMFASecret(ctx context.Context, userID string, secret []byte, recoveryCodeHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.pqdriver.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	_, err = tx.Exec(ctx,
+		fmt.Sprintf(`
+			UPDATE %s
+			SET mfa_secret = $2, mfa_enabled_at = NULL, mfa_last_step = 0
+			WHERE id = $1`,
+			ps.tableName,
+		),
+		userID,
+		secret,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed storing MFA secret")
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = $1`, ps.recoveryCodesTable), userID)
+	if err != nil {
+		return errors.Wrap(err, "failed deleting recovery codes")
+	}
+
+	rows := make([][]any, 0, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		rows = append(rows, []any{uuid.NewString(), userID, hash})
+	}
+
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{ps.recoveryCodesTable},
+		[]string{"id", "user_id", "code_hash"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed storing recovery codes")
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed committing MFA secret")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) EnableMFA(ctx context.Context, userID string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET mfa_enabled_at = now()
+		WHERE id = $1 AND mfa_secret IS NOT NULL`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed enabling MFA")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) DisableMFA(ctx context.Context, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.pqdriver.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	_, err = tx.Exec(ctx,
+		fmt.Sprintf(`
+			UPDATE %s
+			SET mfa_secret = NULL, mfa_enabled_at = NULL, mfa_last_step = 0
+			WHERE id = $1`,
+			ps.tableName,
+		),
+		userID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed disabling MFA")
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = $1`, ps.recoveryCodesTable), userID)
+	if err != nil {
+		return errors.Wrap(err, "failed deleting recovery codes")
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed committing MFA removal")
+	}
+
+	return nil
+}
+
+// UseMFAStep records the TOTP time step as used. It returns false if the same or a later
+// step was already used, so that concurrent requests cannot reuse a code.
+func (ps *pgstore) UseMFAStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET mfa_last_step = $2
+		WHERE id = $1 AND mfa_last_step < $2`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, errors.Wrap(err, "failed storing MFA step")
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ConsumeRecoveryCode marks the recovery code as used, it returns false if there's no such unused code
+func (ps *pgstore) ConsumeRecoveryCode(ctx context.Context, userID string, codeHash []byte) (bool, error) {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		ps.recoveryCodesTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tag, err := ps.pqdriver.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, errors.Wrap(err, "failed consuming recovery code")
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (ps *pgstore) AssignRole(ctx context.Context, userID string, role string) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (user_id, role)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, role) DO NOTHING`,
+		ps.userRolesTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, userID, role)
+	if err != nil {
+		if strings.Contains(err.Error(), "violates foreign key constraint \"user_roles_role_fkey\"") {
+			return errors.NotFoundErr(ErrRoleNotFound, role)
+		}
+		if strings.Contains(err.Error(), "violates foreign key constraint \"user_roles_user_id_fkey\"") {
+			return errors.NotFoundErr(ErrUserIDNotFound, userID)
+		}
+		return errors.Wrap(err, "failed assigning role")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) RevokeRole(ctx context.Context, userID string, role string) error {
+	query := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE user_id = $1 AND role = $2`,
+		ps.userRolesTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, userID, role)
+	if err != nil {
+		return errors.Wrap(err, "failed revoking role")
+	}
+
+	return nil
+}
+
+func (ps *pgstore) MarkEmailVerified(ctx context.Context, userID string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET verified_at = now()
+		WHERE id = $1 AND verified_at IS NULL`,
+		ps.tableName,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.pqdriver.Exec(ctx, query, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed marking email as verified")
+	}
+
+	return nil
+}
+
+// SavePasswordResetToken saves the token unless another one was issued to the user after the
+// given time
+func (ps *pgstore) SavePasswordResetToken(ctx context.Context, userID string, tokenHash []byte, expiresAt, since time.Time) (bool, error) {
+	saved, err := ps.saveSecretToken(ctx, ps.resetTokensTable, userID, tokenHash, expiresAt, since)
+	if err != nil {
+		return false, errors.Wrap(err, "failed storing password reset token")
+	}
+
+	return saved, nil
+}
+
+// ResetPassword consumes the reset token and sets the password of the user it was issued to, in a
+// single transaction so that the token is only used up if the password is changed
+func (ps *pgstore) ResetPassword(ctx context.Context, tokenHash []byte, password []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.pqdriver.Begin(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	userID, err := ps.consumeSecretToken(ctx, tx, ps.resetTokensTable, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", errors.ValidationErr(ErrInvalidResetToken, ErrInvalidResetToken.Error())
+		}
+		return "", errors.Wrap(err, "failed consuming password reset token")
+	}
+
+	tag, err := tx.Exec(ctx,
+		fmt.Sprintf(`
+			UPDATE %s
+			SET password = $2, password_changed_at = now(), passwordless = false
+			WHERE id = $1`,
+			ps.tableName,
+		),
+		userID,
+		password,
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "failed updating password")
+	}
+
+	if tag.RowsAffected() == 0 {
+		return "", errors.NotFoundErr(ErrUserIDNotFound, userID)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed committing password reset")
+	}
+
+	return userID, nil
+}
+
+func (ps *pgstore) SaveEmailVerificationToken(ctx context.Context, userID string, tokenHash []byte, expiresAt, since time.Time) (bool, error) {
+	saved, err := ps.saveSecretToken(ctx, ps.verificationTokensTable, userID, tokenHash, expiresAt, since)
+	if err != nil {
+		return false, errors.Wrap(err, "failed storing email verification token")
+	}
+
+	return saved, nil
+}
+
+func (ps *pgstore) ConsumeEmailVerificationToken(ctx context.Context, tokenHash []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	userID, err := ps.consumeSecretToken(ctx, ps.pqdriver, ps.verificationTokensTable, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", errors.ValidationErr(ErrInvalidVerificationToken, ErrInvalidVerificationToken.Error())
+		}
+		return "", errors.Wrap(err, "failed consuming email verification token")
+	}
+
+	return userID, nil
+}
+
+// saveSecretToken saves the token unless another one was issued to the user after the given
+// time. The user is locked while checking for recent tokens, so that concurrent requests cannot
+// issue more than one token
+func (ps *pgstore) saveSecretToken(ctx context.Context, table string, userID string, tokenHash []byte, expiresAt, since time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.pqdriver.Begin(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed starting transaction")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`SELECT 1 FROM %s WHERE id = $1 FOR UPDATE`, ps.tableName), userID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed locking user")
+	}
+
+	tag, err := tx.Exec(ctx,
+		fmt.Sprintf(`
+			INSERT INTO %[1]s (id, user_id, token_hash, expires_at)
+			SELECT $1, $2, $3, $4
+			WHERE NOT EXISTS (SELECT 1 FROM %[1]s WHERE user_id = $2 AND created_at > $5)`,
+			table,
+		),
+		uuid.NewString(),
+		userID,
+		tokenHash,
+		expiresAt,
+		since,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed committing token")
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// rowQuerier is either the pool or a transaction
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// consumeSecretToken marks the token as used and returns the ID of the user it was issued to.
+// The update is done in a single statement, so a token cannot be used twice even by concurrent
+// requests. pgx.ErrNoRows is returned if the token does not exist, is expired or already used.
+func (ps *pgstore) consumeSecretToken(ctx context.Context, q rowQuerier, table string, tokenHash []byte) (string, error) {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id`,
+		table,
+	)
+
+	uid := new(uuid.UUID)
+	err := q.QueryRow(ctx, query, tokenHash).Scan(uid)
+	if err != nil {
+		return "", err
+	}
+
+	return uid.String(), nil
+}
+
+func (ps *pgstore) GetUserIDByIdentity(ctx context.Context, provider string, subject string) (string, error) {
+	query := fmt.Sprintf(`
+		SELECT user_id FROM %s
+		WHERE provider = $1 AND subject = $2`,
+		ps.identitiesTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	uid := new(uuid.UUID)
+	err := ps.pqdriver.QueryRow(ctx, query, provider, subject).Scan(uid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", errors.NotFoundErr(ErrIdentityNotFound, ErrIdentityNotFound.Error())
+		}
+		return "", errors.Wrap(err, "failed getting external identity")
+	}
+
+	return uid.String(), nil
+}
+
+// LinkIdentity links the external identity to the user. Linking an identity which is already
+// linked to the same user is a no-op
+func (ps *pgstore) LinkIdentity(ctx context.Context, userID string, provider string, subject string, email string) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, subject) DO UPDATE
+		SET email = EXCLUDED.email
+		WHERE %[1]s.user_id = EXCLUDED.user_id`,
+		ps.identitiesTable,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := ps.pqdriver.Exec(ctx, query, provider, subject, userID, email)
+	if err != nil {
+		return errors.Wrap(err, "failed linking external identity")
+	}
+
+	if result.RowsAffected() == 0 {
+		return errors.Duplicate("external identity is linked to another user")
+	}
+
+	return nil
+}
+
 func (ps *pgstore) newUserID() string {
 	return uuid.NewString()
 }
 
 func NewPostgresStore(pqdriver *pgxpool.Pool, tablename string) *pgstore {
 	return &pgstore{
-		pqdriver:  pqdriver,
-		tableName: tablename,
+		pqdriver:                pqdriver,
+		tableName:               tablename,
+		resetTokensTable:        "password_reset_tokens",
+		verificationTokensTable: "email_verification_tokens",
+		userRolesTable:          "user_roles",
+		rolePermissionsTable:    "role_permissions",
+		loginAttemptsTable:      "login_attempts",
+		recoveryCodesTable:      "mfa_recovery_codes",
+		identitiesTable:         "user_identities",
 	}
 }
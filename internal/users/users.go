@@ -2,20 +2,40 @@ package users
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/baobei23/goapp/internal/pkg/logger"
+	"github.com/baobei23/goapp/internal/pkg/mailer"
 	"github.com/naughtygopher/errors"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrUserEmailNotFound      = errors.New("user with the email not found")
 	ErrUserEmailAlreadyExists = errors.New("user with the email already exists")
+	ErrUserIDNotFound         = errors.New("user with the ID not found")
+	ErrRoleNotFound           = errors.New("role not found")
+	ErrInvalidCredentials     = errors.New("invalid credentials")
+	ErrReauthRequired         = errors.New("login again with your identity provider to confirm it's you")
+	ErrImpersonationForbidden = errors.New("user cannot be impersonated")
 	QueryTimeoutDuration      = 5 * time.Second
 )
 
+const (
+	// RoleAdmin is the role of administrators, it has all the permissions below
+	RoleAdmin = "admin"
+
+	// PermissionUsersRead allows reading the profile of any user
+	PermissionUsersRead = "users:read"
+	// PermissionUsersManage allows managing any user, e.g. assigning roles
+	PermissionUsersManage = "users:manage"
+	// PermissionUsersImpersonate allows acting as any other user, e.g. to reproduce their issues
+	PermissionUsersImpersonate = "users:impersonate"
+)
+
 type User struct {
 	ID             string `json:"id"`
 	FullName       string `json:"fullName"`
@@ -23,6 +43,37 @@ type User struct {
 	Password       []byte `json:"-"`
 	Phone          string `json:"phone"`
 	ContactAddress string `json:"contactAddress"`
+
+	VerifiedAt        *time.Time `json:"verifiedAt,omitempty"`
+	PasswordChangedAt time.Time  `json:"-"`
+	MFAEnabled        bool       `json:"mfaEnabled"`
+	// Passwordless is true for users provisioned by an identity provider, until they set a
+	// password using the password reset
+	Passwordless bool `json:"passwordless"`
+
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"-"`
+}
+
+// Config holds the configuration required by the users service
+type Config struct {
+	// PasswordResetExpiry is how long a password reset token remains usable after it's issued
+	PasswordResetExpiry time.Duration
+	// EmailVerificationExpiry is how long an email verification token remains usable after it's issued
+	EmailVerificationExpiry time.Duration
+	// EmailVerificationInterval is the minimum time between two verification emails to a user
+	EmailVerificationInterval time.Duration
+	// PasswordResetInterval is the minimum time between two password reset emails to a user
+	PasswordResetInterval time.Duration
+	// RejectUnverifiedLogin if true, does not allow users to login until their email is verified
+	RejectUnverifiedLogin bool
+	// LoginThrottle configures the protection against brute force login attempts
+	LoginThrottle LoginThrottleConfig
+	// MFAIssuer is the name shown in authenticator apps for the TOTP entries
+	MFAIssuer string
+	// ReauthMaxAge is how recently passwordless users must have logged in, to confirm it's them
+	// before sensitive actions
+	ReauthMaxAge time.Duration
 }
 
 // ValidateForCreate runs the validation required for when a user is being created. i.e. ID is not available
@@ -42,6 +93,23 @@ func (us *User) ValidateForCreate() error {
 	return nil
 }
 
+// ValidateForUpdate runs the validation required for when an existing user is being updated
+func (us *User) ValidateForUpdate() error {
+	if us.ID == "" {
+		return errors.Validation("user ID cannot be empty")
+	}
+
+	if us.FullName == "" {
+		return errors.Validation("full name cannot be empty")
+	}
+
+	if us.Email == "" {
+		return errors.Validation("email cannot be empty")
+	}
+
+	return nil
+}
+
 func (us *User) Sanitize() {
 	us.ID = strings.TrimSpace(us.ID)
 	us.FullName = strings.TrimSpace(us.FullName)
@@ -50,8 +118,16 @@ func (us *User) Sanitize() {
 	us.ContactAddress = strings.TrimSpace(us.ContactAddress)
 }
 
-func (us *User) HashPassword() error {
-	hashed, err := bcrypt.GenerateFromPassword(us.Password, bcrypt.DefaultCost)
+// PasswordHasher hashes passwords and verifies plain text passwords against existing hashes
+type PasswordHasher interface {
+	Hash(plain []byte) ([]byte, error)
+	// Verify reports whether the password matches, and whether the hash should be regenerated
+	// because it was generated with an outdated algorithm or parameters
+	Verify(hashed []byte, plain []byte) (ok bool, needsRehash bool, err error)
+}
+
+func (us *User) HashPassword(hasher PasswordHasher) error {
+	hashed, err := hasher.Hash(us.Password)
 	if err != nil {
 		return err
 	}
@@ -59,18 +135,153 @@ func (us *User) HashPassword() error {
 	return nil
 }
 
-func (us *User) CheckPassword(plain string) bool {
-	err := bcrypt.CompareHashAndPassword(us.Password, []byte(plain))
-	return err == nil
+// CheckPassword reports whether the plain text password matches the user's password hash,
+// and whether the hash needs to be regenerated
+func (us *User) CheckPassword(hasher PasswordHasher, plain string) (ok bool, needsRehash bool) {
+	ok, needsRehash, err := hasher.Verify(us.Password, []byte(plain))
+	if err != nil {
+		return false, false
+	}
+	return ok, needsRehash
+}
+
+// Reauthentication is how a user confirms it's them before a sensitive action, e.g. deleting their
+// account. Users confirm their password, while passwordless users must have logged in recently.
+type Reauthentication struct {
+	Password string
+	// AuthTime is when the user logged in, in the session the action is requested from
+	AuthTime time.Time
+}
+
+// Reauthenticate returns an error unless the user confirmed it's them. A passwordless user must
+// have logged in within maxAge.
+func (us *User) Reauthenticate(hasher PasswordHasher, reauth *Reauthentication, maxAge time.Duration) error {
+	if us.Passwordless {
+		if reauth.AuthTime.IsZero() || time.Since(reauth.AuthTime) > maxAge {
+			return errors.UnauthorizedErr(ErrReauthRequired, ErrReauthRequired.Error())
+		}
+		return nil
+	}
+
+	if ok, _ := us.CheckPassword(hasher, reauth.Password); !ok {
+		return errors.Validation("password is incorrect")
+	}
+
+	return nil
+}
+
+// CanImpersonate returns an error unless the user is allowed to act as the target. Nobody can
+// impersonate themselves, other administrators (i.e. users who can manage or impersonate users),
+// or users with permissions they do not have themselves.
+func (us *User) CanImpersonate(target *User) error {
+	if us.ID == target.ID {
+		return errors.Validation("cannot impersonate yourself")
+	}
+
+	for _, permission := range target.Permissions {
+		if permission == PermissionUsersManage || permission == PermissionUsersImpersonate {
+			return errors.UnauthorizedErr(ErrImpersonationForbidden, "cannot impersonate an administrator")
+		}
+
+		if !slices.Contains(us.Permissions, permission) {
+			return errors.UnauthorizedErr(
+				ErrImpersonationForbidden,
+				fmt.Sprintf("cannot impersonate a user with the %s permission, which you do not have", permission),
+			)
+		}
+	}
+
+	return nil
+}
+
+// IsVerified reports whether the user has verified their email address
+func (us *User) IsVerified() bool {
+	return us.VerifiedAt != nil
+}
+
+// IssuedBeforePasswordChange reports whether a token issued at the given time predates
+// the latest password change of the user. Such tokens should no longer be honoured.
+func (us *User) IssuedBeforePasswordChange(issuedAt time.Time) bool {
+	if us.PasswordChangedAt.IsZero() {
+		return false
+	}
+	// JWT timestamps have a precision of seconds, so a token issued within the same second as
+	// the change cannot be told apart from one issued before it
+	return !issuedAt.After(us.PasswordChangedAt)
+}
+
+// ProfileUpdate has the user profile fields which can be modified by the user. Nil fields are left unchanged
+type ProfileUpdate struct {
+	FullName       *string
+	Phone          *string
+	ContactAddress *string
+}
+
+func (pu *ProfileUpdate) apply(user *User) {
+	if pu.FullName != nil {
+		user.FullName = *pu.FullName
+	}
+
+	if pu.Phone != nil {
+		user.Phone = *pu.Phone
+	}
+
+	if pu.ContactAddress != nil {
+		user.ContactAddress = *pu.ContactAddress
+	}
 }
 
 type store interface {
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByID(ctx context.Context, userID string) (*User, error)
 	SaveUser(ctx context.Context, user *User) (string, error)
 	BulkSaveUser(ctx context.Context, users []User) error
+	UpdateUser(ctx context.Context, user *User) error
+	UpdatePassword(ctx context.Context, userID string, password []byte) error
+	SetPasswordHash(ctx context.Context, userID string, password []byte) error
+	DeleteUser(ctx context.Context, userID string) error
+
+	GetLoginAttempts(ctx context.Context, keys []string) ([]LoginAttempts, error)
+	StartLoginAttempt(ctx context.Context, key string, at time.Time, cfg *LoginThrottleConfig, lockThreshold int) (int, bool, error)
+	DiscountLoginAttempt(ctx context.Context, key string) error
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ClearLoginFailures(ctx context.Context, key string) error
+
+	GetMFA(ctx context.Context, userID string) (*MFA, error)
+	SaveMFASecret(ctx context.Context, userID string, secret []byte, recoveryCodeHashes [][]byte) error
+	EnableMFA(ctx context.Context, userID string) error
+	DisableMFA(ctx context.Context, userID string) error
+	UseMFAStep(ctx context.Context, userID string, step int64) (bool, error)
+	ConsumeRecoveryCode(ctx context.Context, userID string, codeHash []byte) (bool, error)
+
+	AssignRole(ctx context.Context, userID string, role string) error
+	RevokeRole(ctx context.Context, userID string, role string) error
+
+	// SavePasswordResetToken saves the token unless another one was issued to the user after the
+	// given time, in which case it returns false
+	SavePasswordResetToken(ctx context.Context, userID string, tokenHash []byte, expiresAt, since time.Time) (bool, error)
+	// ResetPassword consumes the reset token and sets the password of the user it was issued to,
+	// returning the user ID
+	ResetPassword(ctx context.Context, tokenHash []byte, password []byte) (string, error)
+
+	MarkEmailVerified(ctx context.Context, userID string) error
+	// SaveEmailVerificationToken saves the token unless another one was issued to the user after
+	// the given time, in which case it returns false
+	SaveEmailVerificationToken(ctx context.Context, userID string, tokenHash []byte, expiresAt, since time.Time) (bool, error)
+	ConsumeEmailVerificationToken(ctx context.Context, tokenHash []byte) (string, error)
+
+	GetUserIDByIdentity(ctx context.Context, provider string, subject string) (string, error)
+	LinkIdentity(ctx context.Context, userID string, provider string, subject string, email string) error
 }
 type Users struct {
-	store store
+	cfg    *Config
+	store  store
+	mailer mailer.Sender
+	hasher PasswordHasher
+	cipher SecretCipher
+	// dummyHash is verified against when there's no user, so that it takes as long as
+	// checking the password of an existing user
+	dummyHash func() []byte
 }
 
 func (us *Users) Register(ctx context.Context, user *User) (*User, error) {
@@ -80,7 +291,7 @@ func (us *Users) Register(ctx context.Context, user *User) (*User, error) {
 		return nil, err
 	}
 
-	if err := user.HashPassword(); err != nil {
+	if err := user.HashPassword(us.hasher); err != nil {
 		return nil, errors.Wrap(err, "failed to hash password")
 	}
 
@@ -90,6 +301,12 @@ func (us *Users) Register(ctx context.Context, user *User) (*User, error) {
 	}
 	user.ID = newID
 
+	// registration should not fail because of email delivery, the user can request another token
+	err = us.sendVerification(ctx, user)
+	if err != nil {
+		logger.Error(ctx, errors.Wrap(err, "failed sending email verification"))
+	}
+
 	return user, nil
 }
 
@@ -101,6 +318,100 @@ func (us *Users) ReadByEmail(ctx context.Context, email string) (*User, error) {
 	return us.store.GetUserByEmail(ctx, email)
 }
 
+func (us *Users) ReadByID(ctx context.Context, userID string) (*User, error) {
+	if userID == "" {
+		return nil, errors.Validation("no user ID provided")
+	}
+
+	return us.store.GetUserByID(ctx, userID)
+}
+
+// UpdateProfile updates the profile of an existing user
+func (us *Users) UpdateProfile(ctx context.Context, userID string, update *ProfileUpdate) (*User, error) {
+	user, err := us.ReadByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	update.apply(user)
+	user.Sanitize()
+	err = user.ValidateForUpdate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.store.UpdateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ChangePassword sets a new password for the user, after confirming the current one
+func (us *Users) ChangePassword(ctx context.Context, userID string, currentPassword string, newPassword string) (*User, error) {
+	user, err := us.ReadByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, _ := user.CheckPassword(us.hasher, currentPassword); !ok {
+		return nil, errors.Validation("current password is incorrect")
+	}
+
+	user.Password = []byte(newPassword)
+	if len(user.Password) == 0 {
+		return nil, errors.Validation("password cannot be empty")
+	}
+
+	if err := user.HashPassword(us.hasher); err != nil {
+		return nil, errors.Wrap(err, "failed to hash password")
+	}
+
+	err = us.store.UpdatePassword(ctx, user.ID, user.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	return us.ReadByID(ctx, userID)
+}
+
+// AssignRole grants the role, and thereby all its permissions, to the user
+func (us *Users) AssignRole(ctx context.Context, userID string, role string) error {
+	role = strings.TrimSpace(role)
+	if userID == "" || role == "" {
+		return errors.Validation("user ID and role are required")
+	}
+
+	return us.store.AssignRole(ctx, userID, role)
+}
+
+// RevokeRole takes away the role from the user
+func (us *Users) RevokeRole(ctx context.Context, userID string, role string) error {
+	role = strings.TrimSpace(role)
+	if userID == "" || role == "" {
+		return errors.Validation("user ID and role are required")
+	}
+
+	return us.store.RevokeRole(ctx, userID, role)
+}
+
+// Delete permanently removes the user, after confirming it's them. Everything owned by the user
+// is removed along with it, by the cascading foreign keys in the datastore.
+func (us *Users) Delete(ctx context.Context, userID string, reauth *Reauthentication) error {
+	user, err := us.ReadByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = user.Reauthenticate(us.hasher, reauth, us.cfg.ReauthMaxAge)
+	if err != nil {
+		return err
+	}
+
+	return us.store.DeleteUser(ctx, user.ID)
+}
+
 func (us *Users) AsyncRegisters(ctx context.Context, users []User) error {
 	errList := make([]error, 0, len(users))
 	for i := range users {
@@ -110,7 +421,7 @@ func (us *Users) AsyncRegisters(ctx context.Context, users []User) error {
 			continue
 		}
 
-		if err := users[i].HashPassword(); err != nil {
+		if err := users[i].HashPassword(us.hasher); err != nil {
 			errList = append(errList, err)
 		}
 	}
@@ -130,20 +441,88 @@ func (us *Users) AsyncRegisters(ctx context.Context, users []User) error {
 	return nil
 }
 
-func (us *Users) Login(ctx context.Context, email, password string) (*User, error) {
-	user, err := us.store.GetUserByEmail(ctx, email)
+func (us *Users) Login(ctx context.Context, email, password, clientIP string) (*User, error) {
+	attempt, err := us.startLoginAttempt(
+		ctx,
+		throttleKey{
+			key:            accountAttemptsKey(email),
+			lockThreshold:  us.cfg.LoginThrottle.AccountLockThreshold,
+			clearOnSuccess: true,
+		},
+		throttleKey{
+			key:           ipAttemptsKey(clientIP),
+			lockThreshold: us.cfg.LoginThrottle.IPLockThreshold,
+		},
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	if !user.CheckPassword(password) {
-		return nil, errors.New("invalid credentials")
+	user, err := us.store.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, ErrUserEmailNotFound) {
+		us.discountLoginAttempt(ctx, attempt.keys...)
+		return nil, err
 	}
+
+	ok, needsRehash := false, false
+	if user != nil {
+		ok, needsRehash = user.CheckPassword(us.hasher, password)
+	} else {
+		// not disclosing whether the email is registered by how long the login takes
+		_, _, _ = us.hasher.Verify(us.dummyHash(), []byte(password))
+	}
+
+	if !ok {
+		us.loginFailed(ctx, attempt)
+		return nil, errors.UnauthenticatedErr(ErrInvalidCredentials, ErrInvalidCredentials.Error())
+	}
+
+	us.loginSucceeded(ctx, attempt)
+
+	if needsRehash {
+		us.rehashPassword(ctx, user, password)
+	}
+
+	if us.cfg.RejectUnverifiedLogin && !user.IsVerified() {
+		return nil, errors.Unauthorized("email address is not verified")
+	}
+
 	return user, nil
 }
 
-func NewService(store store) *Users {
+// rehashPassword upgrades the user's password hash to the current algorithm and parameters.
+// Failing to do so is not fatal, it'd be attempted again on the next login.
+func (us *Users) rehashPassword(ctx context.Context, user *User, plain string) {
+	hashed, err := us.hasher.Hash([]byte(plain))
+	if err != nil {
+		logger.Error(ctx, errors.Wrap(err, "failed rehashing password"))
+		return
+	}
+
+	err = us.store.SetPasswordHash(ctx, user.ID, hashed)
+	if err != nil {
+		logger.Error(ctx, errors.Wrap(err, "failed storing rehashed password"))
+		return
+	}
+
+	user.Password = hashed
+}
+
+// NewService returns the users service. cipher can be nil, in which case users cannot enroll
+// for two-factor authentication.
+func NewService(cfg *Config, store store, mailer mailer.Sender, hasher PasswordHasher, cipher SecretCipher) *Users {
 	return &Users{
-		store: store,
+		cfg:    cfg,
+		store:  store,
+		mailer: mailer,
+		hasher: hasher,
+		cipher: cipher,
+		dummyHash: sync.OnceValue(func() []byte {
+			hashed, err := hasher.Hash([]byte("dummy password"))
+			if err != nil {
+				logger.Error(context.Background(), errors.Wrap(err, "failed hashing dummy password"))
+			}
+			return hashed
+		}),
 	}
 }
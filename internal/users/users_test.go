@@ -3,6 +3,9 @@ package users
 import (
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/naughtygopher/errors"
 )
 
 func TestUser_Sanitize(t *testing.T) {
@@ -107,3 +110,297 @@ func TestUser_ValidateForCreate(t *testing.T) {
 		})
 	}
 }
+
+func TestUser_IssuedBeforePasswordChange(t *testing.T) {
+	changedAt := time.Date(2025, 1, 1, 10, 0, 0, 500, time.UTC)
+	tests := []struct {
+		name      string
+		changedAt time.Time
+		issuedAt  time.Time
+		want      bool
+	}{
+		{
+			name:     "password never changed",
+			issuedAt: changedAt,
+			want:     false,
+		},
+		{
+			name:      "issued before change",
+			changedAt: changedAt,
+			issuedAt:  changedAt.Add(-time.Minute),
+			want:      true,
+		},
+		{
+			name:      "issued within the same second",
+			changedAt: changedAt,
+			issuedAt:  changedAt.Truncate(time.Second),
+			want:      true,
+		},
+		{
+			name:      "issued after change",
+			changedAt: changedAt,
+			issuedAt:  changedAt.Add(time.Minute),
+			want:      false,
+		},
+		{
+			name:      "issued in the next second",
+			changedAt: changedAt,
+			issuedAt:  changedAt.Truncate(time.Second).Add(time.Second),
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us := &User{PasswordChangedAt: tt.changedAt}
+			if got := us.IssuedBeforePasswordChange(tt.issuedAt); got != tt.want {
+				t.Errorf("User.IssuedBeforePasswordChange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUser_ValidateForUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    User
+		wantErr bool
+	}{
+		{
+			name: "no error",
+			user: User{
+				ID:       "ID::1",
+				FullName: "Full Name",
+				Email:    "name@example.com",
+			},
+			wantErr: false,
+		},
+		{
+			name: "no ID",
+			user: User{
+				FullName: "Full Name",
+				Email:    "name@example.com",
+			},
+			wantErr: true,
+		},
+		{
+			name: "no name",
+			user: User{
+				ID:    "ID::1",
+				Email: "name@example.com",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.user.ValidateForUpdate(); (err != nil) != tt.wantErr {
+				t.Errorf("User.ValidateForUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoginAttempts_retryAfter(t *testing.T) {
+	cfg := &LoginThrottleConfig{
+		FreeAttempts:  3,
+		BackoffBase:   time.Second,
+		BackoffMax:    time.Minute,
+		FailureWindow: time.Hour,
+	}
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		attempts   LoginAttempts
+		wantWait   time.Duration
+		wantLocked bool
+	}{
+		{
+			name: "within free attempts",
+			attempts: LoginAttempts{
+				Failures:     3,
+				LastFailedAt: now,
+			},
+		},
+		{
+			name: "first backoff",
+			attempts: LoginAttempts{
+				Failures:     4,
+				LastFailedAt: now,
+			},
+			wantWait: time.Second,
+		},
+		{
+			name: "exponential backoff",
+			attempts: LoginAttempts{
+				Failures:     6,
+				LastFailedAt: now.Add(-time.Second),
+			},
+			wantWait: 3 * time.Second,
+		},
+		{
+			name: "backoff is capped",
+			attempts: LoginAttempts{
+				Failures:     64,
+				LastFailedAt: now,
+			},
+			wantWait: time.Minute,
+		},
+		{
+			name: "backoff elapsed",
+			attempts: LoginAttempts{
+				Failures:     4,
+				LastFailedAt: now.Add(-2 * time.Second),
+			},
+		},
+		{
+			name: "failures outside window",
+			attempts: LoginAttempts{
+				Failures:     20,
+				LastFailedAt: now.Add(-2 * time.Hour),
+			},
+		},
+		{
+			name: "locked",
+			attempts: LoginAttempts{
+				LastFailedAt: now,
+				LockedUntil:  now.Add(5 * time.Minute),
+			},
+			wantWait:   5 * time.Minute,
+			wantLocked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, locked := tt.attempts.retryAfter(cfg, now)
+			if wait != tt.wantWait || locked != tt.wantLocked {
+				t.Errorf("LoginAttempts.retryAfter() = (%v, %v), want (%v, %v)", wait, locked, tt.wantWait, tt.wantLocked)
+			}
+		})
+	}
+}
+
+// plainHasher "hashes" passwords as is
+type plainHasher struct{}
+
+func (plainHasher) Hash(plain []byte) ([]byte, error) {
+	return plain, nil
+}
+
+func (plainHasher) Verify(hashed []byte, plain []byte) (bool, bool, error) {
+	return string(hashed) == string(plain), false, nil
+}
+
+func TestUser_Reauthenticate(t *testing.T) {
+	maxAge := 5 * time.Minute
+	tests := []struct {
+		name    string
+		user    *User
+		reauth  *Reauthentication
+		wantErr bool
+		// wantReauth is true if the user has to login again, rather than confirm the password
+		wantReauth bool
+	}{
+		{
+			name:   "password confirmed",
+			user:   &User{Password: []byte("secret")},
+			reauth: &Reauthentication{Password: "secret"},
+		},
+		{
+			name:    "incorrect password",
+			user:    &User{Password: []byte("secret")},
+			reauth:  &Reauthentication{Password: "guess", AuthTime: time.Now()},
+			wantErr: true,
+		},
+		{
+			name:   "passwordless user logged in recently",
+			user:   &User{Password: []byte("random"), Passwordless: true},
+			reauth: &Reauthentication{AuthTime: time.Now().Add(-time.Minute)},
+		},
+		{
+			name:       "passwordless user logged in long ago",
+			user:       &User{Password: []byte("random"), Passwordless: true},
+			reauth:     &Reauthentication{AuthTime: time.Now().Add(-time.Hour)},
+			wantErr:    true,
+			wantReauth: true,
+		},
+		{
+			name:       "passwordless user without login time",
+			user:       &User{Password: []byte("random"), Passwordless: true},
+			reauth:     &Reauthentication{Password: "random"},
+			wantErr:    true,
+			wantReauth: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.user.Reauthenticate(plainHasher{}, tt.reauth, maxAge)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("User.Reauthenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if errors.Is(err, ErrReauthRequired) != tt.wantReauth {
+				t.Errorf("User.Reauthenticate() error = %v, wantReauth %v", err, tt.wantReauth)
+			}
+		})
+	}
+}
+
+func TestUser_CanImpersonate(t *testing.T) {
+	actor := &User{
+		ID:          "admin",
+		Permissions: []string{PermissionUsersImpersonate, PermissionUsersRead},
+	}
+	tests := []struct {
+		name    string
+		target  *User
+		wantErr bool
+		// wantForbidden is true if the target cannot be impersonated, rather than the request being invalid
+		wantForbidden bool
+	}{
+		{
+			name:   "user without permissions",
+			target: &User{ID: "user"},
+		},
+		{
+			name:   "user with permissions the actor has",
+			target: &User{ID: "support", Permissions: []string{PermissionUsersRead}},
+		},
+		{
+			name:    "self",
+			target:  &User{ID: "admin", Permissions: actor.Permissions},
+			wantErr: true,
+		},
+		{
+			name:          "user who can manage users",
+			target:        &User{ID: "manager", Permissions: []string{PermissionUsersManage}},
+			wantErr:       true,
+			wantForbidden: true,
+		},
+		{
+			name:          "user who can impersonate users",
+			target:        &User{ID: "other-admin", Permissions: []string{PermissionUsersImpersonate}},
+			wantErr:       true,
+			wantForbidden: true,
+		},
+		{
+			name:          "user with a permission the actor does not have",
+			target:        &User{ID: "auditor", Permissions: []string{PermissionUsersRead, "audit:read"}},
+			wantErr:       true,
+			wantForbidden: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := actor.CanImpersonate(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("User.CanImpersonate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if errors.Is(err, ErrImpersonationForbidden) != tt.wantForbidden {
+				t.Errorf("User.CanImpersonate() error = %v, wantForbidden %v", err, tt.wantForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/naughtygopher/errors"
+
+	"github.com/baobei23/goapp/internal/pkg/mailer"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("email verification token is invalid or has expired")
+	ErrEmailAlreadyVerified     = errors.New("email address is already verified")
+)
+
+// VerificationThrottledError is returned when a verification email is not sent, because another
+// one was sent to the user recently
+type VerificationThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (vte *VerificationThrottledError) Error() string {
+	return fmt.Sprintf("a verification email was sent recently, retry after %s", vte.RetryAfter.Round(time.Second))
+}
+
+func (us *Users) sendVerification(ctx context.Context, user *User) error {
+	token, hashed, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(us.cfg.EmailVerificationExpiry)
+	saved, err := us.store.SaveEmailVerificationToken(ctx, user.ID, hashed, expiresAt, now.Add(-us.cfg.EmailVerificationInterval))
+	if err != nil {
+		return err
+	}
+
+	if !saved {
+		return &VerificationThrottledError{RetryAfter: us.cfg.EmailVerificationInterval}
+	}
+
+	err = us.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Use the following token to verify your email address: %s\nThe token expires at %s.",
+			token,
+			expiresAt.UTC().Format(time.RFC1123),
+		),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed sending email verification")
+	}
+
+	return nil
+}
+
+// IssueVerification sends a new email verification token to the user, unless one was sent
+// within the verification interval, in which case a VerificationThrottledError is returned
+func (us *Users) IssueVerification(ctx context.Context, userID string) error {
+	user, err := us.ReadByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.IsVerified() {
+		return errors.DuplicateErr(ErrEmailAlreadyVerified, ErrEmailAlreadyVerified.Error())
+	}
+
+	return us.sendVerification(ctx, user)
+}
+
+// ResendVerification sends a new email verification token to the email, if it belongs to an
+// unverified user who wasn't sent one within the verification interval. It does not disclose
+// whether the email belongs to a registered user.
+func (us *Users) ResendVerification(ctx context.Context, email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.Validation("no email provided")
+	}
+
+	user, err := us.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserEmailNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if user.IsVerified() {
+		return nil
+	}
+
+	err = us.sendVerification(ctx, user)
+	throttled := &VerificationThrottledError{}
+	if errors.As(err, &throttled) {
+		return nil
+	}
+
+	return err
+}
+
+// VerifyEmail consumes the verification token and marks the respective user's email as verified
+func (us *Users) VerifyEmail(ctx context.Context, token string) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return errors.Validation("no verification token provided")
+	}
+
+	userID, err := us.store.ConsumeEmailVerificationToken(ctx, hashSecretToken(token))
+	if err != nil {
+		return err
+	}
+
+	return us.store.MarkEmailVerified(ctx, userID)
+}
@@ -32,7 +32,7 @@ import (
 //	@securityDefinitions.apikey	ApiKeyAuth
 //	@in							header
 //	@name						Authorization
-//	@description				Bearer token
+//	@description				Bearer token (`Bearer <token>`) or personal API key (`ApiKey <key>`)
 
 var exitErr error
 
@@ -105,7 +105,7 @@ func main() {
 		panic(err)
 	}
 
-	hserver, gserver := start(ctx, probestatus, cfgs, fatalErr)
+	hserver, gserver, stopJobs := start(ctx, probestatus, cfgs, fatalErr)
 
 	defer shutdown(
 		shutdownGraceperiod,
@@ -114,6 +114,7 @@ func main() {
 		healthResponder,
 		hserver,
 		gserver,
+		stopJobs,
 		ap,
 	)
 	exitErr = <-fatalErr
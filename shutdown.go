@@ -21,6 +21,7 @@ func shutdown(
 	healthResp *http.Server,
 	httpServer *xhttp.HTTP,
 	grpcServer *grpc.GRPC,
+	stopJobs func(),
 	apmIns *apm.APM,
 ) {
 	// set the service as Not ready as soon as it's exiting main
@@ -64,13 +65,14 @@ func shutdown(
 		fmt.Sprintf("initiated: %s", time.Now().Format(time.RFC3339)),
 	)
 	logger.Info(ctx, "initiating shutdown")
-	shutdownDependenciesAndServices(ctx, httpServer, grpcServer, apmIns)
+	shutdownDependenciesAndServices(ctx, httpServer, grpcServer, stopJobs, apmIns)
 }
 
 func shutdownDependenciesAndServices(
 	ctx context.Context,
 	httpServer *xhttp.HTTP,
 	grpcServer *grpc.GRPC,
+	stopJobs func(),
 	apmIns *apm.APM,
 ) {
 	wgroup := &sync.WaitGroup{}
@@ -90,6 +92,11 @@ func shutdownDependenciesAndServices(
 		}()
 	}
 
+	// background jobs are not serving anyone, they can be stopped right away
+	if stopJobs != nil {
+		stopJobs()
+	}
+
 	// after all the APIs of the application are shutdown (e.g. HTTP, gRPC, Pubsub listener etc.)
 	// we should close connections to dependencies like database, cache etc.
 	// This should only be done after the APIs are shutdown completely